@@ -4,13 +4,12 @@ import (
 	"context"
 	"github.com/Hamifthi/authentication_microservice/internal"
 	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
-	"github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters"
-	"github.com/Hamifthi/authentication_microservice/pkg/database"
-	"github.com/gorilla/mux"
+	"github.com/Hamifthi/authentication_microservice/pkg/notification"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -22,118 +21,127 @@ func main() {
 		l.Println("[Error] reading environment variable")
 		os.Exit(1)
 	}
-	// TODO postgres db initialization and implementation
-	//// initialize, connecting and migrating user model to the database
-	//db, err := internal.InitializeAndConnectDBAndMigrate(l)
-	//if err != nil {
-	//	l.Printf("[Error] got the %s database error", err)
-	//  os.Exit(1)
-	//}
-	//// create the db service and auth service
-	//dbService := database.New(db, l)
-
-	// TODO mongodb initialization
+	// connect to the database which is selected by the DB_DRIVER config
 	ctx := context.TODO()
-	client, err := internal.ConnectMongoDB(ctx, l)
+	dbService, closeDB, err := internal.CreateDatabaseService(ctx, l)
 	if err != nil {
-		l.Printf("[Error] got the %s mognodb database error", err)
+		l.Printf("[Error] got the %s database error", err)
 		os.Exit(1)
 	}
-	dbName, _ := internal.GetEnv("MONGO_DATABASE")
-	collName, _ := internal.GetEnv("MONGO_COLLECTION")
-	collection := client.Database(dbName).Collection(collName)
-	dbService := database.NewMongoSrv(collection, ctx, l)
-	authService := authentication.New(dbService, l)
-
-	// TODO this is the rest part of the code
-	// create auth handler to use its functions in the router
-	authHandler := adapters.NewHandler(authService, l)
-	// create the router
-	sm := mux.NewRouter()
-	SignUpRouter := sm.Methods(http.MethodPost).Subrouter()
-	SignUpRouter.HandleFunc("/signup", authHandler.UserSignUp)
-	SignUpRouter.Use(authHandler.MiddlewareValidateUser)
-
-	LoginRouter := sm.Methods(http.MethodPost).Subrouter()
-	LoginRouter.HandleFunc("/login", authHandler.UserLogin)
-	LoginRouter.Use(authHandler.MiddlewareValidateUser)
-
-	// create a new server
-	bindAddress, err := internal.GetEnv("BINDADDRESS")
+	authService, err := authentication.New(dbService, l)
 	if err != nil {
-		l.Println("[Error] getting the bindAddress")
-		bindAddress = ":8000"
+		l.Printf("[Error] got the %s error creating the authentication service", err)
+		os.Exit(1)
 	}
-	server := http.Server{
-		Addr:         bindAddress,       // configure the bind address
-		Handler:      sm,                // set the default handler
-		ErrorLog:     l,                 // set the logger for the server
-		ReadTimeout:  5 * time.Second,   // max time to read request from the client
-		WriteTimeout: 10 * time.Second,  // max time to write response to the client
-		IdleTimeout:  120 * time.Second, // max time for connections using TCP Keep-Alive
+	err = authService.CheckConfig()
+	if err != nil {
+		l.Printf("[Error] got the %s error checking the config", err)
+		os.Exit(1)
 	}
-
-	// start the server
-	go func() {
-		l.Println("Starting server on port 8000")
-
-		err := server.ListenAndServe()
+	// load the token signing key and keep reloading or rotating it in the background
+	err = authService.Keys().Load()
+	if err != nil {
+		l.Printf("[Error] got the %s error loading the token keys", err)
+		os.Exit(1)
+	}
+	// register the OAuth clients of the file which is set in the config
+	clientsPath, err := internal.GetEnv("OAuthClientsPath")
+	if err == nil && clientsPath != "" {
+		err = authService.LoadClients(clientsPath)
 		if err != nil {
-			l.Printf("Error starting server: %s\n", err)
+			l.Printf("[Error] got the %s error loading the OAuth clients", err)
 			os.Exit(1)
 		}
+	}
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go authService.Keys().Run(backgroundCtx)
+	// deliver the notifications with the driver of the config through the retrying queue, so the
+	// requests never wait for the mail server
+	notifier, closeNotifier, err := internal.CreateNotifier(l)
+	if err != nil {
+		l.Printf("[Error] got the %s error creating the notifier", err)
+		os.Exit(1)
+	}
+	templates, err := internal.LoadNotificationTemplates(l)
+	if err != nil {
+		l.Printf("[Error] got the %s error loading the notification templates", err)
+		os.Exit(1)
+	}
+	if templates != nil {
+		authService.SetNotificationTemplates(templates)
+	}
+	notificationQueue := notification.NewQueue(notifier, l)
+	queueStopped := make(chan struct{})
+	go func() {
+		notificationQueue.Run(backgroundCtx)
+		close(queueStopped)
 	}()
+	authService.SetNotifier(notificationQueue)
 
-	// trap sigterm or interupt and gracefully shutdown the server
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	signal.Notify(c, os.Kill)
+	// create the gateways which are enabled in the config
+	servers, err := createServers(authService, l)
+	if err != nil {
+		l.Printf("[Error] got the %s error creating the servers", err)
+		os.Exit(1)
+	}
 
-	// Block until a signal is received.
-	sig := <-c
-	log.Println("Got signal:", sig)
+	// start the servers, a server which fails stops the whole process
+	failed := make(chan error, len(servers))
+	for name, s := range servers {
+		go func(name string, s server) {
+			l.Printf("Starting %s server on %s", name, s.BindAddress())
+			err := s.Serve()
+			if err != nil {
+				l.Printf("Error starting %s server: %s\n", name, err)
+				failed <- err
+			}
+		}(name, s)
+	}
 
-	// gracefully shutdown the server, waiting max 30 seconds for current operations to complete
-	shutdownCtx, _ := context.WithTimeout(context.Background(), 30*time.Second)
-	server.Shutdown(shutdownCtx)
+	// trap sigterm or interupt and gracefully shutdown the servers
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	// Block until a signal is received or a server fails.
+	exitCode := 0
+	select {
+	case sig := <-c:
+		l.Println("Got signal:", sig)
+	case err := <-failed:
+		l.Printf("[Error] got the %s error serving, shutting down", err)
+		exitCode = 1
+	}
 
-	// TODO enable this if you want to run the grpc part of the file
-	//// create a new gRPC server, use WithInsecure to allow http connections
-	//gs := grpc.NewServer()
-	//
-	//// create an instance of the Currency server
-	//grpcAS := authentication.NewAuthServer(authService, l)
-	//
-	//// register the currency server
-	//protos.RegisterAuthServiceServer(gs, grpcAS)
-	//
-	//// register the reflection service which allows clients to determine the methods
-	//// for this gRPC service
-	//reflection.Register(gs)
-	//
-	//// create a TCP socket for inbound server connections
-	//listener, err := net.Listen("tcp", fmt.Sprintf(":%d", 8000))
-	//if err != nil {
-	//	l.Printf("[Error] Unable to create listener due to %s error", err)
-	//	os.Exit(1)
-	//}
-	//
-	//// listen for requests
-	//gs.Serve(listener)
-	// TODO graphql implementation
-	//port, _ := internal.GetEnv("PORT")
-	//if port == "" {
-	//	port = "8000"
-	//}
-	//resolver := &authentication.Resolver{
-	//	authService, l,
-	//}
-	//
-	//srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
-	//
-	//http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	//http.Handle("/query", srv)
-	//
-	//l.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	//l.Fatal(http.ListenAndServe(":"+port, nil))
+	// gracefully shutdown the servers, waiting max 30 seconds for current operations to complete
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for name, s := range servers {
+		wg.Add(1)
+		go func(name string, s server) {
+			defer wg.Done()
+			if err := s.Shutdown(shutdownCtx); err != nil {
+				l.Printf("Error shutting down %s server: %s\n", name, err)
+			}
+		}(name, s)
+	}
+	wg.Wait()
+	// stop the queue after the servers so it sends the last notifications before the driver is closed
+	stopBackground()
+	select {
+	case <-queueStopped:
+	case <-shutdownCtx.Done():
+		l.Println("Error stopping the notification queue: timed out")
+	}
+	if err := closeDB(shutdownCtx); err != nil {
+		l.Printf("Error closing the database connections: %s\n", err)
+	}
+	if err := closeNotifier(shutdownCtx); err != nil {
+		l.Printf("Error closing the notifier: %s\n", err)
+	}
+	// a failed server exits with an error once everything is closed
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
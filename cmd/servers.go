@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// server is implemented by every gateway so they can be started and stopped the same way
+type server interface {
+	BindAddress() string
+	Serve() error
+	Shutdown(ctx context.Context) error
+}
+
+type httpServer struct {
+	*http.Server
+}
+
+func (s httpServer) BindAddress() string {
+	return s.Addr
+}
+
+func (s httpServer) Serve() error {
+	err := s.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+type grpcServer struct {
+	server      *grpc.Server
+	bindAddress string
+}
+
+func (s grpcServer) BindAddress() string {
+	return s.bindAddress
+}
+
+func (s grpcServer) Serve() error {
+	// create a TCP socket for inbound server connections
+	listener, err := net.Listen("tcp", s.bindAddress)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(listener)
+}
+
+func (s grpcServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// getBindAddress reads the bind address of a server and falls back to the default one
+func getBindAddress(key, defaultAddress string, l *log.Logger) string {
+	bindAddress, err := internal.GetEnv(key)
+	if err != nil || bindAddress == "" {
+		l.Printf("[Error] getting the %s, using %s", key, defaultAddress)
+		return defaultAddress
+	}
+	return bindAddress
+}
+
+func newHTTPServer(bindAddress string, h http.Handler, l *log.Logger) httpServer {
+	return httpServer{&http.Server{
+		Addr:         bindAddress,       // configure the bind address
+		Handler:      h,                 // set the default handler
+		ErrorLog:     l,                 // set the logger for the server
+		ReadTimeout:  5 * time.Second,   // max time to read request from the client
+		WriteTimeout: 10 * time.Second,  // max time to write response to the client
+		IdleTimeout:  120 * time.Second, // max time for connections using TCP Keep-Alive
+	}}
+}
+
+func newRESTServer(authService *authentication.AuthenticationService, l *log.Logger) server {
+	// create auth handler to use its functions in the router
+	authHandler := adapters.NewHandler(authService, l)
+	bindAddress := getBindAddress("BINDADDRESS", ":8000", l)
+	return newHTTPServer(bindAddress, adapters.NewRouter(authHandler), l)
+}
+
+func newGRPCServer(authService *authentication.AuthenticationService, l *log.Logger) server {
+	gs := grpc.NewServer()
+	// register the auth server
+	protos.RegisterAuthServiceServer(gs, adapters.NewAuthServer(authService, l))
+	// register the reflection service which allows clients to determine the methods
+	// for this gRPC service
+	reflection.Register(gs)
+	bindAddress := getBindAddress("GRPC_BINDADDRESS", ":8001", l)
+	return grpcServer{gs, bindAddress}
+}
+
+func newGraphQLServer(authService *authentication.AuthenticationService, l *log.Logger) server {
+	resolver := &adapters.Resolver{AuthService: authService, Logger: l}
+	mux := http.NewServeMux()
+	mux.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	mux.Handle("/query", adapters.NewGraphQLHandler(resolver))
+	bindAddress := getBindAddress("GRAPHQL_BINDADDRESS", ":8002", l)
+	return newHTTPServer(bindAddress, mux, l)
+}
+
+var serverFactories = map[string]func(*authentication.AuthenticationService, *log.Logger) server{
+	"rest":    newRESTServer,
+	"grpc":    newGRPCServer,
+	"graphql": newGraphQLServer,
+}
+
+// createServers creates the gateways listed in the comma separated SERVERS config, only the
+// REST server is created when it isn't set
+func createServers(authService *authentication.AuthenticationService, l *log.Logger) (map[string]server, error) {
+	serversConfig, err := internal.GetEnv("SERVERS")
+	if err != nil || serversConfig == "" {
+		serversConfig = "rest"
+	}
+	servers := map[string]server{}
+	for _, name := range strings.Split(serversConfig, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		factory, ok := serverFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown server %s in the SERVERS config", name)
+		}
+		servers[name] = factory(authService, l)
+	}
+	return servers, nil
+}
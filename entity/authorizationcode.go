@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// AuthorizationCode is issued by the authorization endpoint and exchanged for the tokens once,
+// its ID is the hash of the code so the stored codes can't be redeemed. The tokens of the code
+// belong to FamilyID, which is revoked if the code is redeemed twice.
+type AuthorizationCode struct {
+	ID            string    `gorm:"primaryKey" json:"id" bson:"_id"`
+	FamilyID      string    `gorm:"not null" json:"familyId" bson:"familyId"`
+	ClientID      string    `gorm:"not null" json:"clientId" bson:"clientId"`
+	Email         string    `gorm:"not null" json:"email" bson:"email"`
+	RedirectURI   string    `json:"redirectUri" bson:"redirectUri"`
+	Scope         string    `json:"scope" bson:"scope"`
+	Nonce         string    `json:"nonce" bson:"nonce"`
+	CodeChallenge string    `json:"codeChallenge" bson:"codeChallenge"`
+	Used          bool      `json:"used" bson:"used"`
+	ExpiresAt     time.Time `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt     time.Time `gorm:"autoCreateTime:milli" json:"createdAt" bson:"createdAt"`
+}
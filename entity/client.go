@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// Client is an application which is registered to get tokens through the OAuth 2.0 flows. A
+// confidential client authenticates with the secret of SecretHash, a public client has none.
+// Scopes are the scopes the client may get for itself by the client credentials grant.
+type Client struct {
+	ID           string    `gorm:"primaryKey" json:"id" bson:"_id"`
+	Name         string    `json:"name" bson:"name"`
+	SecretHash   string    `json:"-" bson:"secretHash"`
+	RedirectURIs []string  `gorm:"serializer:json" json:"redirectUris" bson:"redirectUris"`
+	Scopes       []string  `gorm:"serializer:json" json:"scopes" bson:"scopes"`
+	CreatedAt    time.Time `gorm:"autoCreateTime:milli" json:"createdAt" bson:"createdAt"`
+}
+
+// HasRedirectURI reports whether the redirect URI is registered for the client, the URIs
+// are compared exactly
+func (c Client) HasRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the client is allowed to get the scope
+func (c Client) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
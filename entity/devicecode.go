@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+// The states of a device code, it's pending until the user approves or denies it on the
+// verification page
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is issued by the device authorization endpoint, the device polls the token endpoint
+// with it while the user enters UserCode on the verification page. Its ID is the hash of the
+// device code and Email is the user who approved it.
+type DeviceCode struct {
+	ID           string        `gorm:"primaryKey" json:"id" bson:"_id"`
+	UserCode     string        `gorm:"uniqueIndex;not null" json:"userCode" bson:"userCode"`
+	ClientID     string        `gorm:"not null" json:"clientId" bson:"clientId"`
+	Scope        string        `json:"scope" bson:"scope"`
+	Status       string        `gorm:"not null" json:"status" bson:"status"`
+	Email        string        `json:"email" bson:"email"`
+	Interval     time.Duration `json:"interval" bson:"interval"`
+	LastPolledAt time.Time     `json:"lastPolledAt" bson:"lastPolledAt"`
+	Used         bool          `json:"used" bson:"used"`
+	ExpiresAt    time.Time     `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt    time.Time     `gorm:"autoCreateTime:milli" json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// RevokedToken is an entry of the revocation list, the ID is either a token id or a session
+// family id and the entry only needs to be kept until ExpiresAt
+type RevokedToken struct {
+	ID        string    `gorm:"primaryKey" json:"id" bson:"_id"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime:milli" json:"createdAt" bson:"createdAt"`
+}
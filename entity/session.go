@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// Session represents a single issued refresh token. Every refresh token belongs to a family
+// which is created on login and shared by all the refresh tokens rotated from it. ClientID
+// and Scope are set when the family is created by an OAuth client.
+type Session struct {
+	ID        string    `gorm:"primaryKey" json:"id" bson:"_id"`
+	FamilyID  string    `gorm:"index;not null" json:"familyId" bson:"familyId"`
+	Email     string    `gorm:"index;not null" json:"email" bson:"email"`
+	ClientID  string    `json:"clientId,omitempty" bson:"clientId,omitempty"`
+	Scope     string    `json:"scope,omitempty" bson:"scope,omitempty"`
+	Used      bool      `json:"used" bson:"used"`
+	Revoked   bool      `json:"revoked" bson:"revoked"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime:milli" json:"createdAt" bson:"createdAt"`
+}
@@ -1,6 +1,10 @@
 package entity
 
+// Tokens are the tokens of signing in, only the MFAToken is set when the user has to verify a
+// second factor before getting the other tokens
 type Tokens struct {
 	AccessToken  string
 	RefreshToken string
+	IDToken      string `json:",omitempty"`
+	MFAToken     string `json:",omitempty"`
 }
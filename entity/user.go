@@ -7,14 +7,26 @@ import (
 	"time"
 )
 
+// User is the account of the service. EmailVerified is set once the user opens the link of the
+// verification email. MFAEnabled is set once the user confirms the TOTP secret
+// with a first code, TOTPLastCounter is the time step of the last accepted code so that it can't
+// be replayed, and RecoveryCodes are the hashes of the unused recovery codes. MFALockedUntil is
+// when the codes are accepted again after too many invalid ones.
 type User struct {
-	ID             interface{} `gorm:"primaryKey;autoIncrement" json:"_id,omitempty" bson:"_id,omitempty"`
-	Email          string      `gorm:"not null" json:"email" validate:"required"`
-	Password       string      `sql:"-" json:"password" validate:"required"`
-	HashedPassword string      `json:"-"`
-	TokenHash      string      `json:"-"`
-	CreatedAt      time.Time   `gorm:"autoCreateTime:milli" json:"-"`
-	UpdatedAt      time.Time   `gorm:"autoCreateTime:milli" json:"-"`
+	ID                string    `gorm:"primaryKey" json:"_id,omitempty" bson:"_id,omitempty"`
+	Email             string    `gorm:"uniqueIndex;not null" json:"email" validate:"required"`
+	Password          string    `gorm:"-" json:"password" bson:"-" validate:"required"`
+	HashedPassword    string    `json:"-"`
+	TokenHash         string    `json:"-"`
+	EmailVerified     bool      `json:"-"`
+	MFAEnabled        bool      `json:"-"`
+	TOTPSecret        string    `json:"-"`
+	TOTPLastCounter   int64     `json:"-"`
+	MFAFailedAttempts int       `json:"-"`
+	MFALockedUntil    time.Time `json:"-"`
+	RecoveryCodes     []string  `gorm:"serializer:json" json:"-"`
+	CreatedAt         time.Time `gorm:"autoCreateTime:milli" json:"-"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime:milli" json:"-"`
 }
 
 func (u *User) Validate() error {
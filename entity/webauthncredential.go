@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key of the user. Its ID is the base64url encoded
+// credential id, PublicKey is the COSE encoded public key and SignCount is the signature counter
+// of the authenticator which reveals cloned authenticators. BackupEligible is whether the passkey
+// can be synced, which doesn't change during its lifetime.
+type WebAuthnCredential struct {
+	ID              string    `gorm:"primaryKey" json:"id" bson:"_id"`
+	Email           string    `gorm:"index;not null" json:"email" bson:"email"`
+	PublicKey       []byte    `gorm:"not null" json:"publicKey" bson:"publicKey"`
+	AttestationType string    `json:"attestationType" bson:"attestationType"`
+	BackupEligible  bool      `json:"backupEligible" bson:"backupEligible"`
+	SignCount       int64     `json:"signCount" bson:"signCount"`
+	Transports      []string  `gorm:"serializer:json" json:"transports" bson:"transports"`
+	LastUsedAt      time.Time `json:"lastUsedAt" bson:"lastUsedAt"`
+	CreatedAt       time.Time `gorm:"autoCreateTime:milli" json:"createdAt" bson:"createdAt"`
+}
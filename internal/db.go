@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -61,6 +63,10 @@ func CreateDBConnection(DSN string, logger *log.Logger) (*gorm.DB, error) {
 
 	// Create the connection pool
 	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Println("[Error] occurred while getting the database connection pool")
+		return nil, err
+	}
 	sqlDB.SetConnMaxIdleTime(time.Minute * 10)
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
 	sqlDB.SetMaxIdleConns(10)
@@ -84,8 +90,8 @@ func GetDatabaseConnection(dbConn *gorm.DB, logger *log.Logger) (*gorm.DB, error
 	return dbConn, nil
 }
 
-func AutoMigrate(db *gorm.DB, model interface{}) error {
-	err := db.AutoMigrate(model)
+func AutoMigrate(db *gorm.DB, models ...interface{}) error {
+	err := db.AutoMigrate(models...)
 	return err
 }
 
@@ -105,10 +111,10 @@ func InitializeAndConnectDBAndMigrate(l *log.Logger) (*gorm.DB, error) {
 		l.Println("[Error] cannot get the database connection")
 		return nil, errors.Wrap(err, "Error cannot get the database connection")
 	}
-	err = AutoMigrate(db, entity.User{})
+	err = AutoMigrate(db, entity.User{}, entity.Session{}, entity.RevokedToken{}, entity.AuthorizationCode{}, entity.Client{}, entity.DeviceCode{}, entity.WebAuthnCredential{})
 	if err != nil {
-		l.Println("[Error] cannot auto migrate the user to the database")
-		return nil, errors.Wrap(err, "Error cannot auto migrate the user to the database")
+		l.Println("[Error] cannot auto migrate the models to the database")
+		return nil, errors.Wrap(err, "Error cannot auto migrate the models to the database")
 	}
 	return db, nil
 }
@@ -135,3 +141,50 @@ func ConnectMongoDB(ctx context.Context, l *log.Logger) (*mongo.Client, error) {
 	}
 	return client, nil
 }
+
+// CloseFunc releases the connections of a database service
+type CloseFunc func(ctx context.Context) error
+
+// CreateDatabaseService connects to the database which is selected by the DB_DRIVER config and
+// returns its service, mongo is used when the driver isn't set
+func CreateDatabaseService(ctx context.Context, l *log.Logger) (database.DatabaseInterface, CloseFunc, error) {
+	driver, err := GetEnv("DB_DRIVER")
+	if err != nil || driver == "" {
+		driver = "mongo"
+	}
+	switch strings.ToLower(driver) {
+	case "postgres":
+		// initialize, connecting and migrating the models to the database
+		db, err := InitializeAndConnectDBAndMigrate(l)
+		if err != nil {
+			return nil, nil, err
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			l.Println("[Error] cannot get the postgres connection pool")
+			return nil, nil, errors.Wrap(err, "Error cannot get the postgres connection pool")
+		}
+		closeFunc := func(ctx context.Context) error { return sqlDB.Close() }
+		return database.New(db, l), closeFunc, nil
+	case "mongo", "mongodb":
+		client, err := ConnectMongoDB(ctx, l)
+		if err != nil {
+			return nil, nil, err
+		}
+		dbName, _ := GetEnv("MONGO_DATABASE")
+		collName, _ := GetEnv("MONGO_COLLECTION")
+		collection := client.Database(dbName).Collection(collName)
+		dbService := database.NewMongoSrv(collection, ctx, l)
+		if err := dbService.CreateIndexes(); err != nil {
+			return nil, nil, err
+		}
+		return dbService, client.Disconnect, nil
+	case "memory":
+		l.Println("[Warning] using the memory database, nothing is persisted")
+		closeFunc := func(ctx context.Context) error { return nil }
+		return database.NewMemorySrv(l), closeFunc, nil
+	default:
+		l.Printf("[Error] unknown database driver %s", driver)
+		return nil, nil, fmt.Errorf("unknown database driver %s, use mongo, postgres or memory", driver)
+	}
+}
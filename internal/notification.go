@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/Hamifthi/authentication_microservice/pkg/notification"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"strings"
+)
+
+// CreateNotifier returns the notifier which is selected by the NOTIFIER_DRIVER config. The driver
+// is required, since falling back to stdout would print the links which carry the tokens.
+func CreateNotifier(l *log.Logger) (notification.Notifier, CloseFunc, error) {
+	noClose := func(ctx context.Context) error { return nil }
+	driver, err := GetEnv("NOTIFIER_DRIVER")
+	if err != nil || driver == "" {
+		l.Println("[Error] reading notifier driver environment variable")
+		return nil, nil, errors.New("NOTIFIER_DRIVER must be set to stdout, file or smtp")
+	}
+	switch strings.ToLower(driver) {
+	case "stdout":
+		l.Println("[Warning] the notifications are printed to stdout, which is only meant for local development")
+		return notification.NewWriterNotifier(os.Stdout), noClose, nil
+	case "file":
+		path, err := GetEnv("NOTIFIER_FILE")
+		if err != nil || path == "" {
+			l.Println("[Error] reading notifier file environment variable")
+			return nil, nil, errors.New("NOTIFIER_FILE must be set for the file notifier")
+		}
+		notifier, file, err := notification.NewFileNotifier(path)
+		if err != nil {
+			l.Println("[Error] opening the notification file")
+			return nil, nil, err
+		}
+		return notifier, func(ctx context.Context) error { return file.Close() }, nil
+	case "smtp":
+		settings := map[string]string{}
+		for _, key := range []string{"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM"} {
+			settings[key], _ = GetEnv(key)
+		}
+		if settings["SMTP_HOST"] == "" || settings["SMTP_FROM"] == "" {
+			l.Println("[Error] reading smtp environment variables")
+			return nil, nil, errors.New("SMTP_HOST and SMTP_FROM must be set for the smtp notifier")
+		}
+		if settings["SMTP_PORT"] == "" {
+			settings["SMTP_PORT"] = "587"
+		}
+		notifier, err := notification.NewSMTPNotifier(settings["SMTP_HOST"], settings["SMTP_PORT"],
+			settings["SMTP_USERNAME"], settings["SMTP_PASSWORD"], settings["SMTP_FROM"])
+		if err != nil {
+			l.Println("[Error] creating the smtp notifier")
+			return nil, nil, err
+		}
+		return notifier, noClose, nil
+	default:
+		l.Printf("[Error] unknown notifier driver %s", driver)
+		return nil, nil, fmt.Errorf("unknown notifier driver %s, use stdout, file or smtp", driver)
+	}
+}
+
+// LoadNotificationTemplates parses the templates of the NOTIFIER_TEMPLATES directory, nil is
+// returned when it isn't set so the embedded templates are kept
+func LoadNotificationTemplates(l *log.Logger) (*notification.Templates, error) {
+	dir, err := GetEnv("NOTIFIER_TEMPLATES")
+	if err != nil || dir == "" {
+		return nil, nil
+	}
+	templates, err := notification.NewTemplates(os.DirFS(dir))
+	if err != nil {
+		l.Println("[Error] parsing the notification templates")
+		return nil, errors.Wrap(err, "Error parsing the notification templates")
+	}
+	return templates, nil
+}
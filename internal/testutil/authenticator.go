@@ -0,0 +1,146 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	TestRPID   = "localhost"
+	TestOrigin = "https://localhost"
+)
+
+// Authenticator is a software WebAuthn authenticator with an ES256 passkey. It returns the
+// credentials as JSON like the browsers send them, Origin and RPID default to the ones of the
+// test config and can be changed to forge the responses.
+type Authenticator struct {
+	Key          *ecdsa.PrivateKey
+	CredentialID []byte
+	SignCount    uint32
+	// Format is the attestation format, none or packed self attestation
+	Format           string
+	UserVerification bool
+	Origin           string
+	RPID             string
+}
+
+func NewAuthenticator(t T) *Authenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating the passkey: %s", err)
+	}
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	if err != nil {
+		t.Fatalf("generating the credential id: %s", err)
+	}
+	return &Authenticator{
+		Key: key, CredentialID: credentialID, Format: "none", UserVerification: true, Origin: TestOrigin, RPID: TestRPID,
+	}
+}
+
+// ID is the base64url encoded credential id
+func (a *Authenticator) ID() string {
+	return base64.RawURLEncoding.EncodeToString(a.CredentialID)
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) []byte {
+	clientData, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": a.Origin})
+	return clientData
+}
+
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	flags |= 0x01
+	if a.UserVerification {
+		flags |= 0x04
+	}
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.SignCount)
+	return data
+}
+
+func (a *Authenticator) sign(t T, authData, clientData []byte) []byte {
+	t.Helper()
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	if err != nil {
+		t.Fatalf("signing the client data: %s", err)
+	}
+	return signature
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Create returns the credential of navigator.credentials.create for the challenge
+func (a *Authenticator) Create(t T, challenge string) []byte {
+	t.Helper()
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1: 2, 3: -7, -1: 1, -2: a.Key.X.FillBytes(make([]byte, 32)), -3: a.Key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("encoding the public key: %s", err)
+	}
+	authData := a.authenticatorData(0x40)
+	// the aaguid of the software authenticator is zero
+	authData = append(authData, make([]byte, 16)...)
+	authData = append(authData, byte(len(a.CredentialID)>>8), byte(len(a.CredentialID)))
+	authData = append(append(authData, a.CredentialID...), publicKey...)
+	clientData := a.clientData("webauthn.create", challenge)
+	statement := map[string]interface{}{}
+	if a.Format == "packed" {
+		statement = map[string]interface{}{"alg": -7, "sig": a.sign(t, authData, clientData)}
+	}
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt": a.Format, "attStmt": statement, "authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("encoding the attestation object: %s", err)
+	}
+	credential, err := json.Marshal(map[string]interface{}{
+		"id": a.ID(), "rawId": a.ID(), "type": "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("encoding the credential: %s", err)
+	}
+	return credential
+}
+
+// Get returns the assertion of navigator.credentials.get for the challenge, the signature
+// counter is increased first when it isn't zero
+func (a *Authenticator) Get(t T, challenge, userID string) []byte {
+	t.Helper()
+	if a.SignCount != 0 {
+		a.SignCount++
+	}
+	authData := a.authenticatorData(0)
+	clientData := a.clientData("webauthn.get", challenge)
+	credential, err := json.Marshal(map[string]interface{}{
+		"id": a.ID(), "rawId": a.ID(), "type": "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(a.sign(t, authData, clientData)),
+			"userHandle":        encode([]byte(userID)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("encoding the assertion: %s", err)
+	}
+	return credential
+}
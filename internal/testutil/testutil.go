@@ -0,0 +1,110 @@
+// Package testutil holds the helpers which are shared between the tests of different packages.
+// The fixtures of the storage stay in the tests of every package, and the helpers take a T so the
+// package doesn't depend on the testing packages.
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/Hamifthi/authentication_microservice/pkg/notification"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+const (
+	TestEmail    = "test@test.com"
+	TestPassword = "587@_Testing123"
+	TestBaseURL  = "https://auth.test"
+)
+
+// T is the part of testing.TB which the helpers use
+type T interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	TempDir() string
+}
+
+// InitializeConfig writes a fresh RSA key pair and sets the config values the services
+// read, so the tests don't depend on a local env file
+func InitializeConfig(t T) {
+	t.Helper()
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "private.pem")
+	publicKeyPath := filepath.Join(dir, "public.pem")
+	WriteKeyPair(t, privateKeyPath, publicKeyPath)
+
+	viper.Set("MinEntropyBits", "60")
+	viper.Set("JwtExpiration", "15")
+	viper.Set("RefreshTokenExpiration", "60")
+	viper.Set("TokenPrivateKeyPath", privateKeyPath)
+	viper.Set("TokenPublicKeyPath", publicKeyPath)
+	viper.Set("TokenKeyDir", filepath.Join(dir, "keys"))
+	viper.Set("WebAuthnRPID", TestRPID)
+	viper.Set("WebAuthnOrigin", TestOrigin)
+	viper.Set("BaseURL", TestBaseURL)
+}
+
+// WriteKeyPair generates an RSA key pair and writes it as PEM files to the given paths
+func WriteKeyPair(t T, privateKeyPath, publicKeyPath string) {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating the key pair: %s", err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshaling the public key: %s", err)
+	}
+	privatePem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+	if err := ioutil.WriteFile(privateKeyPath, privatePem, 0600); err != nil {
+		t.Fatalf("writing the private key: %s", err)
+	}
+	if err := ioutil.WriteFile(publicKeyPath, publicPem, 0644); err != nil {
+		t.Fatalf("writing the public key: %s", err)
+	}
+}
+
+// Notifier keeps the sent notifications in memory for the tests to read
+type Notifier struct {
+	mu       sync.Mutex
+	Messages []notification.Message
+}
+
+func (n *Notifier) Send(message notification.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Messages = append(n.Messages, message)
+	return nil
+}
+
+// LastToken returns the token query parameter of the link in the last notification sent to the address
+func (n *Notifier) LastToken(t T, to string) string {
+	t.Helper()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := len(n.Messages) - 1; i >= 0; i-- {
+		if n.Messages[i].To != to {
+			continue
+		}
+		match := regexp.MustCompile(`token=([^\s&]+)`).FindStringSubmatch(n.Messages[i].Text)
+		if len(match) != 2 {
+			t.Errorf("the notification has no token")
+			return ""
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Errorf("unescaping the token: %s", err)
+		}
+		return token
+	}
+	t.Errorf("no notification is sent to %s", to)
+	return ""
+}
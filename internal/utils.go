@@ -1,11 +1,13 @@
 package internal
 
 import (
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
-	"math/rand"
+	mathRand "math/rand"
 )
 
 func InitializeEnv(envFilePath string) error {
@@ -30,7 +32,7 @@ const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 func RandString(n int) string {
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letterBytes[rand.Int63()%int64(len(letterBytes))]
+		b[i] = letterBytes[mathRand.Int63()%int64(len(letterBytes))]
 	}
 	return string(b)
 }
@@ -39,5 +41,14 @@ func GenerateCustomKey(email, hashToken string) string {
 	h := sha1.New()
 	h.Write([]byte(email + hashToken))
 	byteSlice := h.Sum(nil)
-	return string(byteSlice)
+	return hex.EncodeToString(byteSlice)
+}
+
+// GenerateID returns a random hex encoded identifier which is safe to use for token ids
+func GenerateID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.Wrap(err, "Error reading random bytes"))
+	}
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,123 @@
+package adapters
+
+import (
+	"encoding/json"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/pkg/errors"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// devicePage is the verification page where the user enters the code which the device shows
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+{{if .Done}}
+<p>{{.Done}} You can return to your device.</p>
+{{else}}
+{{if .Client.ID}}<p><b>{{.Client.Name}}</b> wants to access your account{{if .Scopes}} with the following scopes:{{end}}</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<form method="post" action="/device">
+<label>Code <input type="text" name="user_code" value="{{.UserCode}}" autocomplete="off" required></label>
+<label>Email <input type="email" name="email" required></label>
+<label>Password <input type="password" name="password"></label>
+<label>Authentication code, if MFA is enabled <input type="text" name="mfa_code" autocomplete="one-time-code"></label>
+<button type="submit" name="consent" value="allow">Allow</button>
+<button type="submit" name="consent" value="deny" formnovalidate>Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type devicePageData struct {
+	UserCode string
+	Client   entity.Client
+	Scopes   []string
+	Error    string
+	Done     string
+}
+
+func (ah *AuthenticationHandler) renderDevicePage(rw http.ResponseWriter, status int, data devicePageData) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	err := devicePage.Execute(rw, data)
+	if err != nil {
+		ah.l.Printf("[ERROR] rendering the device page has %s error", err)
+	}
+}
+
+// DeviceAuthorization is the device authorization endpoint of RFC 8628, it issues the device
+// code which the device polls the token endpoint with and the user code which the user enters
+func (ah *AuthenticationHandler) DeviceAuthorization(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Device Authorization")
+	clientID, clientSecret, basicAuth := clientCredentials(r)
+	response, err := ah.authService.AuthorizeDevice(clientID, clientSecret, r.PostFormValue("scope"))
+	oauthErr := &authentication.OAuthError{}
+	if errors.As(err, &oauthErr) {
+		ah.l.Printf("[ERROR] authorizing the device has %s error", err)
+		oauthErrorResponse(rw, oauthErr, basicAuth)
+		return
+	}
+	if err != nil {
+		ah.l.Printf("[ERROR] authorizing the device has %s error", err)
+		oauthErrorResponse(rw, &authentication.OAuthError{Code: "server_error"}, basicAuth)
+		return
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to authorize the device", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+// Device is the verification page of the device authorization grant. GET shows the page, with the
+// client of the code when it's in the user_code param, and POST signs in the user and approves or
+// denies the code.
+func (ah *AuthenticationHandler) Device(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Device Verification")
+	data := devicePageData{UserCode: r.FormValue("user_code")}
+	if data.UserCode != "" {
+		code, client, err := ah.authService.GetDeviceAuthorization(data.UserCode)
+		if err != nil {
+			ah.l.Printf("[ERROR] getting the device authorization has %s error", err)
+			data.Error = "The code is invalid or expired, please check it on your device"
+			ah.renderDevicePage(rw, http.StatusBadRequest, data)
+			return
+		}
+		data.Client = client
+		data.Scopes = strings.Fields(code.Scope)
+	}
+	if r.Method == http.MethodGet {
+		ah.renderDevicePage(rw, http.StatusOK, data)
+		return
+	}
+
+	approve := r.PostFormValue("consent") == "allow"
+	err := ah.authService.VerifyDevice(
+		data.UserCode, r.PostFormValue("email"), r.PostFormValue("password"), r.PostFormValue("mfa_code"), approve,
+	)
+	if err != nil {
+		ah.l.Printf("[ERROR] verifying the device has %s error", err)
+		mapping := mapError(err)
+		data.Error = "Unable to signing in the user: " + mapping.err.Error()
+		ah.renderDevicePage(rw, mapping.httpStatus, data)
+		return
+	}
+	data.Done = "The device is connected."
+	if !approve {
+		data.Done = "The device is denied."
+	}
+	ah.renderDevicePage(rw, http.StatusOK, data)
+}
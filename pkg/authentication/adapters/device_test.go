@@ -0,0 +1,55 @@
+package adapters
+
+import (
+	"encoding/json"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	router := initializeOAuthRouter(t)
+	rw := postForm(router, "/device/code", url.Values{"client_id": {"client"}, "scope": {"openid"}})
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var device authentication.DeviceAuthorizationResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&device))
+	assert.NotEmpty(t, device.DeviceCode)
+
+	tokenForm := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"client_id":   {"client"},
+		"device_code": {device.DeviceCode},
+	}
+	rw = postForm(router, "/token", tokenForm)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	var oauthErr authentication.OAuthError
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&oauthErr))
+	assert.Equal(t, "authorization_pending", oauthErr.Code)
+
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/device?user_code="+device.UserCode, nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "Test App")
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/device?user_code=BCDF-GHJK", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	form := url.Values{"user_code": {device.UserCode}, "email": {testutil.TestEmail}, "consent": {"allow"}}
+	form.Set("password", "wrong")
+	rw = postForm(router, "/device", form)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	form.Set("password", testutil.TestPassword)
+	rw = postForm(router, "/device", form)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "The device is connected.")
+
+	// the device polls again too soon
+	rw = postForm(router, "/token", tokenForm)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&oauthErr))
+	assert.Equal(t, "slow_down", oauthErr.Code)
+}
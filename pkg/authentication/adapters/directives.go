@@ -0,0 +1,63 @@
+package adapters
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/graph/generated"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+type keyAuthorization struct{}
+
+type keyAccessTokenClaims struct{}
+
+// MiddlewareAuthorizationHeader puts the Authorization header of the request into its context,
+// so the @auth directive of the GraphQL server is able to read it
+func MiddlewareAuthorizationHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), keyAuthorization{}, r.Header.Get("Authorization"))
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// Auth implements the @auth directive, it validates the bearer first party access token and
+// passes its claims to the resolver through the context
+func (r *Resolver) Auth(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	authHeader, _ := ctx.Value(keyAuthorization{}).(string)
+	authContent := strings.Split(authHeader, " ")
+	if len(authContent) != 2 || authContent[0] != "Bearer" {
+		r.Logger.Println("[ERROR] Authorization token not provided or malformed")
+		return nil, errors.Wrap(authentication.ErrInvalidToken, "Authorization token not provided or malformed")
+	}
+	claims, err := r.AuthService.ValidateFirstPartyAccessToken(authContent[1])
+	if err != nil {
+		r.Logger.Printf("[ERROR] validating the access token has %s error", err)
+		return nil, errors.Wrap(err, "Access token isn't valid")
+	}
+	ctx = context.WithValue(ctx, keyAccessTokenClaims{}, claims)
+	return next(ctx)
+}
+
+func accessTokenClaims(ctx context.Context) authentication.AccessTokenCustomClaims {
+	return ctx.Value(keyAccessTokenClaims{}).(authentication.AccessTokenCustomClaims)
+}
+
+// NewGraphQLHandler creates the GraphQL handler which reports the errors of the authentication
+// service with a code in their extensions
+func NewGraphQLHandler(resolver *Resolver) http.Handler {
+	srv := handler.NewDefaultServer(NewExecutableSchema(resolver))
+	srv.SetErrorPresenter(graphqlErrorPresenter)
+	return MiddlewareAuthorizationHeader(srv)
+}
+
+// NewExecutableSchema creates the GraphQL schema with the resolvers and directives
+func NewExecutableSchema(resolver *Resolver) graphql.ExecutableSchema {
+	return generated.NewExecutableSchema(generated.Config{
+		Resolvers:  resolver,
+		Directives: generated.DirectiveRoot{Auth: resolver.Auth},
+	})
+}
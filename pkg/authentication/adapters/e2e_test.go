@@ -0,0 +1,112 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/99designs/gqlgen/client"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// initializeMemoryAuthService creates the auth service on top of the memory database, so the
+// tests below run the whole flow of every gateway without any mocked storage
+func initializeMemoryAuthService(t *testing.T) (*authentication.AuthenticationService, *log.Logger) {
+	testutil.InitializeConfig(t)
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	authService, err := authentication.New(database.NewMemorySrv(logger), logger)
+	assert.Nil(t, err)
+	return authService, logger
+}
+
+// initializeSignedUpAuthService creates the auth service on top of the memory database with the
+// test user signed up
+func initializeSignedUpAuthService(t *testing.T) (*authentication.AuthenticationService, *log.Logger) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	return authService, logger
+}
+
+func TestRESTEndToEnd(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	router := NewRouter(NewHandler(authService, logger))
+	body := fmt.Sprintf(`{"email": %q, "password": %q}`, testutil.TestEmail, testutil.TestPassword)
+
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body)))
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	tokens := login(t, router)
+	rw = refresh(router, "Bearer "+tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var refreshed entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&refreshed))
+
+	rw = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/logout-all", nil)
+	r.Header.Set("Authorization", "Bearer "+refreshed.RefreshToken)
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	rw = refresh(router, "Bearer "+refreshed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestGrpcEndToEnd(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	server := NewAuthServer(authService, logger)
+	ctx := context.Background()
+
+	_, err := server.SignUp(ctx, &protos.SignUpRequest{Email: testutil.TestEmail, Password: testutil.TestPassword})
+	assert.Nil(t, err)
+	tokens, err := server.Login(ctx, &protos.LoginRequest{Email: testutil.TestEmail, Password: testutil.TestPassword})
+	assert.Nil(t, err)
+	user, err := server.GetCurrentUser(ctx, &protos.GetCurrentUserRequest{AccessToken: tokens.AccessToken})
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, user.User.Email)
+	assert.NotZero(t, user.User.CreatedAt)
+
+	refreshed, err := server.RefreshToken(ctx, &protos.RefreshTokenRequest{RefreshToken: tokens.RefreshToken})
+	assert.Nil(t, err)
+	_, err = server.Logout(ctx, &protos.LogoutRequest{RefreshToken: refreshed.RefreshToken})
+	assert.Nil(t, err)
+	_, err = server.RefreshToken(ctx, &protos.RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	assert.NotNil(t, err)
+}
+
+func TestGraphQLEndToEnd(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	resolver := &Resolver{AuthService: authService, Logger: logger}
+	c := client.New(NewGraphQLHandler(resolver))
+
+	var signUpResp struct{ SignUp string }
+	err := c.Post(`mutation($email: String!, $password: String!) {
+		signUp(input: {email: $email, password: $password})
+	}`, &signUpResp, client.Var("email", testutil.TestEmail), client.Var("password", testutil.TestPassword))
+	assert.Nil(t, err)
+
+	tokens := graphqlLogin(t, c)
+	var sessionsResp struct{ Sessions []struct{ ID string } }
+	err = c.Post(`query { sessions { id } }`, &sessionsResp, client.AddHeader("Authorization", "Bearer "+tokens.Access))
+	assert.Nil(t, err)
+	assert.Len(t, sessionsResp.Sessions, 1)
+
+	var logoutResp struct{ Logout string }
+	err = c.Post(`mutation($token: String!) { logout(refreshToken: $token) }`, &logoutResp, client.Var("token", tokens.Refresh))
+	assert.Nil(t, err)
+	// the access token of the session is revoked with it
+	err = c.Post(`query { sessions { id } }`, &sessionsResp, client.AddHeader("Authorization", "Bearer "+tokens.Access))
+	assert.ErrorContains(t, err, "TOKEN_REVOKED")
+}
@@ -0,0 +1,59 @@
+package adapters
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type emailTokenRequest struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+// VerifyEmail verifies the email of the user with the token of the verification link, the link
+// is opened with GET and the clients can send the token in the JSON body with POST
+func (ah *AuthenticationHandler) VerifyEmail(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Email Verification")
+	request := emailTokenRequest{Token: r.URL.Query().Get("token")}
+	if r.Method == http.MethodPost {
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			ah.l.Println("[ERROR] deserializing the email verification request", err)
+			http.Error(rw, "Error reading the email verification request", http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Token == "" {
+		http.Error(rw, "Error the verification token is required", http.StatusBadRequest)
+		return
+	}
+	err := ah.authService.VerifyEmail(request.Token)
+	if err != nil {
+		ah.l.Printf("[ERROR] verifying the email has %s error", err)
+		httpError(rw, "Unable to verify the email", err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("Email successfully verified"))
+}
+
+// ResendVerificationEmail mails another verification link, the response doesn't reveal whether
+// the user exists
+func (ah *AuthenticationHandler) ResendVerificationEmail(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Verification Email Resending")
+	request := emailTokenRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Email == "" {
+		ah.l.Println("[ERROR] deserializing the verification email request", err)
+		http.Error(rw, "Error reading the verification email request", http.StatusBadRequest)
+		return
+	}
+	err = ah.authService.SendVerificationEmail(request.Email)
+	if err != nil {
+		ah.l.Printf("[ERROR] sending the verification email has %s error", err)
+		httpError(rw, "Unable to send the verification email", err)
+		return
+	}
+	rw.WriteHeader(http.StatusAccepted)
+	rw.Write([]byte("A verification email is sent if the account exists and isn't verified"))
+}
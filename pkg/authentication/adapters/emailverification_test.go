@@ -0,0 +1,39 @@
+package adapters
+
+import (
+	"fmt"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEmailVerificationOverREST(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	notifier := &testutil.Notifier{}
+	authService.SetNotifier(notifier)
+	viper.Set("EmailVerificationRequired", "true")
+	t.Cleanup(func() { viper.Set("EmailVerificationRequired", "") })
+	router := NewRouter(NewHandler(authService, logger))
+	body := fmt.Sprintf(`{"email": %q, "password": %q}`, testutil.TestEmail, testutil.TestPassword)
+	assert.Equal(t, http.StatusCreated, postJSON(router, "/signup", "", body).Code)
+	assert.Equal(t, http.StatusForbidden, postJSON(router, "/login", "", body).Code)
+
+	rw := postJSON(router, "/verify-email/resend", "", `{"email": "missing@test.com"}`)
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+	assert.Len(t, notifier.Messages, 1)
+	rw = postJSON(router, "/verify-email/resend", "", fmt.Sprintf(`{"email": %q}`, testutil.TestEmail))
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+	assert.Len(t, notifier.Messages, 2)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/verify-email", "", `{}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/verify-email", "", `{"token": "invalid"}`).Code)
+	rw = httptest.NewRecorder()
+	path := "/verify-email?token=" + url.QueryEscape(notifier.LastToken(t, testutil.TestEmail))
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotEmpty(t, login(t, router).AccessToken)
+}
@@ -0,0 +1,95 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/pkg/errors"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// errorMapping is how every gateway reports an error of the authentication service
+type errorMapping struct {
+	err         error
+	httpStatus  int
+	grpcCode    codes.Code
+	graphqlCode string
+}
+
+var errorMappings = []errorMapping{
+	{authentication.ErrInvalidEmail, http.StatusBadRequest, codes.InvalidArgument, "INVALID_EMAIL"},
+	{authentication.ErrWeakPassword, http.StatusUnprocessableEntity, codes.InvalidArgument, "WEAK_PASSWORD"},
+	{authentication.ErrUserExists, http.StatusConflict, codes.AlreadyExists, "USER_EXISTS"},
+	{authentication.ErrUserNotFound, http.StatusNotFound, codes.NotFound, "USER_NOT_FOUND"},
+	{authentication.ErrInvalidCredentials, http.StatusUnauthorized, codes.Unauthenticated, "INVALID_CREDENTIALS"},
+	{authentication.ErrInvalidToken, http.StatusUnauthorized, codes.Unauthenticated, "INVALID_TOKEN"},
+	{authentication.ErrTokenExpired, http.StatusUnauthorized, codes.Unauthenticated, "TOKEN_EXPIRED"},
+	{authentication.ErrTokenRevoked, http.StatusUnauthorized, codes.Unauthenticated, "TOKEN_REVOKED"},
+	{authentication.ErrTokenReused, http.StatusUnauthorized, codes.Unauthenticated, "TOKEN_REUSED"},
+	{authentication.ErrInsufficientScope, http.StatusForbidden, codes.PermissionDenied, "INSUFFICIENT_SCOPE"},
+	{authentication.ErrInvalidMFACode, http.StatusUnauthorized, codes.Unauthenticated, "INVALID_MFA_CODE"},
+	{authentication.ErrTooManyMFAAttempts, http.StatusTooManyRequests, codes.ResourceExhausted, "TOO_MANY_MFA_ATTEMPTS"},
+	{authentication.ErrMFAEnabled, http.StatusConflict, codes.FailedPrecondition, "MFA_ENABLED"},
+	{authentication.ErrMFANotEnabled, http.StatusConflict, codes.FailedPrecondition, "MFA_NOT_ENABLED"},
+	{authentication.ErrInvalidWebAuthnResponse, http.StatusBadRequest, codes.InvalidArgument, "INVALID_WEBAUTHN_RESPONSE"},
+	{authentication.ErrEmailNotVerified, http.StatusForbidden, codes.PermissionDenied, "EMAIL_NOT_VERIFIED"},
+}
+
+var internalErrorMapping = errorMapping{
+	errors.New("Internal server error"), http.StatusInternalServerError, codes.Internal, "INTERNAL_SERVER_ERROR",
+}
+
+func mapError(err error) errorMapping {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping
+		}
+	}
+	return internalErrorMapping
+}
+
+// httpError writes the message with the status of the error, only the message of the sentinel
+// error is exposed to the client
+func httpError(rw http.ResponseWriter, message string, err error) {
+	mapping := mapError(err)
+	http.Error(rw, fmt.Sprintf("%s: %s", message, mapping.err), mapping.httpStatus)
+}
+
+// oauthGrpcCodes are the gRPC codes of the OAuth errors, the unlisted ones are invalid arguments
+var oauthGrpcCodes = map[string]codes.Code{
+	"invalid_client":      codes.Unauthenticated,
+	"unauthorized_client": codes.PermissionDenied,
+	"server_error":        codes.Internal,
+}
+
+// grpcError returns the status of the error with the given format, the error is its last argument
+func grpcError(err error, format string) error {
+	oauthErr := &authentication.OAuthError{}
+	if errors.As(err, &oauthErr) {
+		code, ok := oauthGrpcCodes[oauthErr.Code]
+		if !ok {
+			code = codes.InvalidArgument
+		}
+		return status.Newf(code, format, err).Err()
+	}
+	return status.Newf(mapError(err).grpcCode, format, err).Err()
+}
+
+// graphqlErrorPresenter adds the code of the errors of the authentication service to the
+// extensions of the GraphQL errors
+func graphqlErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	mapping := mapError(err)
+	if mapping.err == internalErrorMapping.err {
+		return gqlErr
+	}
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]interface{}{}
+	}
+	gqlErr.Extensions["code"] = mapping.graphqlCode
+	return gqlErr
+}
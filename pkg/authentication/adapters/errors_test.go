@@ -0,0 +1,94 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/99designs/gqlgen/client"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRESTErrorStatuses(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	router := NewRouter(NewHandler(authService, logger))
+	post := func(path, email, password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email": %q, "password": %q}`, email, password)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rw
+	}
+
+	assert.Equal(t, http.StatusCreated, post("/signup", testutil.TestEmail, testutil.TestPassword).Code)
+	rw := post("/signup", testutil.TestEmail, testutil.TestPassword)
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Contains(t, rw.Body.String(), "The user already exists")
+	assert.Equal(t, http.StatusUnprocessableEntity, post("/signup", "weak@test.com", "password").Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/login", testutil.TestEmail, "wrong_Password123").Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/login", "missing@test.com", testutil.TestPassword).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(router, "Bearer invalid").Code)
+}
+
+func TestGrpcErrorCodes(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	server := NewAuthServer(authService, logger)
+	ctx := context.Background()
+
+	_, err := server.SignUp(ctx, &protos.SignUpRequest{Email: testutil.TestEmail, Password: testutil.TestPassword})
+	assert.Nil(t, err)
+	_, err = server.SignUp(ctx, &protos.SignUpRequest{Email: testutil.TestEmail, Password: testutil.TestPassword})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = server.SignUp(ctx, &protos.SignUpRequest{Email: "weak@test.com", Password: "password"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.Login(ctx, &protos.LoginRequest{Email: testutil.TestEmail, Password: "wrong_Password123"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = server.RefreshToken(ctx, &protos.RefreshTokenRequest{RefreshToken: "invalid"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGraphQLErrorCodes(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	c := client.New(NewGraphQLHandler(&Resolver{AuthService: authService, Logger: logger}))
+	signUp := func(email, password string) string {
+		var resp struct{ SignUp string }
+		err := c.Post(`mutation($email: String!, $password: String!) {
+			signUp(input: {email: $email, password: $password})
+		}`, &resp, client.Var("email", email), client.Var("password", password))
+		return errorCode(t, err)
+	}
+
+	assert.Equal(t, "", signUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Equal(t, "USER_EXISTS", signUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Equal(t, "WEAK_PASSWORD", signUp("weak@test.com", "password"))
+
+	var loginResp struct{ Login graphqlTokens }
+	err := c.Post(`mutation { login(input: {email: "test@test.com", password: "wrong_Password123"}) { access } }`, &loginResp)
+	assert.Equal(t, "INVALID_CREDENTIALS", errorCode(t, err))
+
+	var meResp struct{ Me struct{ Email string } }
+	err = c.Post(`query { me { email } }`, &meResp)
+	assert.Equal(t, "INVALID_TOKEN", errorCode(t, err))
+}
+
+// errorCode returns the code in the extensions of the first GraphQL error
+func errorCode(t *testing.T, err error) string {
+	if err == nil {
+		return ""
+	}
+	var gqlErrors []struct {
+		Extensions map[string]interface{}
+	}
+	assert.Nil(t, json.Unmarshal([]byte(err.Error()), &gqlErrors))
+	if len(gqlErrors) == 0 {
+		return ""
+	}
+	code, _ := gqlErrors[0].Extensions["code"].(string)
+	return code
+}
@@ -2,9 +2,45 @@
 
 package model
 
+import (
+	"time"
+)
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+type Session struct {
+	ID        string    `json:"id"`
+	FamilyID  string    `json:"familyId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type TokenClaims struct {
+	Email     string    `json:"email"`
+	TokenType string    `json:"tokenType"`
+	Issuer    string    `json:"issuer"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Scope     string    `json:"scope"`
+	Audience  *string   `json:"audience"`
+	ClientID  *string   `json:"clientId"`
+	Act       []string  `json:"act"`
+}
+
 type Tokens struct {
-	Access  string `json:"access"`
-	Refresh string `json:"refresh"`
+	Access   *string `json:"access"`
+	Refresh  *string `json:"refresh"`
+	IDToken  *string `json:"idToken"`
+	MfaToken *string `json:"mfaToken"`
+}
+
+type User struct {
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 type UserInput struct {
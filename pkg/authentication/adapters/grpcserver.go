@@ -34,12 +34,7 @@ func (ass *AuthServiceServer) SignUp(ctx context.Context, req *protos.SignUpRequ
 	}
 	err = ass.authService.SignUp(user.Email, user.Password)
 	if err != nil {
-		grpcErr := status.Newf(
-			codes.Internal,
-			"Error get %s error when trying to sign up the user",
-			err,
-		)
-		return nil, grpcErr.Err()
+		return nil, grpcError(err, "Error get %s error when trying to sign up the user")
 	}
 	return &protos.SignUpResponse{Status: int64(codes.OK)}, nil
 }
@@ -57,16 +52,203 @@ func (ass *AuthServiceServer) Login(ctx context.Context, req *protos.LoginReques
 	}
 	tokens, err := ass.authService.SignIn(user.Email, user.Password)
 	if err != nil {
-		grpcErr := status.Newf(
-			codes.Internal,
-			"Error get %s error when trying to login the user",
-			err,
-		)
-		return nil, grpcErr.Err()
+		return nil, grpcError(err, "Error get %s error when trying to login the user")
 	}
 	return &protos.LoginResponse{
 		Status:       int64(codes.OK),
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+		MfaToken:     tokens.MFAToken,
+	}, nil
+}
+
+// VerifyMFA is the second step of logging in the user who has MFA enabled
+func (ass *AuthServiceServer) VerifyMFA(ctx context.Context, req *protos.VerifyMFARequest) (*protos.VerifyMFAResponse, error) {
+	ass.l.Println("Handle Verify MFA of the User In Grpc Server")
+	tokens, err := ass.authService.VerifyMFA(req.MfaToken, req.Code)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to verify MFA of the user")
+	}
+	return &protos.VerifyMFAResponse{
+		Status:       int64(codes.OK),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+	}, nil
+}
+
+func (ass *AuthServiceServer) EnrollMFA(ctx context.Context, req *protos.EnrollMFARequest) (*protos.EnrollMFAResponse, error) {
+	ass.l.Println("Handle Enroll MFA of the User In Grpc Server")
+	claims, err := ass.authService.ValidateFirstPartyAccessToken(req.AccessToken)
+	if err != nil {
+		return nil, grpcError(err, "Error access token isn't valid due to %s")
+	}
+	enrollment, err := ass.authService.EnrollMFA(claims.Data.UserEmail)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to enroll MFA of the user")
+	}
+	return &protos.EnrollMFAResponse{
+		Status: int64(codes.OK),
+		Secret: enrollment.Secret,
+		Uri:    enrollment.URI,
+		QrCode: enrollment.QRCode,
+	}, nil
+}
+
+func (ass *AuthServiceServer) ConfirmMFA(ctx context.Context, req *protos.ConfirmMFARequest) (*protos.ConfirmMFAResponse, error) {
+	ass.l.Println("Handle Confirm MFA of the User In Grpc Server")
+	claims, err := ass.authService.ValidateFirstPartyAccessToken(req.AccessToken)
+	if err != nil {
+		return nil, grpcError(err, "Error access token isn't valid due to %s")
+	}
+	recoveryCodes, err := ass.authService.ConfirmMFA(claims.Data.UserEmail, req.Code)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to confirm MFA of the user")
+	}
+	return &protos.ConfirmMFAResponse{Status: int64(codes.OK), RecoveryCodes: recoveryCodes}, nil
+}
+
+func (ass *AuthServiceServer) DisableMFA(ctx context.Context, req *protos.DisableMFARequest) (*protos.DisableMFAResponse, error) {
+	ass.l.Println("Handle Disable MFA of the User In Grpc Server")
+	claims, err := ass.authService.ValidateFirstPartyAccessToken(req.AccessToken)
+	if err != nil {
+		return nil, grpcError(err, "Error access token isn't valid due to %s")
+	}
+	err = ass.authService.DisableMFA(claims.Data.UserEmail, req.Code)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to disable MFA of the user")
+	}
+	return &protos.DisableMFAResponse{Status: int64(codes.OK)}, nil
+}
+
+func (ass *AuthServiceServer) ChangePassword(ctx context.Context, req *protos.ChangePasswordRequest) (*protos.ChangePasswordResponse, error) {
+	ass.l.Println("Handle Change Password of the User In Grpc Server")
+	claims, err := ass.authService.ValidateFirstPartyAccessToken(req.AccessToken)
+	if err != nil {
+		return nil, grpcError(err, "Error access token isn't valid due to %s")
+	}
+	err = ass.authService.ChangePassword(claims.Data.UserEmail, req.OldPassword, req.NewPassword, req.LogoutAll, claims.SessionID)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to change the password of the user")
+	}
+	return &protos.ChangePasswordResponse{Status: int64(codes.OK)}, nil
+}
+
+func (ass *AuthServiceServer) Logout(ctx context.Context, req *protos.LogoutRequest) (*protos.LogoutResponse, error) {
+	ass.l.Println("Handle Logout of the User In Grpc Server")
+	err := ass.authService.Logout(req.RefreshToken)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to logout the user")
+	}
+	return &protos.LogoutResponse{Status: int64(codes.OK)}, nil
+}
+
+func (ass *AuthServiceServer) LogoutAll(ctx context.Context, req *protos.LogoutAllRequest) (*protos.LogoutAllResponse, error) {
+	ass.l.Println("Handle Logout Everywhere of the User In Grpc Server")
+	user, err := ass.authService.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		return nil, grpcError(err, "Error refresh token isn't valid due to %s")
+	}
+	err = ass.authService.LogoutAll(user.Email)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to logout the user everywhere")
+	}
+	return &protos.LogoutAllResponse{Status: int64(codes.OK)}, nil
+}
+
+func (ass *AuthServiceServer) RefreshToken(ctx context.Context, req *protos.RefreshTokenRequest) (*protos.RefreshTokenResponse, error) {
+	ass.l.Println("Handle Refresh Token of the User In Grpc Server")
+	tokens, err := ass.authService.RefreshAccessToken(req.RefreshToken)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to refresh the access token")
+	}
+	return &protos.RefreshTokenResponse{
+		Status:       int64(codes.OK),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IDToken,
+	}, nil
+}
+
+func (ass *AuthServiceServer) ValidateAccessToken(ctx context.Context, req *protos.ValidateAccessTokenRequest) (*protos.ValidateAccessTokenResponse, error) {
+	ass.l.Println("Handle Validate Access Token In Grpc Server")
+	claims, err := ass.authService.ValidateAccessTokenFor(req.AccessToken, authentication.AccessTokenRequirements{
+		Audience: req.Audience,
+		Scope:    req.Scope,
+		ClientID: req.ClientId,
+	})
+	if err != nil {
+		return nil, grpcError(err, "Error access token isn't valid due to %s")
+	}
+	return &protos.ValidateAccessTokenResponse{
+		Status: int64(codes.OK),
+		Claims: &protos.AccessTokenClaims{
+			Email:     claims.Data.UserEmail,
+			TokenType: claims.Data.TokenType,
+			Issuer:    claims.Issuer,
+			ExpiresAt: claims.ExpiresAt,
+			Scope:     claims.Scope,
+			Audience:  claims.Audience,
+			ClientId:  claims.ClientID,
+			Act:       claims.Act.Subjects(),
+		},
+	}, nil
+}
+
+func (ass *AuthServiceServer) GetCurrentUser(ctx context.Context, req *protos.GetCurrentUserRequest) (*protos.GetCurrentUserResponse, error) {
+	ass.l.Println("Handle Get Current User In Grpc Server")
+	claims, err := ass.authService.ValidateFirstPartyAccessToken(req.AccessToken)
+	if err != nil {
+		return nil, grpcError(err, "Error access token isn't valid due to %s")
+	}
+	user, err := ass.authService.GetUser(claims.Data.UserEmail)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to get the current user")
+	}
+	return &protos.GetCurrentUserResponse{
+		Status: int64(codes.OK),
+		User: &protos.User{
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt.Unix(),
+			UpdatedAt: user.UpdatedAt.Unix(),
+		},
+	}, nil
+}
+
+func (ass *AuthServiceServer) GetJWKS(ctx context.Context, req *protos.GetJWKSRequest) (*protos.GetJWKSResponse, error) {
+	ass.l.Println("Handle Get JWKS In Grpc Server")
+	keySet, err := ass.authService.GetJWKS()
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to get the JWKS")
+	}
+	keys := make([]*protos.JSONWebKey, 0, len(keySet.Keys))
+	for _, key := range keySet.Keys {
+		keys = append(keys, &protos.JSONWebKey{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Alg: key.Alg,
+			Use: key.Use,
+			N:   key.N,
+			E:   key.E,
+		})
+	}
+	return &protos.GetJWKSResponse{Status: int64(codes.OK), Keys: keys}, nil
+}
+
+// ClientCredentials is the client credentials grant of the token endpoint for the services which
+// use gRPC
+func (ass *AuthServiceServer) ClientCredentials(ctx context.Context, req *protos.ClientCredentialsRequest) (*protos.ClientCredentialsResponse, error) {
+	ass.l.Println("Handle Client Credentials In Grpc Server")
+	tokens, err := ass.authService.ClientCredentials(req.ClientId, req.ClientSecret, req.Scope)
+	if err != nil {
+		return nil, grpcError(err, "Error get %s error when trying to issue the client token")
+	}
+	return &protos.ClientCredentialsResponse{
+		Status:      int64(codes.OK),
+		AccessToken: tokens.AccessToken,
+		TokenType:   tokens.TokenType,
+		ExpiresIn:   tokens.ExpiresIn,
+		Scope:       tokens.Scope,
 	}, nil
 }
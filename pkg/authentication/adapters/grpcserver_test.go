@@ -0,0 +1,121 @@
+package adapters
+
+import (
+	"context"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+func initializeGrpcClient(t *testing.T) protos.AuthServiceClient {
+	authService, logger := initializeSignedUpAuthService(t)
+
+	listener := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	protos.RegisterAuthServiceServer(gs, NewAuthServer(authService, logger))
+	go gs.Serve(listener)
+	t.Cleanup(gs.Stop)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return protos.NewAuthServiceClient(conn)
+}
+
+func grpcLogin(t *testing.T, client protos.AuthServiceClient) *protos.LoginResponse {
+	res, err := client.Login(context.Background(), &protos.LoginRequest{
+		Email:    testutil.TestEmail,
+		Password: testutil.TestPassword,
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.IdToken)
+	return res
+}
+
+func TestGrpcRefreshToken(t *testing.T) {
+	client := initializeGrpcClient(t)
+	tokens := grpcLogin(t, client)
+	ctx := context.Background()
+
+	res, err := client.RefreshToken(ctx, &protos.RefreshTokenRequest{RefreshToken: tokens.RefreshToken})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.AccessToken)
+	assert.NotEqual(t, tokens.RefreshToken, res.RefreshToken)
+
+	_, err = client.RefreshToken(ctx, &protos.RefreshTokenRequest{RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGrpcValidateAccessToken(t *testing.T) {
+	client := initializeGrpcClient(t)
+	tokens := grpcLogin(t, client)
+	ctx := context.Background()
+
+	res, err := client.ValidateAccessToken(ctx, &protos.ValidateAccessTokenRequest{AccessToken: tokens.AccessToken})
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, res.Claims.Email)
+	assert.Equal(t, "access", res.Claims.TokenType)
+	assert.NotZero(t, res.Claims.ExpiresAt)
+	assert.Equal(t, "openid email", res.Claims.Scope)
+	assert.Equal(t, res.Claims.Issuer, res.Claims.Audience)
+	assert.Empty(t, res.Claims.ClientId)
+	assert.Empty(t, res.Claims.Act)
+
+	_, err = client.ValidateAccessToken(ctx, &protos.ValidateAccessTokenRequest{AccessToken: tokens.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the requirements of the resource server are checked
+	_, err = client.ValidateAccessToken(ctx, &protos.ValidateAccessTokenRequest{AccessToken: tokens.AccessToken, Audience: res.Claims.Audience, Scope: "email"})
+	assert.Nil(t, err)
+	_, err = client.ValidateAccessToken(ctx, &protos.ValidateAccessTokenRequest{AccessToken: tokens.AccessToken, Audience: "billing"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ValidateAccessToken(ctx, &protos.ValidateAccessTokenRequest{AccessToken: tokens.AccessToken, Scope: "jobs:read"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.ValidateAccessToken(ctx, &protos.ValidateAccessTokenRequest{AccessToken: tokens.AccessToken, ClientId: "jobs"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGrpcGetCurrentUser(t *testing.T) {
+	client := initializeGrpcClient(t)
+	tokens := grpcLogin(t, client)
+	ctx := context.Background()
+
+	res, err := client.GetCurrentUser(ctx, &protos.GetCurrentUserRequest{AccessToken: tokens.AccessToken})
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, res.User.Email)
+
+	_, err = client.GetCurrentUser(ctx, &protos.GetCurrentUserRequest{AccessToken: "invalid"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGrpcLogout(t *testing.T) {
+	client := initializeGrpcClient(t)
+	tokens := grpcLogin(t, client)
+	ctx := context.Background()
+
+	_, err := client.Logout(ctx, &protos.LogoutRequest{RefreshToken: tokens.RefreshToken})
+	assert.Nil(t, err)
+	_, err = client.RefreshToken(ctx, &protos.RefreshTokenRequest{RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGrpcGetJWKS(t *testing.T) {
+	client := initializeGrpcClient(t)
+	grpcLogin(t, client)
+
+	res, err := client.GetJWKS(context.Background(), &protos.GetJWKSRequest{})
+	assert.Nil(t, err)
+	if assert.Len(t, res.Keys, 1) {
+		assert.NotEmpty(t, res.Keys[0].Kid)
+		assert.Equal(t, "RSA", res.Keys[0].Kty)
+		assert.NotEmpty(t, res.Keys[0].N)
+		assert.Equal(t, "AQAB", res.Keys[0].E)
+	}
+}
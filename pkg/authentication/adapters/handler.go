@@ -22,6 +22,8 @@ func NewHandler(authService *authentication.AuthenticationService, l *log.Logger
 
 type keyUser struct{}
 
+type keyRefreshToken struct{}
+
 func (ah *AuthenticationHandler) MiddlewareValidateUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		user := entity.User{}
@@ -55,7 +57,6 @@ func (ah *AuthenticationHandler) MiddlewareValidateRefreshToken(next http.Handle
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		authContent := strings.Split(authHeader, " ")
-		token := authContent[1]
 		if len(authContent) != 2 {
 			ah.l.Println("[ERROR] Authorization token not provided or malformed")
 			http.Error(
@@ -65,29 +66,48 @@ func (ah *AuthenticationHandler) MiddlewareValidateRefreshToken(next http.Handle
 			)
 			return
 		}
+		token := authContent[1]
 		user, err := ah.authService.ValidateRefreshToken(token)
-		if user == (entity.User{}) || err != nil {
+		if user.Email == "" || err != nil {
 			ah.l.Println("[ERROR] Refresh token isn't valid")
-			http.Error(
-				rw,
-				fmt.Sprintf("Error refresh token isn't valid due to %s", err),
-				http.StatusUnauthorized,
-			)
+			httpError(rw, "Error refresh token isn't valid", err)
 			return
 		}
 		ctx := context.WithValue(r.Context(), keyUser{}, user)
+		ctx = context.WithValue(ctx, keyRefreshToken{}, token)
 		r = r.WithContext(ctx)
 		next.ServeHTTP(rw, r)
 	})
 }
 
+// MiddlewareValidateAccessToken validates the bearer first party access token of the request and
+// puts its claims into the context
+func (ah *AuthenticationHandler) MiddlewareValidateAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		authContent := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(authContent) != 2 || authContent[0] != "Bearer" {
+			ah.l.Println("[ERROR] Authorization token not provided or malformed")
+			http.Error(rw, "Error authorization token not provided or malformed", http.StatusUnauthorized)
+			return
+		}
+		claims, err := ah.authService.ValidateFirstPartyAccessToken(authContent[1])
+		if err != nil {
+			ah.l.Println("[ERROR] Access token isn't valid")
+			httpError(rw, "Error access token isn't valid", err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), keyAccessTokenClaims{}, claims)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
 func (ah *AuthenticationHandler) UserSignUp(rw http.ResponseWriter, r *http.Request) {
 	ah.l.Println("Handle Sign up of User")
 	user := r.Context().Value(keyUser{}).(entity.User)
 	err := ah.authService.SignUp(user.Email, user.Password)
 	if err != nil {
 		ah.l.Printf("[ERROR] signing up user has %s error", err)
-		http.Error(rw, "Unable to signing up the user", http.StatusBadRequest)
+		httpError(rw, "Unable to signing up the user", err)
 		return
 	}
 	rw.WriteHeader(http.StatusCreated)
@@ -100,7 +120,7 @@ func (ah *AuthenticationHandler) UserLogin(rw http.ResponseWriter, r *http.Reque
 	tokens, err := ah.authService.SignIn(user.Email, user.Password)
 	if err != nil {
 		ah.l.Printf("[ERROR] login user has %s error", err)
-		http.Error(rw, "Unable to signing in the user", http.StatusBadRequest)
+		httpError(rw, "Unable to signing in the user", err)
 		return
 	}
 	jsonResponse, err := json.Marshal(tokens)
@@ -112,3 +132,111 @@ func (ah *AuthenticationHandler) UserLogin(rw http.ResponseWriter, r *http.Reque
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(jsonResponse)
 }
+
+func (ah *AuthenticationHandler) UserLogout(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle User Logout")
+	refreshToken := r.Context().Value(keyRefreshToken{}).(string)
+	err := ah.authService.Logout(refreshToken)
+	if err != nil {
+		ah.l.Printf("[ERROR] logout user has %s error", err)
+		httpError(rw, "Unable to logout the user", err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("User successfully logged out"))
+}
+
+func (ah *AuthenticationHandler) UserLogoutAll(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle User Logout Everywhere")
+	user := r.Context().Value(keyUser{}).(entity.User)
+	err := ah.authService.LogoutAll(user.Email)
+	if err != nil {
+		ah.l.Printf("[ERROR] logout user everywhere has %s error", err)
+		httpError(rw, "Unable to logout the user everywhere", err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("User successfully logged out everywhere"))
+}
+
+func (ah *AuthenticationHandler) UserRefresh(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle User Refresh Token")
+	refreshToken := r.Context().Value(keyRefreshToken{}).(string)
+	tokens, err := ah.authService.RefreshAccessToken(refreshToken)
+	if err != nil {
+		ah.l.Printf("[ERROR] refreshing the access token has %s error", err)
+		httpError(rw, "Unable to refresh the access token", err)
+		return
+	}
+	jsonResponse, err := json.Marshal(tokens)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to refresh the access token", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+func (ah *AuthenticationHandler) JWKS(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle JWKS")
+	keySet, err := ah.authService.GetJWKS()
+	if err != nil {
+		ah.l.Printf("[ERROR] getting the JWKS has %s error", err)
+		httpError(rw, "Unable to get the JWKS", err)
+		return
+	}
+	jsonResponse, err := json.Marshal(keySet)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to get the JWKS", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+func (ah *AuthenticationHandler) OpenIDConfiguration(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle OpenID Configuration")
+	jsonResponse, err := json.Marshal(ah.authService.GetOpenIDConfiguration())
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to get the OpenID configuration", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint, the access token is sent as a bearer token
+func (ah *AuthenticationHandler) UserInfo(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle User Info")
+	authContent := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(authContent) != 2 || authContent[0] != "Bearer" {
+		ah.l.Println("[ERROR] Authorization token not provided or malformed")
+		rw.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(rw, "Error authorization token not provided or malformed", http.StatusUnauthorized)
+		return
+	}
+	userInfo, err := ah.authService.GetUserInfo(authContent[1])
+	if err != nil {
+		ah.l.Printf("[ERROR] getting the user info has %s error", err)
+		if mapError(err).httpStatus == http.StatusUnauthorized {
+			rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		httpError(rw, "Unable to get the user info", err)
+		return
+	}
+	jsonResponse, err := json.Marshal(userInfo)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to get the user info", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
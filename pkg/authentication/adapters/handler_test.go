@@ -0,0 +1,158 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// initializeRouter creates the REST router on the memory database with the test user signed up
+func initializeRouter(t *testing.T) (http.Handler, *authentication.AuthenticationService) {
+	authService, logger := initializeSignedUpAuthService(t)
+	return NewRouter(NewHandler(authService, logger)), authService
+}
+
+func login(t *testing.T, router http.Handler) entity.Tokens {
+	body := fmt.Sprintf(`{"email": %q, "password": %q}`, testutil.TestEmail, testutil.TestPassword)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var tokens entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&tokens))
+	return tokens
+}
+
+func refresh(router http.Handler, authorization string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestRefreshReturnsRotatedTokens(t *testing.T) {
+	router, _ := initializeRouter(t)
+	tokens := login(t, router)
+
+	rw := refresh(router, "Bearer "+tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	var refreshed entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&refreshed))
+	assert.NotEmpty(t, refreshed.AccessToken)
+	assert.NotEmpty(t, refreshed.RefreshToken)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	rw = refresh(router, "Bearer "+refreshed.RefreshToken)
+	assert.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestRefreshWithReplayedTokenIsUnauthorized(t *testing.T) {
+	router, _ := initializeRouter(t)
+	tokens := login(t, router)
+	rw := refresh(router, "Bearer "+tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var refreshed entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&refreshed))
+
+	rw = refresh(router, "Bearer "+tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	rw = refresh(router, "Bearer "+refreshed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestRefreshWithoutTokenIsUnauthorized(t *testing.T) {
+	router, _ := initializeRouter(t)
+	rw := refresh(router, "")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	rw = refresh(router, "Bearer")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestRefreshWithAccessTokenIsUnauthorized(t *testing.T) {
+	router, _ := initializeRouter(t)
+	tokens := login(t, router)
+	rw := refresh(router, "Bearer "+tokens.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestRefreshAfterLogoutIsUnauthorized(t *testing.T) {
+	router, _ := initializeRouter(t)
+	tokens := login(t, router)
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens.RefreshToken)
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = refresh(router, "Bearer "+tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestJWKS(t *testing.T) {
+	router, _ := initializeRouter(t)
+	tokens := login(t, router)
+	token, _, err := new(jwt.Parser).ParseUnverified(tokens.AccessToken, jwt.MapClaims{})
+	assert.Nil(t, err)
+
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	var keySet authentication.JSONWebKeySet
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&keySet))
+	if assert.Len(t, keySet.Keys, 1) {
+		assert.Equal(t, token.Header["kid"], keySet.Keys[0].Kid)
+		assert.Equal(t, "RS256", keySet.Keys[0].Alg)
+		assert.Equal(t, "sig", keySet.Keys[0].Use)
+	}
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	router, _ := initializeRouter(t)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var configuration map[string]interface{}
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&configuration))
+	assert.NotEmpty(t, configuration["issuer"])
+	assert.NotEmpty(t, configuration["jwks_uri"])
+	assert.NotEmpty(t, configuration["userinfo_endpoint"])
+}
+
+func TestUserInfo(t *testing.T) {
+	router, authService := initializeRouter(t)
+	tokens := login(t, router)
+	assert.NotEmpty(t, tokens.IDToken)
+	user, err := authService.GetUser(testutil.TestEmail)
+	assert.Nil(t, err)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/userinfo", nil)
+		r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		router.ServeHTTP(rw, r)
+		assert.Equal(t, http.StatusOK, rw.Code)
+		var userInfo authentication.UserInfo
+		assert.Nil(t, json.NewDecoder(rw.Body).Decode(&userInfo))
+		assert.Equal(t, user.ID, userInfo.Subject)
+		assert.Equal(t, testutil.TestEmail, userInfo.Email)
+	}
+
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens.RefreshToken)
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, rw.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,105 @@
+package adapters
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// mfaRequest is the body of the MFA endpoints, the MFA token is only sent to verify signing in
+type mfaRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (ah *AuthenticationHandler) readMFARequest(rw http.ResponseWriter, r *http.Request) (mfaRequest, bool) {
+	request := mfaRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Code == "" {
+		ah.l.Println("[ERROR] deserializing the MFA request", err)
+		http.Error(rw, "Error reading the MFA request", http.StatusBadRequest)
+		return request, false
+	}
+	return request, true
+}
+
+func (ah *AuthenticationHandler) writeJSON(rw http.ResponseWriter, message string, response interface{}) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, message, http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+// EnrollMFA returns a new TOTP secret of the user with its otpauth URI and QR code
+func (ah *AuthenticationHandler) EnrollMFA(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle MFA Enrollment")
+	claims := accessTokenClaims(r.Context())
+	enrollment, err := ah.authService.EnrollMFA(claims.Data.UserEmail)
+	if err != nil {
+		ah.l.Printf("[ERROR] enrolling MFA has %s error", err)
+		httpError(rw, "Unable to enroll MFA", err)
+		return
+	}
+	ah.writeJSON(rw, "Unable to enroll MFA", enrollment)
+}
+
+// ConfirmMFA enables MFA with the first code of the authenticator app and returns the recovery codes
+func (ah *AuthenticationHandler) ConfirmMFA(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle MFA Confirmation")
+	request, ok := ah.readMFARequest(rw, r)
+	if !ok {
+		return
+	}
+	claims := accessTokenClaims(r.Context())
+	recoveryCodes, err := ah.authService.ConfirmMFA(claims.Data.UserEmail, request.Code)
+	if err != nil {
+		ah.l.Printf("[ERROR] confirming MFA has %s error", err)
+		httpError(rw, "Unable to confirm MFA", err)
+		return
+	}
+	ah.writeJSON(rw, "Unable to confirm MFA", recoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// DisableMFA turns off MFA of the user with a TOTP or recovery code
+func (ah *AuthenticationHandler) DisableMFA(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle MFA Disabling")
+	request, ok := ah.readMFARequest(rw, r)
+	if !ok {
+		return
+	}
+	claims := accessTokenClaims(r.Context())
+	err := ah.authService.DisableMFA(claims.Data.UserEmail, request.Code)
+	if err != nil {
+		ah.l.Printf("[ERROR] disabling MFA has %s error", err)
+		httpError(rw, "Unable to disable MFA", err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("MFA successfully disabled"))
+}
+
+// VerifyMFA is the second step of signing in, it exchanges the MFA token of /login and a TOTP or
+// recovery code for the tokens of the user
+func (ah *AuthenticationHandler) VerifyMFA(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle MFA Verification")
+	request, ok := ah.readMFARequest(rw, r)
+	if !ok {
+		return
+	}
+	tokens, err := ah.authService.VerifyMFA(request.MFAToken, request.Code)
+	if err != nil {
+		ah.l.Printf("[ERROR] verifying MFA has %s error", err)
+		httpError(rw, "Unable to signing in the user", err)
+		return
+	}
+	ah.writeJSON(rw, "Unable to signing in the user", tokens)
+}
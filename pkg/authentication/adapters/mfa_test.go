@@ -0,0 +1,114 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/99designs/gqlgen/client"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postJSON(router http.Handler, path, authorization, body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestMFAOverAllGateways(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	router := NewRouter(NewHandler(authService, logger))
+	tokens := login(t, router)
+
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/mfa/enroll", "", "").Code)
+	rw := postJSON(router, "/mfa/enroll", "Bearer "+tokens.AccessToken, "")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var enrollment authentication.MFAEnrollment
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&enrollment))
+	assert.NotEmpty(t, enrollment.QRCode)
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	assert.Nil(t, err)
+	rw = postJSON(router, "/mfa/confirm", "Bearer "+tokens.AccessToken, fmt.Sprintf(`{"code": %q}`, code))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var confirmed recoveryCodesResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&confirmed))
+	assert.NotEmpty(t, confirmed.RecoveryCodes)
+
+	// REST
+	challenge := login(t, router)
+	assert.Empty(t, challenge.AccessToken)
+	rw = postJSON(router, "/mfa/verify", "", fmt.Sprintf(`{"mfa_token": %q, "code": "000000"}`, challenge.MFAToken))
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	code, err = totp.GenerateCode(enrollment.Secret, time.Now().Add(30*time.Second))
+	assert.Nil(t, err)
+	rw = postJSON(router, "/mfa/verify", "", fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, challenge.MFAToken, code))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var verified entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&verified))
+	assert.NotEmpty(t, verified.AccessToken)
+
+	// gRPC
+	server := NewAuthServer(authService, logger)
+	ctx := context.Background()
+	loginResp, err := server.Login(ctx, &protos.LoginRequest{Email: testutil.TestEmail, Password: testutil.TestPassword})
+	assert.Nil(t, err)
+	assert.Empty(t, loginResp.AccessToken)
+	_, err = server.VerifyMFA(ctx, &protos.VerifyMFARequest{MfaToken: loginResp.MfaToken, Code: "000000"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	verifyResp, err := server.VerifyMFA(ctx, &protos.VerifyMFARequest{MfaToken: loginResp.MfaToken, Code: confirmed.RecoveryCodes[0]})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, verifyResp.AccessToken)
+	_, err = server.EnrollMFA(ctx, &protos.EnrollMFARequest{AccessToken: verifyResp.AccessToken})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// GraphQL
+	c := client.New(NewGraphQLHandler(&Resolver{AuthService: authService, Logger: logger}))
+	var gqlLoginResp struct {
+		Login struct {
+			Access, Refresh, IDToken *string
+			MfaToken                 string
+		}
+	}
+	err = c.Post(`mutation($email: String!, $password: String!) {
+		login(input: {email: $email, password: $password}) { access refresh idToken mfaToken }
+	}`, &gqlLoginResp, client.Var("email", testutil.TestEmail), client.Var("password", testutil.TestPassword))
+	assert.Nil(t, err)
+	// only the MFA token is issued, the other tokens are null rather than empty
+	assert.Nil(t, gqlLoginResp.Login.Access)
+	assert.Nil(t, gqlLoginResp.Login.Refresh)
+	assert.Nil(t, gqlLoginResp.Login.IDToken)
+	assert.NotEmpty(t, gqlLoginResp.Login.MfaToken)
+	var gqlVerifyResp struct {
+		VerifyMFA struct {
+			Access   string
+			MfaToken *string
+		}
+	}
+	err = c.Post(`mutation($token: String!, $code: String!) { verifyMFA(mfaToken: $token, code: $code) { access mfaToken } }`,
+		&gqlVerifyResp, client.Var("token", gqlLoginResp.Login.MfaToken), client.Var("code", confirmed.RecoveryCodes[1]))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, gqlVerifyResp.VerifyMFA.Access)
+	assert.Nil(t, gqlVerifyResp.VerifyMFA.MfaToken)
+
+	var disableResp struct{ DisableMFA string }
+	err = c.Post(`mutation($code: String!) { disableMFA(code: $code) }`, &disableResp,
+		client.Var("code", confirmed.RecoveryCodes[2]), client.AddHeader("Authorization", "Bearer "+gqlVerifyResp.VerifyMFA.Access))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, login(t, router).AccessToken)
+}
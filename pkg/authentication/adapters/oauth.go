@@ -0,0 +1,352 @@
+package adapters
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/pkg/errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// authorizePage is the login and consent page of the authorization endpoint
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.Client.Name}}</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+{{if .Client.ID}}
+<p><b>{{.Client.Name}}</b> wants to access your account{{if .Scopes}} with the following scopes:{{end}}</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<label>Email <input type="email" name="email" required></label>
+<label>Password <input type="password" name="password"></label>
+<label>Authentication code, if MFA is enabled <input type="text" name="mfa_code" autocomplete="one-time-code"></label>
+<button type="submit" name="consent" value="allow">Allow</button>
+<button type="submit" name="consent" value="deny" formnovalidate>Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type authorizePageData struct {
+	Client    entity.Client
+	Request   authentication.AuthorizationRequest
+	Scopes    []string
+	CSRFToken string
+	Error     string
+}
+
+// csrfCookie holds the random secret of the browser which the CSRF tokens of the authorize page are keyed by
+const csrfCookie = "authorize_csrf"
+
+// csrfToken binds the form of the authorize page to the browser which loaded it and to the
+// authorization request, being the MAC of the request keyed by the secret of the cookie
+func csrfToken(secret string, request authentication.AuthorizationRequest) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, value := range []string{
+		request.ResponseType, request.ClientID, request.RedirectURI, request.Scope,
+		request.State, request.Nonce, request.CodeChallenge, request.CodeChallengeMethod,
+	} {
+		mac.Write([]byte(value))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueCSRFToken returns the CSRF token of the request, setting the cookie of the secret if the
+// browser doesn't have one yet
+func issueCSRFToken(rw http.ResponseWriter, r *http.Request, request authentication.AuthorizationRequest) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return csrfToken(cookie.Value, request), nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, "generating the CSRF secret")
+	}
+	cookie := &http.Cookie{
+		Name:     csrfCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(secret),
+		Path:     "/authorize",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	}
+	http.SetCookie(rw, cookie)
+	return csrfToken(cookie.Value, request), nil
+}
+
+// validCSRFToken reports whether the posted form carries the CSRF token of the request for the
+// secret of the browser
+func validCSRFToken(r *http.Request, request authentication.AuthorizationRequest) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	expected := csrfToken(cookie.Value, request)
+	return hmac.Equal([]byte(expected), []byte(r.PostFormValue("csrf_token")))
+}
+
+func authorizationRequest(r *http.Request) authentication.AuthorizationRequest {
+	return authentication.AuthorizationRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		Nonce:               r.FormValue("nonce"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+	}
+}
+
+func (ah *AuthenticationHandler) renderAuthorizePage(rw http.ResponseWriter, status int, data authorizePageData) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	err := authorizePage.Execute(rw, data)
+	if err != nil {
+		ah.l.Printf("[ERROR] rendering the authorize page has %s error", err)
+	}
+}
+
+// redirectWithParams sends the user agent back to the redirect URI of the client with the params
+func redirectWithParams(rw http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	location, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(rw, "Error the redirect URI is malformed", http.StatusBadRequest)
+		return
+	}
+	query := location.Query()
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+	location.RawQuery = query.Encode()
+	http.Redirect(rw, r, location.String(), http.StatusFound)
+}
+
+// Authorize is the OAuth 2.0 authorization endpoint. GET shows the login and consent page of the
+// request and POST signs in the user, redirecting back to the client with the authorization code.
+func (ah *AuthenticationHandler) Authorize(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Authorize")
+	request := authorizationRequest(r)
+	// errors of the client or its redirect URI are shown to the user, never redirected
+	client, err := ah.authService.ValidateRedirect(request.ClientID, request.RedirectURI)
+	if err != nil {
+		ah.l.Printf("[ERROR] validating the authorization redirect has %s error", err)
+		ah.renderAuthorizePage(rw, http.StatusBadRequest, authorizePageData{Error: err.Error()})
+		return
+	}
+	oauthErr := &authentication.OAuthError{}
+	_, err = ah.authService.ValidateAuthorizationRequest(request)
+	if errors.As(err, &oauthErr) {
+		ah.l.Printf("[ERROR] validating the authorization request has %s error", err)
+		redirectWithParams(rw, r, request.RedirectURI, url.Values{
+			"error": {oauthErr.Code}, "error_description": {oauthErr.Description}, "state": {request.State},
+		})
+		return
+	}
+	data := authorizePageData{Client: client, Request: request, Scopes: strings.Fields(request.Scope)}
+	if r.Method == http.MethodGet || !validCSRFToken(r, request) {
+		status := http.StatusOK
+		if r.Method != http.MethodGet {
+			// the form is posted by another site or its token is for another request
+			ah.l.Println("[ERROR] the CSRF token of the authorize form is invalid")
+			status = http.StatusForbidden
+			data.Error = "The form has expired, please submit it again"
+		}
+		data.CSRFToken, err = issueCSRFToken(rw, r, request)
+		if err != nil {
+			ah.l.Printf("[ERROR] issuing the CSRF token has %s error", err)
+			http.Error(rw, "Unable to show the authorize page", http.StatusInternalServerError)
+			return
+		}
+		ah.renderAuthorizePage(rw, status, data)
+		return
+	}
+	data.CSRFToken = r.PostFormValue("csrf_token")
+
+	if r.PostFormValue("consent") != "allow" {
+		redirectWithParams(rw, r, request.RedirectURI, url.Values{
+			"error": {"access_denied"}, "error_description": {"The user denied the request"}, "state": {request.State},
+		})
+		return
+	}
+	code, err := ah.authService.Authorize(
+		request, r.PostFormValue("email"), r.PostFormValue("password"), r.PostFormValue("mfa_code"),
+	)
+	if err != nil {
+		ah.l.Printf("[ERROR] authorizing the user has %s error", err)
+		mapping := mapError(err)
+		data.Error = "Unable to signing in the user: " + mapping.err.Error()
+		ah.renderAuthorizePage(rw, mapping.httpStatus, data)
+		return
+	}
+	redirectWithParams(rw, r, request.RedirectURI, url.Values{"code": {code}, "state": {request.State}})
+}
+
+// clientCredentials reads the credentials of the client from the basic authorization header, or
+// else from the form of the request
+func clientCredentials(r *http.Request) (string, string, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostFormValue("client_id"), r.PostFormValue("client_secret"), false
+	}
+	// the credentials are form encoded before they're put in the header
+	if id, err := url.QueryUnescape(clientID); err == nil {
+		clientID = id
+	}
+	if secret, err := url.QueryUnescape(clientSecret); err == nil {
+		clientSecret = secret
+	}
+	return clientID, clientSecret, true
+}
+
+func oauthErrorResponse(rw http.ResponseWriter, err *authentication.OAuthError, basicAuth bool) {
+	status := http.StatusBadRequest
+	if err.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		if basicAuth {
+			rw.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+	}
+	jsonResponse, _ := json.Marshal(err)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(status)
+	rw.Write(jsonResponse)
+}
+
+// Token is the OAuth 2.0 token endpoint, it supports the authorization code, refresh token, client
+// credentials, device code and token exchange grants. Confidential clients authenticate with the basic authorization
+// header or with the client_secret param.
+func (ah *AuthenticationHandler) Token(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Token")
+	var tokens authentication.TokenResponse
+	var err error
+	clientID, clientSecret, basicAuth := clientCredentials(r)
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		tokens, err = ah.authService.ExchangeAuthorizationCode(
+			clientID, clientSecret, r.PostFormValue("code"), r.PostFormValue("redirect_uri"), r.PostFormValue("code_verifier"),
+		)
+	case "refresh_token":
+		tokens, err = ah.authService.RefreshClientToken(clientID, clientSecret, r.PostFormValue("refresh_token"))
+	case "client_credentials":
+		tokens, err = ah.authService.ClientCredentials(clientID, clientSecret, r.PostFormValue("scope"))
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		tokens, err = ah.authService.ExchangeDeviceCode(clientID, clientSecret, r.PostFormValue("device_code"))
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		tokens, err = ah.authService.ExchangeToken(clientID, clientSecret, authentication.TokenExchangeRequest{
+			SubjectToken:       r.PostFormValue("subject_token"),
+			SubjectTokenType:   r.PostFormValue("subject_token_type"),
+			RequestedTokenType: r.PostFormValue("requested_token_type"),
+			Audience:           r.PostFormValue("audience"),
+			Scope:              r.PostFormValue("scope"),
+		})
+	default:
+		err = &authentication.OAuthError{Code: "unsupported_grant_type", Description: "The grant type isn't supported"}
+	}
+	oauthErr := &authentication.OAuthError{}
+	if errors.As(err, &oauthErr) {
+		ah.l.Printf("[ERROR] issuing the tokens has %s error", err)
+		oauthErrorResponse(rw, oauthErr, basicAuth)
+		return
+	}
+	if err != nil {
+		ah.l.Printf("[ERROR] issuing the tokens has %s error", err)
+		oauthErrorResponse(rw, &authentication.OAuthError{Code: "server_error"}, basicAuth)
+		return
+	}
+	jsonResponse, err := json.Marshal(tokens)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to issue the tokens", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+// Introspect is the token introspection endpoint of RFC 7662 for the resource servers, which
+// authenticate as confidential clients
+func (ah *AuthenticationHandler) Introspect(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Introspect")
+	clientID, clientSecret, basicAuth := clientCredentials(r)
+	token := r.PostFormValue("token")
+	if token == "" {
+		oauthErrorResponse(rw, &authentication.OAuthError{Code: "invalid_request", Description: "The token is required"}, basicAuth)
+		return
+	}
+	response, err := ah.authService.Introspect(clientID, clientSecret, token, r.PostFormValue("token_type_hint"))
+	oauthErr := &authentication.OAuthError{}
+	if errors.As(err, &oauthErr) {
+		ah.l.Printf("[ERROR] introspecting the token has %s error", err)
+		oauthErrorResponse(rw, oauthErr, basicAuth)
+		return
+	}
+	if err != nil {
+		ah.l.Printf("[ERROR] introspecting the token has %s error", err)
+		oauthErrorResponse(rw, &authentication.OAuthError{Code: "server_error"}, basicAuth)
+		return
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		ah.l.Printf("[ERROR] happened in JSON marshal. Err: %s", err)
+		http.Error(rw, "Unable to introspect the token", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(jsonResponse)
+}
+
+// Revoke is the token revocation endpoint of RFC 7009, it succeeds for the tokens which are
+// already invalid as well
+func (ah *AuthenticationHandler) Revoke(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Revoke")
+	clientID, clientSecret, basicAuth := clientCredentials(r)
+	token := r.PostFormValue("token")
+	if token == "" {
+		oauthErrorResponse(rw, &authentication.OAuthError{Code: "invalid_request", Description: "The token is required"}, basicAuth)
+		return
+	}
+	err := ah.authService.Revoke(clientID, clientSecret, token, r.PostFormValue("token_type_hint"))
+	oauthErr := &authentication.OAuthError{}
+	if errors.As(err, &oauthErr) {
+		ah.l.Printf("[ERROR] revoking the token has %s error", err)
+		oauthErrorResponse(rw, oauthErr, basicAuth)
+		return
+	}
+	if err != nil {
+		ah.l.Printf("[ERROR] revoking the token has %s error", err)
+		oauthErrorResponse(rw, &authentication.OAuthError{Code: "server_error"}, basicAuth)
+		return
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,346 @@
+package adapters
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const (
+	testRedirectURI  = "https://client.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func initializeOAuthRouter(t *testing.T) http.Handler {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "client", Name: "Test App", RedirectURIs: []string{testRedirectURI}}, ""))
+	return NewRouter(NewHandler(authService, logger))
+}
+
+func authorizeParams() url.Values {
+	hash := sha256.Sum256([]byte(testCodeVerifier))
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"client"},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid"},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(hash[:])},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func postForm(router http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+// authorizeForm loads the authorize page of the params, returning the CSRF cookie and token of its form
+func authorizeForm(t *testing.T, router http.Handler, params url.Values) (*http.Cookie, string) {
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	cookies := rw.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	match := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(rw.Body.String())
+	assert.Len(t, match, 2)
+	return cookies[0], match[1]
+}
+
+// postAuthorize posts the authorize form of the params as the browser which loaded the page
+func postAuthorize(t *testing.T, router http.Handler, params url.Values) *httptest.ResponseRecorder {
+	cookie, token := authorizeForm(t, router, params)
+	form := url.Values{"csrf_token": {token}}
+	for key, values := range params {
+		form[key] = values
+	}
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookie)
+	router.ServeHTTP(rw, r)
+	return rw
+}
+
+func redirectParams(t *testing.T, rw *httptest.ResponseRecorder) url.Values {
+	assert.Equal(t, http.StatusFound, rw.Code)
+	location, err := url.Parse(rw.Header().Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, testRedirectURI, location.Scheme+"://"+location.Host+location.Path)
+	return location.Query()
+}
+
+func TestAuthorizePage(t *testing.T) {
+	router := initializeOAuthRouter(t)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/authorize?"+authorizeParams().Encode(), nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "DENY", rw.Header().Get("X-Frame-Options"))
+	assert.Contains(t, rw.Body.String(), "Test App")
+
+	params := authorizeParams()
+	params.Set("redirect_uri", "https://attacker.example.com")
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Empty(t, rw.Header().Get("Location"))
+
+	params = authorizeParams()
+	params.Set("code_challenge_method", "plain")
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil))
+	query := redirectParams(t, rw)
+	assert.Equal(t, "invalid_request", query.Get("error"))
+	assert.Equal(t, "xyz", query.Get("state"))
+
+	params = authorizeParams()
+	params.Set("consent", "deny")
+	query = redirectParams(t, postAuthorize(t, router, params))
+	assert.Equal(t, "access_denied", query.Get("error"))
+
+	params = authorizeParams()
+	params.Set("consent", "allow")
+	params.Set("email", testutil.TestEmail)
+	params.Set("password", "wrong")
+	rw = postAuthorize(t, router, params)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.Contains(t, rw.Body.String(), "invalid credentials")
+}
+
+func TestAuthorizeRejectsForgedForm(t *testing.T) {
+	router := initializeOAuthRouter(t)
+	params := authorizeParams()
+	params.Set("consent", "allow")
+	params.Set("email", testutil.TestEmail)
+	params.Set("password", testutil.TestPassword)
+	post := func(form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		router.ServeHTTP(rw, r)
+		return rw
+	}
+
+	// posted by another site, which can't send the cookie of the browser
+	assert.Equal(t, http.StatusForbidden, post(params, nil).Code)
+	cookie, token := authorizeForm(t, router, authorizeParams())
+	form := url.Values{"csrf_token": {token}}
+	for key, values := range params {
+		form[key] = values
+	}
+	rw := post(form, nil)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Body.String(), "The form has expired")
+	assert.NotContains(t, rw.Header().Get("Location"), "code=")
+
+	// the token of the cookie of another browser
+	otherCookie, _ := authorizeForm(t, router, authorizeParams())
+	assert.Equal(t, http.StatusForbidden, post(form, otherCookie).Code)
+
+	// the token is bound to the request which the page was loaded for
+	tampered := url.Values{}
+	for key, values := range form {
+		tampered[key] = values
+	}
+	tampered.Set("state", "attacker")
+	assert.Equal(t, http.StatusForbidden, post(tampered, cookie).Code)
+
+	query := redirectParams(t, post(form, cookie))
+	assert.NotEmpty(t, query.Get("code"))
+}
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	router := initializeOAuthRouter(t)
+	params := authorizeParams()
+	params.Set("consent", "allow")
+	params.Set("email", testutil.TestEmail)
+	params.Set("password", testutil.TestPassword)
+	query := redirectParams(t, postAuthorize(t, router, params))
+	assert.Equal(t, "xyz", query.Get("state"))
+	code := query.Get("code")
+	assert.NotEmpty(t, code)
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"client"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	}
+	rw := postForm(router, "/token", form)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "no-store", rw.Header().Get("Cache-Control"))
+	var tokens authentication.TokenResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&tokens))
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.IDToken)
+
+	rw = postForm(router, "/token", form)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	var oauthErr authentication.OAuthError
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&oauthErr))
+	assert.Equal(t, "invalid_grant", oauthErr.Code)
+
+	rw = postForm(router, "/token", url.Values{
+		"grant_type": {"refresh_token"}, "client_id": {"client"}, "refresh_token": {tokens.RefreshToken},
+	})
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	rw = postForm(router, "/token", url.Values{"grant_type": {"password"}, "client_id": {"client"}})
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	rw = postForm(router, "/token", url.Values{"grant_type": {"refresh_token"}, "client_id": {"unknown"}})
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "jobs", Name: "Jobs", Scopes: []string{"jobs:read"}}, "s3cret&"))
+	router := NewRouter(NewHandler(authService, logger))
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("jobs", url.QueryEscape("s3cret&"))
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var tokens authentication.TokenResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&tokens))
+	assert.Equal(t, "jobs:read", tokens.Scope)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	form.Set("client_id", "jobs")
+	form.Set("client_secret", "s3cret&")
+	rw = postForm(router, "/token", form)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/token", strings.NewReader("grant_type=client_credentials"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("jobs", "wrong")
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.NotEmpty(t, rw.Header().Get("WWW-Authenticate"))
+
+	server := NewAuthServer(authService, logger)
+	res, err := server.ClientCredentials(context.Background(), &protos.ClientCredentialsRequest{
+		ClientId: "jobs", ClientSecret: "s3cret&", Scope: "jobs:read",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", res.TokenType)
+	assert.Equal(t, "jobs:read", res.Scope)
+	_, err = server.ClientCredentials(context.Background(), &protos.ClientCredentialsRequest{
+		ClientId: "jobs", ClientSecret: "s3cret&", Scope: "admin",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.ClientCredentials(context.Background(), &protos.ClientCredentialsRequest{ClientId: "jobs"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestIntrospect(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "api", Name: "API"}, "secret"))
+	router := NewRouter(NewHandler(authService, logger))
+	tokens := login(t, router)
+
+	form := url.Values{"client_id": {"api"}, "client_secret": {"secret"}, "token": {tokens.RefreshToken}}
+	rw := postForm(router, "/introspect", form)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var response authentication.IntrospectionResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&response))
+	assert.True(t, response.Active)
+	assert.Equal(t, "refresh_token", response.TokenType)
+
+	form.Set("token", "malformed")
+	rw = postForm(router, "/introspect", form)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"active": false}`, rw.Body.String())
+
+	form.Set("client_secret", "wrong")
+	rw = postForm(router, "/introspect", form)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	rw = postForm(router, "/introspect", url.Values{"client_id": {"api"}, "client_secret": {"secret"}})
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestRevoke(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	router := NewRouter(NewHandler(authService, logger))
+	tokens := login(t, router)
+
+	rw := postForm(router, "/revoke", url.Values{"token": {tokens.AccessToken}, "token_type_hint": {"access_token"}})
+	assert.Equal(t, http.StatusOK, rw.Code)
+	rw = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	rw = postForm(router, "/revoke", url.Values{"token": {tokens.RefreshToken}})
+	assert.Equal(t, http.StatusOK, rw.Code)
+	rw = refresh(router, "Bearer "+tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	rw = postForm(router, "/revoke", url.Values{"token": {"malformed"}})
+	assert.Equal(t, http.StatusOK, rw.Code)
+	rw = postForm(router, "/revoke", url.Values{})
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestTokenExchangeGrant(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	// the access tokens of signing in directly are for the jobs client
+	viper.Set("IDTokenAudience", "jobs")
+	t.Cleanup(func() { viper.Set("IDTokenAudience", "") })
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "jobs", Name: "Jobs", Scopes: []string{"jobs:read"}}, "secret"))
+	router := NewRouter(NewHandler(authService, logger))
+	tokens := login(t, router)
+
+	form := url.Values{
+		"grant_type":         {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"client_id":          {"jobs"},
+		"client_secret":      {"secret"},
+		"subject_token":      {tokens.AccessToken},
+		"subject_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"audience":           {"jobs-api"},
+	}
+	rw := postForm(router, "/token", form)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var exchanged authentication.TokenResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&exchanged))
+	assert.Equal(t, "urn:ietf:params:oauth:token-type:access_token", exchanged.IssuedTokenType)
+	assert.Equal(t, "openid email", exchanged.Scope)
+
+	// the exchanged token can't manage the account of the user
+	rw = postJSON(router, "/mfa/enroll", "Bearer "+exchanged.AccessToken, "")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+
+	form.Set("scope", "jobs:read")
+	rw = postForm(router, "/token", form)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
@@ -0,0 +1,140 @@
+package adapters
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// passwordResetPage is the page of the reset link where the user chooses the new password
+var passwordResetPage = template.Must(template.New("passwordReset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reset your password</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+{{if .Done}}
+<p>Your password is changed, you can sign in with it now.</p>
+{{else}}
+<form method="post" action="/password/reset">
+<input type="hidden" name="token" value="{{.Token}}">
+<label>New password <input type="password" name="password" autocomplete="new-password" required></label>
+<button type="submit">Reset password</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type passwordResetPageData struct {
+	Token string
+	Error string
+	Done  bool
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+	LogoutAll   bool   `json:"logout_all"`
+}
+
+type passwordResetRequest struct {
+	Email    string `json:"email"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (ah *AuthenticationHandler) renderPasswordResetPage(rw http.ResponseWriter, status int, data passwordResetPageData) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Referrer-Policy", "no-referrer")
+	rw.WriteHeader(status)
+	err := passwordResetPage.Execute(rw, data)
+	if err != nil {
+		ah.l.Printf("[ERROR] rendering the password reset page has %s error", err)
+	}
+}
+
+// ForgotPassword mails the password reset link, the response doesn't reveal whether the user exists
+func (ah *AuthenticationHandler) ForgotPassword(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Forgot Password")
+	request := passwordResetRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Email == "" {
+		ah.l.Println("[ERROR] deserializing the forgot password request", err)
+		http.Error(rw, "Error reading the forgot password request", http.StatusBadRequest)
+		return
+	}
+	err = ah.authService.RequestPasswordReset(request.Email)
+	if err != nil {
+		ah.l.Printf("[ERROR] requesting the password reset has %s error", err)
+		httpError(rw, "Unable to reset the password", err)
+		return
+	}
+	rw.WriteHeader(http.StatusAccepted)
+	rw.Write([]byte("A password reset email is sent if the account exists"))
+}
+
+// ResetPassword sets the new password with the token of the reset link. GET shows the page of the
+// link which posts the form back, and the clients can send the token and the password in the JSON
+// body with POST.
+func (ah *AuthenticationHandler) ResetPassword(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Password Reset")
+	if r.Method == http.MethodGet {
+		ah.renderPasswordResetPage(rw, http.StatusOK, passwordResetPageData{Token: r.URL.Query().Get("token")})
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		request := passwordResetRequest{}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil || request.Token == "" {
+			ah.l.Println("[ERROR] deserializing the password reset request", err)
+			http.Error(rw, "Error reading the password reset request", http.StatusBadRequest)
+			return
+		}
+		err = ah.authService.ResetPassword(request.Token, request.Password)
+		if err != nil {
+			ah.l.Printf("[ERROR] resetting the password has %s error", err)
+			httpError(rw, "Unable to reset the password", err)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte("Password successfully reset"))
+		return
+	}
+
+	data := passwordResetPageData{Token: r.PostFormValue("token")}
+	err := ah.authService.ResetPassword(data.Token, r.PostFormValue("password"))
+	if err != nil {
+		ah.l.Printf("[ERROR] resetting the password has %s error", err)
+		mapping := mapError(err)
+		data.Error = "Unable to reset the password: " + mapping.err.Error()
+		ah.renderPasswordResetPage(rw, mapping.httpStatus, data)
+		return
+	}
+	data.Done = true
+	ah.renderPasswordResetPage(rw, http.StatusOK, data)
+}
+
+// ChangePassword sets the new password of the signed in user, the other devices are signed out
+// when logout_all is set and the session of the access token stays signed in
+func (ah *AuthenticationHandler) ChangePassword(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle Password Change")
+	request := changePasswordRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.OldPassword == "" || request.NewPassword == "" {
+		ah.l.Println("[ERROR] deserializing the change password request", err)
+		http.Error(rw, "Error reading the change password request", http.StatusBadRequest)
+		return
+	}
+	claims := accessTokenClaims(r.Context())
+	err = ah.authService.ChangePassword(claims.Data.UserEmail, request.OldPassword, request.NewPassword, request.LogoutAll, claims.SessionID)
+	if err != nil {
+		ah.l.Printf("[ERROR] changing the password has %s error", err)
+		httpError(rw, "Unable to change the password", err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("Password successfully changed"))
+}
@@ -0,0 +1,109 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/99designs/gqlgen/client"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	protos "github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPasswordResetOverREST(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	notifier := &testutil.Notifier{}
+	authService.SetNotifier(notifier)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	router := NewRouter(NewHandler(authService, logger))
+	newPassword := "914#_Resetting456"
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/password/forgot", "", `{}`).Code)
+	assert.Equal(t, http.StatusAccepted, postJSON(router, "/password/forgot", "", `{"email": "missing@test.com"}`).Code)
+	rw := postJSON(router, "/password/forgot", "", fmt.Sprintf(`{"email": %q}`, testutil.TestEmail))
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+	token := notifier.LastToken(t, testutil.TestEmail)
+
+	// the page of the link posts the form back
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/password/reset?token="+url.QueryEscape(token), nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), token)
+	form := url.Values{"token": {token}, "password": {"123"}}
+	rw = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), "The password is too weak")
+
+	form.Set("password", newPassword)
+	rw = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "Your password is changed")
+
+	// the clients send JSON
+	postJSON(router, "/password/forgot", "", fmt.Sprintf(`{"email": %q}`, testutil.TestEmail))
+	body := fmt.Sprintf(`{"token": %q, "password": %q}`, notifier.LastToken(t, testutil.TestEmail), testutil.TestPassword)
+	rw = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotEmpty(t, login(t, router).AccessToken)
+}
+
+func TestChangePasswordOverAllGateways(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	router := NewRouter(NewHandler(authService, logger))
+	tokens := login(t, router)
+	newPassword := "914#_Resetting456"
+
+	// REST
+	body := fmt.Sprintf(`{"old_password": %q, "new_password": %q}`, testutil.TestPassword, newPassword)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/password/change", "", body).Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/password/change", "Bearer "+tokens.AccessToken, `{}`).Code)
+	wrong := fmt.Sprintf(`{"old_password": "wrong password", "new_password": %q}`, newPassword)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/password/change", "Bearer "+tokens.AccessToken, wrong).Code)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/password/change", "Bearer "+tokens.AccessToken, body).Code)
+
+	// gRPC signs out the other session but not the one of the access token
+	rw := postJSON(router, "/login", "", fmt.Sprintf(`{"email": %q, "password": %q}`, testutil.TestEmail, newPassword))
+	var other entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&other))
+	server := NewAuthServer(authService, logger)
+	ctx := context.Background()
+	_, err := server.ChangePassword(ctx, &protos.ChangePasswordRequest{
+		AccessToken: tokens.AccessToken, OldPassword: newPassword, NewPassword: "123",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.ChangePassword(ctx, &protos.ChangePasswordRequest{
+		AccessToken: tokens.AccessToken, OldPassword: newPassword, NewPassword: testutil.TestPassword, LogoutAll: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, refresh(router, "Bearer "+other.RefreshToken).Code)
+	assert.Equal(t, http.StatusOK, refresh(router, "Bearer "+tokens.RefreshToken).Code)
+
+	// GraphQL
+	c := client.New(NewGraphQLHandler(&Resolver{AuthService: authService, Logger: logger}))
+	var changeResp struct{ ChangePassword string }
+	err = c.Post(`mutation($old: String!, $new: String!) { changePassword(oldPassword: $old, newPassword: $new) }`,
+		&changeResp, client.Var("old", testutil.TestPassword), client.Var("new", newPassword),
+		client.AddHeader("Authorization", "Bearer "+tokens.AccessToken))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, changeResp.ChangePassword)
+	body = fmt.Sprintf(`{"email": %q, "password": %q}`, testutil.TestEmail, newPassword)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/login", "", body).Code)
+}
@@ -1,7 +1,9 @@
 package adapters
 
 import (
+	"github.com/Hamifthi/authentication_microservice/entity"
 	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/graph/model"
 	"log"
 )
 
@@ -13,3 +15,30 @@ type Resolver struct {
 	AuthService *authentication.AuthenticationService
 	Logger      *log.Logger
 }
+
+// stringValue returns the value of an optional argument, which is empty when it isn't set
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// optionalString returns nil for an empty value, so the nullable field is null instead of ""
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// newTokens returns the tokens of the service for the GraphQL schema, the ones which aren't
+// issued are null
+func newTokens(tokens entity.Tokens) *model.Tokens {
+	return &model.Tokens{
+		Access:   optionalString(tokens.AccessToken),
+		Refresh:  optionalString(tokens.RefreshToken),
+		IDToken:  optionalString(tokens.IDToken),
+		MfaToken: optionalString(tokens.MFAToken),
+	}
+}
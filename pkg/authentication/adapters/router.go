@@ -0,0 +1,59 @@
+package adapters
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// NewRouter creates the REST router and mounts the handlers with their middlewares
+func NewRouter(authHandler *AuthenticationHandler) *mux.Router {
+	sm := mux.NewRouter()
+	WellKnownRouter := sm.Methods(http.MethodGet).Subrouter()
+	WellKnownRouter.HandleFunc("/.well-known/jwks.json", authHandler.JWKS)
+	WellKnownRouter.HandleFunc("/.well-known/openid-configuration", authHandler.OpenIDConfiguration)
+
+	sm.HandleFunc("/userinfo", authHandler.UserInfo).Methods(http.MethodGet, http.MethodPost)
+	sm.HandleFunc("/authorize", authHandler.Authorize).Methods(http.MethodGet, http.MethodPost)
+	sm.HandleFunc("/token", authHandler.Token).Methods(http.MethodPost)
+	sm.HandleFunc("/introspect", authHandler.Introspect).Methods(http.MethodPost)
+	sm.HandleFunc("/revoke", authHandler.Revoke).Methods(http.MethodPost)
+	sm.HandleFunc("/device/code", authHandler.DeviceAuthorization).Methods(http.MethodPost)
+	sm.HandleFunc("/device", authHandler.Device).Methods(http.MethodGet, http.MethodPost)
+	sm.HandleFunc("/verify-email", authHandler.VerifyEmail).Methods(http.MethodGet, http.MethodPost)
+	sm.HandleFunc("/verify-email/resend", authHandler.ResendVerificationEmail).Methods(http.MethodPost)
+	sm.HandleFunc("/password/forgot", authHandler.ForgotPassword).Methods(http.MethodPost)
+	sm.HandleFunc("/password/reset", authHandler.ResetPassword).Methods(http.MethodGet, http.MethodPost)
+
+	SignUpRouter := sm.Methods(http.MethodPost).Subrouter()
+	SignUpRouter.HandleFunc("/signup", authHandler.UserSignUp)
+	SignUpRouter.Use(authHandler.MiddlewareValidateUser)
+
+	LoginRouter := sm.Methods(http.MethodPost).Subrouter()
+	LoginRouter.HandleFunc("/login", authHandler.UserLogin)
+	LoginRouter.Use(authHandler.MiddlewareValidateUser)
+
+	sm.HandleFunc("/mfa/verify", authHandler.VerifyMFA).Methods(http.MethodPost)
+	MFARouter := sm.Methods(http.MethodPost).Subrouter()
+	MFARouter.HandleFunc("/mfa/enroll", authHandler.EnrollMFA)
+	MFARouter.HandleFunc("/mfa/confirm", authHandler.ConfirmMFA)
+	MFARouter.HandleFunc("/mfa/disable", authHandler.DisableMFA)
+	MFARouter.Use(authHandler.MiddlewareValidateAccessToken)
+
+	PasswordRouter := sm.Methods(http.MethodPost).Subrouter()
+	PasswordRouter.HandleFunc("/password/change", authHandler.ChangePassword)
+	PasswordRouter.Use(authHandler.MiddlewareValidateAccessToken)
+
+	sm.HandleFunc("/webauthn/login/begin", authHandler.BeginWebAuthnLogin).Methods(http.MethodPost)
+	sm.HandleFunc("/webauthn/login/finish", authHandler.FinishWebAuthnLogin).Methods(http.MethodPost)
+	WebAuthnRouter := sm.Methods(http.MethodPost).Subrouter()
+	WebAuthnRouter.HandleFunc("/webauthn/register/begin", authHandler.BeginWebAuthnRegistration)
+	WebAuthnRouter.HandleFunc("/webauthn/register/finish", authHandler.FinishWebAuthnRegistration)
+	WebAuthnRouter.Use(authHandler.MiddlewareValidateAccessToken)
+
+	RefreshTokenRouter := sm.Methods(http.MethodPost).Subrouter()
+	RefreshTokenRouter.HandleFunc("/refresh", authHandler.UserRefresh)
+	RefreshTokenRouter.HandleFunc("/logout", authHandler.UserLogout)
+	RefreshTokenRouter.HandleFunc("/logout-all", authHandler.UserLogoutAll)
+	RefreshTokenRouter.Use(authHandler.MiddlewareValidateRefreshToken)
+	return sm
+}
@@ -5,9 +5,12 @@ package adapters
 
 import (
 	"context"
+	"encoding/base64"
 	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
 	"github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/graph/generated"
 	"github.com/Hamifthi/authentication_microservice/pkg/authentication/adapters/graph/model"
+	"time"
 )
 
 func (r *mutationResolver) SignUp(ctx context.Context, input model.UserInput) (string, error) {
@@ -39,14 +42,165 @@ func (r *mutationResolver) Login(ctx context.Context, input model.UserInput) (*m
 		r.Logger.Printf("[ERROR] login user has %s error", err)
 		return nil, err
 	}
-	tokens := &model.Tokens{
-		Access:  authsrcTokens.AccessToken,
-		Refresh: authsrcTokens.RefreshToken,
+	return newTokens(authsrcTokens), nil
+}
+
+func (r *mutationResolver) Refresh(ctx context.Context, refreshToken string) (*model.Tokens, error) {
+	r.Logger.Println("Handle refresh token of the user in GraphQL server")
+	authsrcTokens, err := r.AuthService.RefreshAccessToken(refreshToken)
+	if err != nil {
+		r.Logger.Printf("[ERROR] refreshing the access token has %s error", err)
+		return nil, err
+	}
+	return newTokens(authsrcTokens), nil
+}
+
+func (r *mutationResolver) Logout(ctx context.Context, refreshToken string) (string, error) {
+	r.Logger.Println("Handle logout of the user in GraphQL server")
+	err := r.AuthService.Logout(refreshToken)
+	if err != nil {
+		r.Logger.Printf("[ERROR] logout user has %s error", err)
+		return "", err
+	}
+	return "User successfully logged out", nil
+}
+
+func (r *mutationResolver) LogoutAll(ctx context.Context, refreshToken string) (string, error) {
+	r.Logger.Println("Handle logout everywhere of the user in GraphQL server")
+	user, err := r.AuthService.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		r.Logger.Printf("[ERROR] validating the refresh token has %s error", err)
+		return "", err
+	}
+	err = r.AuthService.LogoutAll(user.Email)
+	if err != nil {
+		r.Logger.Printf("[ERROR] logout user everywhere has %s error", err)
+		return "", err
+	}
+	return "User successfully logged out everywhere", nil
+}
+
+func (r *mutationResolver) VerifyMfa(ctx context.Context, mfaToken string, code string) (*model.Tokens, error) {
+	r.Logger.Println("Handle verify MFA of the user in GraphQL server")
+	authsrcTokens, err := r.AuthService.VerifyMFA(mfaToken, code)
+	if err != nil {
+		r.Logger.Printf("[ERROR] verifying MFA of the user has %s error", err)
+		return nil, err
 	}
-	return tokens, nil
+	return newTokens(authsrcTokens), nil
+}
+
+func (r *mutationResolver) EnrollMfa(ctx context.Context) (*model.MFAEnrollment, error) {
+	r.Logger.Println("Handle enroll MFA of the user in GraphQL server")
+	claims := accessTokenClaims(ctx)
+	enrollment, err := r.AuthService.EnrollMFA(claims.Data.UserEmail)
+	if err != nil {
+		r.Logger.Printf("[ERROR] enrolling MFA of the user has %s error", err)
+		return nil, err
+	}
+	return &model.MFAEnrollment{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+		QRCode: base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	}, nil
+}
+
+func (r *mutationResolver) ConfirmMfa(ctx context.Context, code string) ([]string, error) {
+	r.Logger.Println("Handle confirm MFA of the user in GraphQL server")
+	claims := accessTokenClaims(ctx)
+	recoveryCodes, err := r.AuthService.ConfirmMFA(claims.Data.UserEmail, code)
+	if err != nil {
+		r.Logger.Printf("[ERROR] confirming MFA of the user has %s error", err)
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+func (r *mutationResolver) DisableMfa(ctx context.Context, code string) (string, error) {
+	r.Logger.Println("Handle disable MFA of the user in GraphQL server")
+	claims := accessTokenClaims(ctx)
+	err := r.AuthService.DisableMFA(claims.Data.UserEmail, code)
+	if err != nil {
+		r.Logger.Printf("[ERROR] disabling MFA of the user has %s error", err)
+		return "", err
+	}
+	return "MFA successfully disabled", nil
+}
+
+func (r *mutationResolver) ChangePassword(ctx context.Context, oldPassword string, newPassword string, logoutAll bool) (string, error) {
+	r.Logger.Println("Handle change password of the user in GraphQL server")
+	claims := accessTokenClaims(ctx)
+	err := r.AuthService.ChangePassword(claims.Data.UserEmail, oldPassword, newPassword, logoutAll, claims.SessionID)
+	if err != nil {
+		r.Logger.Printf("[ERROR] changing the password of the user has %s error", err)
+		return "", err
+	}
+	return "Password successfully changed", nil
+}
+
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	r.Logger.Println("Handle me query of the user in GraphQL server")
+	claims := accessTokenClaims(ctx)
+	user, err := r.AuthService.GetUser(claims.Data.UserEmail)
+	if err != nil {
+		r.Logger.Printf("[ERROR] getting the current user has %s error", err)
+		return nil, err
+	}
+	return &model.User{
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}, nil
+}
+
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	r.Logger.Println("Handle sessions query of the user in GraphQL server")
+	claims := accessTokenClaims(ctx)
+	sessions, err := r.AuthService.GetActiveSessions(claims.Data.UserEmail)
+	if err != nil {
+		r.Logger.Printf("[ERROR] getting the sessions of the user has %s error", err)
+		return nil, err
+	}
+	result := make([]*model.Session, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, &model.Session{
+			ID:        session.ID,
+			FamilyID:  session.FamilyID,
+			ExpiresAt: session.ExpiresAt,
+			CreatedAt: session.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+func (r *queryResolver) ValidateToken(ctx context.Context, token string, audience *string, scope *string, clientID *string) (*model.TokenClaims, error) {
+	r.Logger.Println("Handle validate token query in GraphQL server")
+	claims, err := r.AuthService.ValidateAccessTokenFor(token, authentication.AccessTokenRequirements{
+		Audience: stringValue(audience),
+		Scope:    stringValue(scope),
+		ClientID: stringValue(clientID),
+	})
+	if err != nil {
+		r.Logger.Printf("[ERROR] validating the access token has %s error", err)
+		return nil, err
+	}
+	return &model.TokenClaims{
+		Email:     claims.Data.UserEmail,
+		TokenType: claims.Data.TokenType,
+		Issuer:    claims.Issuer,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		Scope:     claims.Scope,
+		Audience:  optionalString(claims.Audience),
+		ClientID:  optionalString(claims.ClientID),
+		Act:       claims.Act.Subjects(),
+	}, nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
+// Query returns generated.QueryResolver implementation.
+func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
+
 type mutationResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
@@ -0,0 +1,110 @@
+package adapters
+
+import (
+	"github.com/99designs/gqlgen/client"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type graphqlTokens struct {
+	Access  string
+	Refresh string
+}
+
+func initializeGraphQLClient(t *testing.T) *client.Client {
+	authService, logger := initializeSignedUpAuthService(t)
+	resolver := &Resolver{AuthService: authService, Logger: logger}
+	return client.New(NewGraphQLHandler(resolver))
+}
+
+func graphqlLogin(t *testing.T, c *client.Client) graphqlTokens {
+	var resp struct{ Login graphqlTokens }
+	err := c.Post(`mutation($email: String!, $password: String!) {
+		login(input: {email: $email, password: $password}) { access refresh }
+	}`, &resp, client.Var("email", testutil.TestEmail), client.Var("password", testutil.TestPassword))
+	assert.Nil(t, err)
+	return resp.Login
+}
+
+func TestGraphQLMeRequiresAccessToken(t *testing.T) {
+	c := initializeGraphQLClient(t)
+	var resp struct{ Me struct{ Email string } }
+	err := c.Post(`query { me { email } }`, &resp)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Authorization token not provided or malformed")
+
+	err = c.Post(`query { me { email } }`, &resp, client.AddHeader("Authorization", "Bearer invalid"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Access token isn't valid")
+}
+
+func TestGraphQLMe(t *testing.T) {
+	c := initializeGraphQLClient(t)
+	tokens := graphqlLogin(t, c)
+	var resp struct{ Me struct{ Email string } }
+	err := c.Post(`query { me { email } }`, &resp, client.AddHeader("Authorization", "Bearer "+tokens.Access))
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, resp.Me.Email)
+}
+
+func TestGraphQLSessions(t *testing.T) {
+	c := initializeGraphQLClient(t)
+	tokens := graphqlLogin(t, c)
+	graphqlLogin(t, c)
+	var refreshResp struct{ Refresh graphqlTokens }
+	err := c.Post(`mutation($token: String!) { refresh(refreshToken: $token) { access refresh } }`,
+		&refreshResp, client.Var("token", tokens.Refresh))
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokens.Refresh, refreshResp.Refresh.Refresh)
+
+	var resp struct {
+		Sessions []struct {
+			ID       string
+			FamilyID string
+		}
+	}
+	err = c.Post(`query { sessions { id familyId } }`, &resp,
+		client.AddHeader("Authorization", "Bearer "+refreshResp.Refresh.Access))
+	assert.Nil(t, err)
+	assert.Len(t, resp.Sessions, 2)
+	assert.NotEqual(t, resp.Sessions[0].FamilyID, resp.Sessions[1].FamilyID)
+}
+
+func TestGraphQLValidateToken(t *testing.T) {
+	c := initializeGraphQLClient(t)
+	tokens := graphqlLogin(t, c)
+	var resp struct {
+		ValidateToken struct {
+			Email     string
+			TokenType string
+			Scope     string
+			Audience  *string
+			ClientID  *string
+			Act       []string
+		}
+	}
+	err := c.Post(`query($token: String!) { validateToken(token: $token) { email tokenType scope audience clientId act } }`,
+		&resp, client.Var("token", tokens.Access))
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, resp.ValidateToken.Email)
+	assert.Equal(t, "access", resp.ValidateToken.TokenType)
+	assert.Equal(t, "openid email", resp.ValidateToken.Scope)
+	assert.NotNil(t, resp.ValidateToken.Audience)
+	assert.Nil(t, resp.ValidateToken.ClientID)
+	assert.Empty(t, resp.ValidateToken.Act)
+
+	err = c.Post(`query($token: String!) { validateToken(token: $token, scope: "email") { email } }`,
+		&resp, client.Var("token", tokens.Access))
+	assert.Nil(t, err)
+	err = c.Post(`query($token: String!) { validateToken(token: $token, scope: "jobs:read") { email } }`,
+		&resp, client.Var("token", tokens.Access))
+	assert.ErrorContains(t, err, "INSUFFICIENT_SCOPE")
+	err = c.Post(`query($token: String!) { validateToken(token: $token, audience: "billing") { email } }`,
+		&resp, client.Var("token", tokens.Access))
+	assert.ErrorContains(t, err, "INVALID_TOKEN")
+
+	err = c.Post(`query($token: String!) { validateToken(token: $token) { email } }`,
+		&resp, client.Var("token", tokens.Refresh))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,114 @@
+package adapters
+
+import (
+	"encoding/json"
+	"github.com/go-webauthn/webauthn/protocol"
+	"net/http"
+)
+
+// webAuthnRequest is the body of the WebAuthn endpoints, the password is only sent to begin
+// registering, the MFA token to begin signing in and the session and the credential to finish the
+// ceremonies. The credential is decoded by the ceremony which it finishes.
+type webAuthnRequest struct {
+	Password   string          `json:"password"`
+	MFAToken   string          `json:"mfa_token"`
+	Session    string          `json:"session"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func (ah *AuthenticationHandler) readWebAuthnRequest(rw http.ResponseWriter, r *http.Request, finish bool) (webAuthnRequest, bool) {
+	request := webAuthnRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || (finish && (request.Session == "" || len(request.Credential) == 0)) {
+		ah.l.Println("[ERROR] deserializing the WebAuthn request", err)
+		http.Error(rw, "Error reading the WebAuthn request", http.StatusBadRequest)
+		return request, false
+	}
+	return request, true
+}
+
+func (ah *AuthenticationHandler) readWebAuthnCredential(rw http.ResponseWriter, request webAuthnRequest, credential interface{}) bool {
+	err := json.Unmarshal(request.Credential, credential)
+	if err != nil {
+		ah.l.Println("[ERROR] deserializing the WebAuthn credential", err)
+		http.Error(rw, "Error reading the WebAuthn credential", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// BeginWebAuthnRegistration returns the options of creating a passkey for the signed in user
+func (ah *AuthenticationHandler) BeginWebAuthnRegistration(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle WebAuthn Registration Beginning")
+	request, ok := ah.readWebAuthnRequest(rw, r, false)
+	if !ok {
+		return
+	}
+	claims := accessTokenClaims(r.Context())
+	registration, err := ah.authService.BeginWebAuthnRegistration(claims.Data.UserEmail, request.Password)
+	if err != nil {
+		ah.l.Printf("[ERROR] beginning the WebAuthn registration has %s error", err)
+		httpError(rw, "Unable to begin registering the passkey", err)
+		return
+	}
+	ah.writeJSON(rw, "Unable to begin registering the passkey", registration)
+}
+
+// FinishWebAuthnRegistration stores the created passkey of the signed in user
+func (ah *AuthenticationHandler) FinishWebAuthnRegistration(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle WebAuthn Registration Finishing")
+	request, ok := ah.readWebAuthnRequest(rw, r, true)
+	if !ok {
+		return
+	}
+	credential := protocol.CredentialCreationResponse{}
+	if !ah.readWebAuthnCredential(rw, request, &credential) {
+		return
+	}
+	claims := accessTokenClaims(r.Context())
+	err := ah.authService.FinishWebAuthnRegistration(claims.Data.UserEmail, request.Session, credential)
+	if err != nil {
+		ah.l.Printf("[ERROR] finishing the WebAuthn registration has %s error", err)
+		httpError(rw, "Unable to register the passkey", err)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("Passkey successfully registered"))
+}
+
+// BeginWebAuthnLogin returns the options of signing in with a passkey, with the MFA token of
+// /login the passkey is the second factor
+func (ah *AuthenticationHandler) BeginWebAuthnLogin(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle WebAuthn Login Beginning")
+	request, ok := ah.readWebAuthnRequest(rw, r, false)
+	if !ok {
+		return
+	}
+	login, err := ah.authService.BeginWebAuthnLogin(request.MFAToken)
+	if err != nil {
+		ah.l.Printf("[ERROR] beginning the WebAuthn login has %s error", err)
+		httpError(rw, "Unable to begin signing in with the passkey", err)
+		return
+	}
+	ah.writeJSON(rw, "Unable to begin signing in with the passkey", login)
+}
+
+// FinishWebAuthnLogin exchanges the assertion of the passkey for the tokens of its user
+func (ah *AuthenticationHandler) FinishWebAuthnLogin(rw http.ResponseWriter, r *http.Request) {
+	ah.l.Println("Handle WebAuthn Login Finishing")
+	request, ok := ah.readWebAuthnRequest(rw, r, true)
+	if !ok {
+		return
+	}
+	credential := protocol.CredentialAssertionResponse{}
+	if !ah.readWebAuthnCredential(rw, request, &credential) {
+		return
+	}
+	tokens, err := ah.authService.FinishWebAuthnLogin(request.Session, credential)
+	if err != nil {
+		ah.l.Printf("[ERROR] finishing the WebAuthn login has %s error", err)
+		httpError(rw, "Unable to signing in the user", err)
+		return
+	}
+	ah.writeJSON(rw, "Unable to signing in the user", tokens)
+}
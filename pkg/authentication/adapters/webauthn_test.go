@@ -0,0 +1,56 @@
+package adapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/authentication"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestWebAuthnOverREST(t *testing.T) {
+	authService, logger := initializeMemoryAuthService(t)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	user, err := authService.GetUser(testutil.TestEmail)
+	assert.Nil(t, err)
+	router := NewRouter(NewHandler(authService, logger))
+	tokens := login(t, router)
+	authenticator := testutil.NewAuthenticator(t)
+
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/webauthn/register/begin", "", "").Code)
+	wrongPassword := `{"password": "wrong"}`
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/webauthn/register/begin", "Bearer "+tokens.AccessToken, wrongPassword).Code)
+	password := fmt.Sprintf(`{"password": %q}`, testutil.TestPassword)
+	rw := postJSON(router, "/webauthn/register/begin", "Bearer "+tokens.AccessToken, password)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var registration authentication.WebAuthnRegistration
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&registration))
+	forged := *authenticator
+	forged.Origin = "https://evil.example.com"
+	body := fmt.Sprintf(`{"session": %q, "credential": %s}`, registration.Session, forged.Create(t, registration.PublicKey.Challenge.String()))
+	rw = postJSON(router, "/webauthn/register/finish", "Bearer "+tokens.AccessToken, body)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Contains(t, rw.Body.String(), authentication.ErrInvalidWebAuthnResponse.Error())
+
+	rw = postJSON(router, "/webauthn/register/begin", "Bearer "+tokens.AccessToken, password)
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&registration))
+	body = fmt.Sprintf(`{"session": %q, "credential": %s}`, registration.Session, authenticator.Create(t, registration.PublicKey.Challenge.String()))
+	assert.Equal(t, http.StatusOK, postJSON(router, "/webauthn/register/finish", "Bearer "+tokens.AccessToken, body).Code)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/webauthn/login/finish", "", "{}").Code)
+	rw = postJSON(router, "/webauthn/login/begin", "", "{}")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var webAuthnLogin authentication.WebAuthnLogin
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&webAuthnLogin))
+	assert.Empty(t, webAuthnLogin.PublicKey.AllowedCredentials)
+	body = fmt.Sprintf(`{"session": %q, "credential": %s}`, webAuthnLogin.Session, authenticator.Get(t, webAuthnLogin.PublicKey.Challenge.String(), user.ID))
+	rw = postJSON(router, "/webauthn/login/finish", "", body)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var signedIn entity.Tokens
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&signedIn))
+	assert.NotEmpty(t, signedIn.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/webauthn/login/finish", "", body).Code)
+}
@@ -0,0 +1,207 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/pkg/errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	deviceCodeLifetime = 10 * time.Minute
+	// devicePollInterval is the least time the device waits between its token requests, it grows
+	// by slowDownIncrease every time the device polls too fast
+	devicePollInterval = 5 * time.Second
+	slowDownIncrease   = 5 * time.Second
+	// userCodeCharset has no vowels or similar looking characters, so the codes are easy to type
+	// and don't spell words
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// DeviceAuthorizationResponse is the response of the device authorization endpoint
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// generateUserCode returns a random user code which is shown as two groups of four characters
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeCharset))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// normalizeUserCode makes the user code which the user typed comparable to the issued one
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
+
+// AuthorizeDevice starts the device authorization grant of the client, the user approves it on
+// the verification page with the user code while the device polls the token endpoint
+func (a *AuthenticationService) AuthorizeDevice(clientID, clientSecret, scope string) (DeviceAuthorizationResponse, error) {
+	_, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return DeviceAuthorizationResponse{}, err
+	}
+	err = validateScope(scope)
+	if err != nil {
+		return DeviceAuthorizationResponse{}, err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return DeviceAuthorizationResponse{}, errors.Wrap(err, "Error generating the user code")
+	}
+	deviceCode := internal.GenerateID() + internal.GenerateID()
+	err = a.dbService.CreateDeviceCode(entity.DeviceCode{
+		ID:        hashCode(deviceCode),
+		UserCode:  userCode,
+		ClientID:  clientID,
+		Scope:     strings.Join(strings.Fields(scope), " "),
+		Status:    entity.DeviceCodePending,
+		Interval:  devicePollInterval,
+		ExpiresAt: time.Now().Add(deviceCodeLifetime),
+	})
+	if err != nil {
+		a.logger.Println("[Error] storing the device code")
+		return DeviceAuthorizationResponse{}, errors.Wrap(err, "Error storing the device code")
+	}
+	verificationURI := issuer() + "/device"
+	return DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+		ExpiresIn:               int64(deviceCodeLifetime.Seconds()),
+		Interval:                int64(devicePollInterval.Seconds()),
+	}, nil
+}
+
+// GetDeviceAuthorization returns the pending device code of the user code and its client, which
+// the verification page shows to the user
+func (a *AuthenticationService) GetDeviceAuthorization(userCode string) (entity.DeviceCode, entity.Client, error) {
+	code, err := a.dbService.GetDeviceCodeByUserCode(normalizeUserCode(userCode))
+	if errors.Is(err, database.ErrDeviceCodeNotFound) {
+		return code, entity.Client{}, newOAuthError("invalid_request", "The code is invalid")
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the device code from database")
+		return code, entity.Client{}, errors.Wrap(err, "Error can't retrieve the device code from database")
+	}
+	if code.Status != entity.DeviceCodePending || code.ExpiresAt.Before(time.Now()) {
+		return code, entity.Client{}, newOAuthError("invalid_request", "The code is expired or already used")
+	}
+	client, err := a.getClient(code.ClientID)
+	return code, client, err
+}
+
+// VerifyDevice signs in the user on the verification page and approves or denies the device code,
+// the MFA code is only checked for the users who have MFA enabled
+func (a *AuthenticationService) VerifyDevice(userCode, email, password, mfaCode string, approve bool) error {
+	code, _, err := a.GetDeviceAuthorization(userCode)
+	if err != nil {
+		return err
+	}
+	code.Status = entity.DeviceCodeDenied
+	if approve {
+		user, err := a.authenticateMFA(email, password, mfaCode)
+		if err != nil {
+			return err
+		}
+		code.Status = entity.DeviceCodeApproved
+		code.Email = user.Email
+	}
+	err = a.dbService.UpdateDeviceCode(code)
+	if err != nil {
+		a.logger.Println("[Error] updating the device code")
+		return errors.Wrap(err, "Error updating the device code")
+	}
+	return nil
+}
+
+// ExchangeDeviceCode is polled by the device until the user approves or denies the device code,
+// polling faster than the interval of the code makes the device slow down
+func (a *AuthenticationService) ExchangeDeviceCode(clientID, clientSecret, deviceCode string) (TokenResponse, error) {
+	_, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	code, err := a.dbService.GetDeviceCode(hashCode(deviceCode))
+	if errors.Is(err, database.ErrDeviceCodeNotFound) {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The device code is invalid")
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the device code from database")
+		return TokenResponse{}, errors.Wrap(err, "Error can't retrieve the device code from database")
+	}
+	if code.ClientID != clientID {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The device code is issued to another client")
+	}
+	if code.ExpiresAt.Before(time.Now()) {
+		return TokenResponse{}, newOAuthError("expired_token", "The device code is expired")
+	}
+	now := time.Now()
+	interval := code.Interval
+	tooFast := now.Before(code.LastPolledAt.Add(code.Interval))
+	if tooFast {
+		interval += slowDownIncrease
+	}
+	// only the polling is written, so an approval made since the code is read isn't overwritten
+	err = a.dbService.PollDeviceCode(code.ID, code.LastPolledAt, now, interval)
+	if errors.Is(err, database.ErrDeviceCodePolled) {
+		return TokenResponse{}, newOAuthError("slow_down", "The device polls too fast")
+	}
+	if err != nil {
+		a.logger.Println("[Error] updating the polling of the device code")
+		return TokenResponse{}, errors.Wrap(err, "Error updating the polling of the device code")
+	}
+	switch {
+	case tooFast:
+		return TokenResponse{}, newOAuthError("slow_down", "The device polls too fast")
+	case code.Status == entity.DeviceCodePending:
+		return TokenResponse{}, newOAuthError("authorization_pending", "The user hasn't approved the device yet")
+	case code.Status == entity.DeviceCodeDenied:
+		return TokenResponse{}, newOAuthError("access_denied", "The user denied the device")
+	}
+	err = a.dbService.UseDeviceCode(code.ID)
+	if errors.Is(err, database.ErrDeviceCodeAlreadyUsed) {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The device code is already used")
+	}
+	if err != nil {
+		a.logger.Println("[Error] marking the device code as used")
+		return TokenResponse{}, errors.Wrap(err, "Error marking the device code as used")
+	}
+	user, err := a.GetUser(code.Email)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	tokens, err := a.issueTokens(user, entity.Session{
+		FamilyID: internal.GenerateID(),
+		ClientID: clientID,
+		Scope:    code.Scope,
+	}, "")
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return newTokenResponse(tokens, code.Scope)
+}
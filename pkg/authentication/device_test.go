@@ -0,0 +1,91 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allowNextPoll moves the last poll of the device code back, so the test doesn't wait for the interval
+func allowNextPoll(t *testing.T, authService *AuthenticationService, deviceCode string) {
+	code, err := authService.dbService.GetDeviceCode(hashCode(deviceCode))
+	assert.Nil(t, err)
+	assert.Nil(t, authService.dbService.PollDeviceCode(code.ID, code.LastPolledAt, time.Now().Add(-code.Interval), code.Interval))
+}
+
+func TestDeviceAuthorizationGrant(t *testing.T) {
+	authService := initializeOAuthService(t)
+	device, err := authService.AuthorizeDevice(testClientID, "", "openid")
+	assert.Nil(t, err)
+	assert.Regexp(t, "^[A-Z]{4}-[A-Z]{4}$", device.UserCode)
+	assert.Equal(t, defaultIssuer+"/device", device.VerificationURI)
+	assert.Equal(t, int64(5), device.Interval)
+	assert.Equal(t, int64(600), device.ExpiresIn)
+
+	_, err = authService.ExchangeDeviceCode(testClientID, "", device.DeviceCode)
+	assertOAuthError(t, err, "authorization_pending")
+	_, err = authService.ExchangeDeviceCode(testClientID, "", device.DeviceCode)
+	assertOAuthError(t, err, "slow_down")
+	code, err := authService.dbService.GetDeviceCode(hashCode(device.DeviceCode))
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, code.Interval)
+
+	// the user code is accepted however the user types it
+	userCode := strings.ToLower(strings.Replace(device.UserCode, "-", "", 1))
+	_, client, err := authService.GetDeviceAuthorization(userCode)
+	assert.Nil(t, err)
+	assert.Equal(t, testClientID, client.ID)
+	err = authService.VerifyDevice(userCode, testutil.TestEmail, "wrong", "", true)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Nil(t, authService.VerifyDevice(userCode, testutil.TestEmail, testutil.TestPassword, "", true))
+	_, _, err = authService.GetDeviceAuthorization(userCode)
+	assertOAuthError(t, err, "invalid_request")
+
+	allowNextPoll(t, authService, device.DeviceCode)
+	_, err = authService.ExchangeDeviceCode("otherClient", "", device.DeviceCode)
+	assertOAuthError(t, err, "invalid_client")
+	tokens, err := authService.ExchangeDeviceCode(testClientID, "", device.DeviceCode)
+	assert.Nil(t, err)
+	assert.Equal(t, "openid", tokens.Scope)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, testClientID, parseIDToken(t, authService, tokens.IDToken).Audience)
+
+	allowNextPoll(t, authService, device.DeviceCode)
+	_, err = authService.ExchangeDeviceCode(testClientID, "", device.DeviceCode)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestDeviceAuthorizationDenied(t *testing.T) {
+	authService := initializeOAuthService(t)
+	device, err := authService.AuthorizeDevice(testClientID, "", "")
+	assert.Nil(t, err)
+	assert.Nil(t, authService.VerifyDevice(device.UserCode, "", "", "", false))
+	_, err = authService.ExchangeDeviceCode(testClientID, "", device.DeviceCode)
+	assertOAuthError(t, err, "access_denied")
+
+	_, err = authService.AuthorizeDevice(testClientID, "", "admin")
+	assertOAuthError(t, err, "invalid_scope")
+	_, err = authService.ExchangeDeviceCode(testClientID, "", "unknown")
+	assertOAuthError(t, err, "invalid_grant")
+	err = authService.VerifyDevice("BCDF-GHJK", testutil.TestEmail, testutil.TestPassword, "", true)
+	assertOAuthError(t, err, "invalid_request")
+}
+
+func TestDeviceCodeExpired(t *testing.T) {
+	authService := initializeOAuthService(t)
+	assert.Nil(t, authService.dbService.CreateDeviceCode(entity.DeviceCode{
+		ID:        hashCode("expired"),
+		UserCode:  "BCDF-GHJK",
+		ClientID:  testClientID,
+		Status:    entity.DeviceCodePending,
+		Interval:  devicePollInterval,
+		ExpiresAt: time.Now().Add(-time.Second),
+	}))
+	_, err := authService.ExchangeDeviceCode(testClientID, "", "expired")
+	assertOAuthError(t, err, "expired_token")
+	err = authService.VerifyDevice("BCDF-GHJK", testutil.TestEmail, testutil.TestPassword, "", true)
+	assertOAuthError(t, err, "invalid_request")
+}
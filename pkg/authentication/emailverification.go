@@ -0,0 +1,150 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	emailVerificationLifetime = 24 * time.Hour
+	emailVerificationToken    = "email_verification"
+)
+
+// emailVerificationRequired is the policy which blocks signing in until the user verifies the
+// email, it's off by default
+func emailVerificationRequired() bool {
+	required, err := internal.GetEnv("EmailVerificationRequired")
+	if err != nil || required == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(required)
+	return err == nil && enabled
+}
+
+// EmailTokenData is the data of the mailed tokens, the password reset tokens carry the
+// fingerprint of the password so they stop working once it's changed
+type EmailTokenData struct {
+	UserEmail           string `json:"userEmail"`
+	TokenType           string `json:"tokenType"`
+	PasswordFingerprint string `json:"passwordFingerprint,omitempty"`
+}
+
+// EmailTokenCustomClaims are the claims of the single use tokens which are mailed to the user
+type EmailTokenCustomClaims struct {
+	Data EmailTokenData `json:"data"`
+	jwt.StandardClaims
+}
+
+// passwordFingerprint identifies the current password of the user without revealing its hash
+func passwordFingerprint(user entity.User) string {
+	sum := sha256.Sum256([]byte(user.HashedPassword))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// generateEmailToken issues the single use token of the type for the user
+func (a *AuthenticationService) generateEmailToken(user entity.User, tokenType string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	data := EmailTokenData{UserEmail: user.Email, TokenType: tokenType}
+	if tokenType == passwordResetToken {
+		data.PasswordFingerprint = passwordFingerprint(user)
+	}
+	claims := EmailTokenCustomClaims{
+		Data: data,
+		StandardClaims: jwt.StandardClaims{
+			Id:        internal.GenerateID(),
+			Subject:   user.ID,
+			Issuer:    issuer(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(lifetime).Unix(),
+		},
+	}
+	return a.signToken(claims)
+}
+
+// useEmailToken verifies the mailed token of the type, revokes it and returns its user
+func (a *AuthenticationService) useEmailToken(token, tokenType string) (entity.User, error) {
+	claims := EmailTokenCustomClaims{}
+	parsedToken, err := jwt.ParseWithClaims(token, &claims, a.keys.VerifyKey)
+	if err != nil {
+		a.logger.Println("[Error] parsing the claims from email token")
+		return entity.User{}, tokenError(err, "Error parsing the claims from email token")
+	}
+	if !parsedToken.Valid || claims.Id == "" || claims.Data.UserEmail == "" || claims.Data.TokenType != tokenType {
+		a.logger.Println("[Error] getting claims from token")
+		return entity.User{}, errors.Wrap(ErrInvalidToken, "Error getting claims from token")
+	}
+	err = a.useSingleUseToken(claims.Id, time.Unix(claims.ExpiresAt, 0), "Email token is already used")
+	if err != nil {
+		return entity.User{}, err
+	}
+	user, err := a.GetUser(claims.Data.UserEmail)
+	if errors.Is(err, ErrUserNotFound) {
+		return user, errors.Wrap(ErrInvalidToken, "The user of the email token doesn't exist")
+	}
+	if err != nil {
+		return user, err
+	}
+	if user.ID != claims.Subject {
+		return user, errors.Wrap(ErrInvalidToken, "The email token belongs to another account")
+	}
+	if tokenType == passwordResetToken && subtle.ConstantTimeCompare(
+		[]byte(claims.Data.PasswordFingerprint), []byte(passwordFingerprint(user))) != 1 {
+		return user, errors.Wrap(ErrInvalidToken, "The password is changed since the email token is issued")
+	}
+	return user, nil
+}
+
+// sendVerificationEmail mails the link of /verify-email with a new verification token to the user
+func (a *AuthenticationService) sendVerificationEmail(user entity.User) error {
+	token, err := a.generateEmailToken(user, emailVerificationToken, emailVerificationLifetime)
+	if err != nil {
+		a.logger.Println("[Error] generating the email verification token")
+		return errors.Wrap(err, "Error generating the email verification token")
+	}
+	return a.notify(user.Email, emailVerificationNotification, map[string]interface{}{
+		"Link":  baseURL() + "/verify-email?token=" + url.QueryEscape(token),
+		"Hours": int(emailVerificationLifetime.Hours()),
+	})
+}
+
+// SendVerificationEmail mails a new verification link to the user, nothing is sent and no error
+// is returned when the user doesn't exist or is already verified so the emails can't be probed
+func (a *AuthenticationService) SendVerificationEmail(email string) error {
+	user, err := a.GetUser(email)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && user.EmailVerified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return a.sendVerificationEmail(user)
+}
+
+// VerifyEmail marks the email of the user of the verification token as verified
+func (a *AuthenticationService) VerifyEmail(token string) error {
+	user, err := a.useEmailToken(token, emailVerificationToken)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	user.EmailVerified = true
+	return a.updateUser(user)
+}
+
+// checkEmailVerified returns ErrEmailNotVerified when the policy requires verified emails to sign in
+func checkEmailVerified(user entity.User) error {
+	if !user.EmailVerified && emailVerificationRequired() {
+		return errors.Wrapf(ErrEmailNotVerified, "the user with %s email hasn't verified it", user.Email)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package authentication
+
+import (
+	"errors"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// initializeNotifierService signs up the test user with the notifier which keeps the sent notifications
+func initializeNotifierService(t *testing.T) (*AuthenticationService, *testutil.Notifier) {
+	testutil.InitializeConfig(t)
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	authService, err := New(database.NewMemorySrv(logger), logger)
+	assert.Nil(t, err)
+	notifier := &testutil.Notifier{}
+	authService.SetNotifier(notifier)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: testClientID, Name: "Test", RedirectURIs: []string{testRedirectURI}}, ""))
+	return authService, notifier
+}
+
+func requireEmailVerification(t *testing.T) {
+	viper.Set("EmailVerificationRequired", "true")
+	t.Cleanup(func() { viper.Set("EmailVerificationRequired", "") })
+}
+
+func TestVerifyEmail(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	if assert.Len(t, notifier.Messages, 1) {
+		assert.Equal(t, "Verify your email address", notifier.Messages[0].Subject)
+	}
+	token := notifier.LastToken(t, testutil.TestEmail)
+	tokens := signInTestUser(t, authService)
+	assert.False(t, parseIDToken(t, authService, tokens.IDToken).EmailVerified)
+
+	assert.Nil(t, authService.VerifyEmail(token))
+	user, err := authService.GetUser(testutil.TestEmail)
+	assert.Nil(t, err)
+	assert.True(t, user.EmailVerified)
+	tokens = signInTestUser(t, authService)
+	assert.True(t, parseIDToken(t, authService, tokens.IDToken).EmailVerified)
+	userInfo, err := authService.GetUserInfo(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.True(t, userInfo.EmailVerified)
+
+	// the token can only be used once and the verified users aren't mailed again
+	assert.ErrorIs(t, authService.VerifyEmail(token), ErrTokenRevoked)
+	assert.Nil(t, authService.SendVerificationEmail(testutil.TestEmail))
+	assert.Nil(t, authService.SendVerificationEmail("missing@test.com"))
+	assert.Len(t, notifier.Messages, 1)
+	assert.ErrorIs(t, authService.VerifyEmail("invalid"), ErrInvalidToken)
+	assert.ErrorIs(t, authService.VerifyEmail(tokens.AccessToken), ErrInvalidToken)
+}
+
+func TestConcurrentVerifyEmail(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	token := notifier.LastToken(t, testutil.TestEmail)
+	var verified, revoked int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := authService.VerifyEmail(token)
+			if err == nil {
+				atomic.AddInt32(&verified, 1)
+			} else if errors.Is(err, ErrTokenRevoked) {
+				atomic.AddInt32(&revoked, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), verified)
+	assert.Equal(t, int32(9), revoked)
+}
+
+func TestEmailVerificationRequired(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	requireEmailVerification(t)
+
+	_, err := authService.SignIn(testutil.TestEmail, testutil.TestPassword)
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+	// the policy is only revealed with the right password
+	_, err = authService.SignIn(testutil.TestEmail, "wrong password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.Authorize(testAuthorizationRequest("openid"), testutil.TestEmail, testutil.TestPassword, "")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	assert.Nil(t, authService.SendVerificationEmail(testutil.TestEmail))
+	assert.Len(t, notifier.Messages, 2)
+	assert.Nil(t, authService.VerifyEmail(notifier.LastToken(t, testutil.TestEmail)))
+	assert.NotEmpty(t, signInTestUser(t, authService).AccessToken)
+}
@@ -0,0 +1,59 @@
+package authentication
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+// The errors the authentication service returns, the gateways check them with errors.Is to
+// choose the status of their responses
+var (
+	ErrInvalidEmail            = errors.New("The email address is invalid")
+	ErrWeakPassword            = errors.New("The password is too weak")
+	ErrUserExists              = errors.New("The user already exists")
+	ErrUserNotFound            = errors.New("The user doesn't exist")
+	ErrInvalidCredentials      = errors.New("The invalid credentials, please try again.")
+	ErrInvalidToken            = errors.New("The token is invalid")
+	ErrTokenExpired            = errors.New("The token is expired")
+	ErrTokenRevoked            = errors.New("The token is revoked")
+	ErrTokenReused             = errors.New("Refresh token reuse detected, all the tokens of the session are revoked")
+	ErrInsufficientScope       = errors.New("The token doesn't grant the required scope")
+	ErrInvalidMFACode          = errors.New("The authentication code is invalid")
+	ErrTooManyMFAAttempts      = errors.New("Too many invalid authentication codes, please sign in again")
+	ErrMFAEnabled              = errors.New("The multi-factor authentication is already enabled")
+	ErrMFANotEnabled           = errors.New("The multi-factor authentication isn't enabled")
+	ErrInvalidWebAuthnResponse = errors.New("The WebAuthn response is invalid")
+	ErrEmailNotVerified        = errors.New("The email address isn't verified")
+)
+
+// typedError keeps the message of its cause while errors.Is matches it with the sentinel, it's
+// used where the message of the cause is meaningful for the user
+type typedError struct {
+	sentinel error
+	cause    error
+}
+
+func (e *typedError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *typedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *typedError) Unwrap() error {
+	return e.cause
+}
+
+func withType(sentinel, cause error) error {
+	return &typedError{sentinel: sentinel, cause: cause}
+}
+
+// tokenError converts the error of parsing a jwt to ErrTokenExpired or ErrInvalidToken
+func tokenError(err error, message string) error {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return errors.Wrap(ErrTokenExpired, message)
+	}
+	return withType(ErrInvalidToken, errors.Wrap(err, message))
+}
@@ -0,0 +1,114 @@
+package authentication
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ActorClaim is the act claim of RFC 8693, it identifies the client which acts on behalf of the
+// subject and nests the previous actor when an exchanged token is exchanged again
+type ActorClaim struct {
+	Subject string      `json:"sub"`
+	Act     *ActorClaim `json:"act,omitempty"`
+}
+
+// Subjects returns the chain of the actors, the current actor first. It's empty for the tokens
+// which aren't exchanged.
+func (a *ActorClaim) Subjects() []string {
+	subjects := []string{}
+	for actor := a; actor != nil; actor = actor.Act {
+		subjects = append(subjects, actor.Subject)
+	}
+	return subjects
+}
+
+// TokenExchangeRequest holds the parameters of a token exchange request
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	RequestedTokenType string
+	Audience           string
+	Scope              string
+}
+
+// ExchangeToken mints an access token for the confidential client to call another service on
+// behalf of the subject of the access token. The subject token must be issued to the client or
+// have the client as its audience, so a service only exchanges the tokens which are sent to it.
+// The new token is for the audience of the request, its scope can only be narrower and it
+// doesn't outlive the subject token.
+func (a *AuthenticationService) ExchangeToken(clientID, clientSecret string, request TokenExchangeRequest) (TokenResponse, error) {
+	client, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if client.SecretHash == "" {
+		return TokenResponse{}, newOAuthError("unauthorized_client", "Only confidential clients can exchange the tokens")
+	}
+	if request.SubjectTokenType != accessTokenType {
+		return TokenResponse{}, newOAuthError("invalid_request", "Only access tokens can be exchanged")
+	}
+	if request.RequestedTokenType != "" && request.RequestedTokenType != accessTokenType {
+		return TokenResponse{}, newOAuthError("invalid_request", "Only access tokens can be requested")
+	}
+	if request.Audience == "" {
+		return TokenResponse{}, newOAuthError("invalid_target", "The audience is required")
+	}
+	subject, err := a.parseAccessToken(request.SubjectToken)
+	if isTokenError(err) {
+		return TokenResponse{}, newOAuthError("invalid_grant", err.Error())
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if subject.ClientID != client.ID && subject.Audience != client.ID {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The subject token isn't issued to or for the client")
+	}
+	scope, err := downscope(subject.Scope, request.Scope)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	claims, err := a.newAccessTokenClaims(subject.Subject, subject.Data.UserEmail, client.ID, scope)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	claims.Audience = request.Audience
+	claims.Act = &ActorClaim{Subject: client.ID, Act: subject.Act}
+	claims.SessionID = subject.SessionID
+	if claims.ExpiresAt > subject.ExpiresAt {
+		claims.ExpiresAt = subject.ExpiresAt
+	}
+	accessToken, err := a.signToken(claims)
+	if err != nil {
+		a.logger.Println("Unable to get access token")
+		return TokenResponse{}, errors.Wrap(err, "Unable to get access token")
+	}
+	return TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: accessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       claims.ExpiresAt - claims.IssuedAt,
+		Scope:           scope,
+	}, nil
+}
+
+// downscope returns the requested scopes which the subject token grants, the scopes of the
+// subject token are granted when none is requested
+func downscope(subjectScope, requestedScope string) (string, error) {
+	allowed := strings.Fields(subjectScope)
+	requested := strings.Fields(requestedScope)
+	if len(requested) == 0 {
+		return strings.Join(allowed, " "), nil
+	}
+	for _, s := range requested {
+		if !hasScope(strings.Join(allowed, " "), s) {
+			return "", newOAuthError("invalid_scope", "The "+s+" scope isn't granted by the subject token")
+		}
+	}
+	return strings.Join(requested, " "), nil
+}
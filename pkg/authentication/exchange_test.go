@@ -0,0 +1,155 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func exchangeRequest(subjectToken, audience, scope string) TokenExchangeRequest {
+	return TokenExchangeRequest{
+		SubjectToken:     subjectToken,
+		SubjectTokenType: accessTokenType,
+		Audience:         audience,
+		Scope:            scope,
+	}
+}
+
+func parseAccessTokenClaims(t *testing.T, authService *AuthenticationService, accessToken string) AccessTokenCustomClaims {
+	claims := AccessTokenCustomClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, &claims, authService.Keys().VerifyKey)
+	assert.Nil(t, err)
+	return claims
+}
+
+func TestExchangeToken(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "web", Name: "Web", RedirectURIs: []string{testRedirectURI}}, "secret"))
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "billing", Name: "Billing"}, "secret"))
+	request := testAuthorizationRequest("openid email")
+	request.ClientID = "web"
+	code, err := authService.Authorize(request, testutil.TestEmail, testutil.TestPassword, "")
+	assert.Nil(t, err)
+	tokens, err := authService.ExchangeAuthorizationCode("web", "secret", code, testRedirectURI, testCodeVerifier)
+	assert.Nil(t, err)
+	subject := parseAccessTokenClaims(t, authService, tokens.AccessToken)
+	// the token of the client can't manage the account of the user
+	_, err = authService.ValidateFirstPartyAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// only the client of the token exchanges it
+	_, err = authService.ExchangeToken("jobs", "secret", exchangeRequest(tokens.AccessToken, "billing", ""))
+	assertOAuthError(t, err, "invalid_grant")
+	exchanged, err := authService.ExchangeToken("web", "secret", exchangeRequest(tokens.AccessToken, "billing", "email"))
+	assert.Nil(t, err)
+	assert.Equal(t, accessTokenType, exchanged.IssuedTokenType)
+	assert.Equal(t, "email", exchanged.Scope)
+	assert.Empty(t, exchanged.RefreshToken)
+	claims := parseAccessTokenClaims(t, authService, exchanged.AccessToken)
+	assert.Equal(t, subject.Subject, claims.Subject)
+	assert.Equal(t, testutil.TestEmail, claims.Data.UserEmail)
+	assert.Equal(t, "billing", claims.Audience)
+	assert.Equal(t, "web", claims.ClientID)
+	assert.Equal(t, &ActorClaim{Subject: "web"}, claims.Act)
+	assert.Equal(t, subject.SessionID, claims.SessionID)
+	assert.LessOrEqual(t, claims.ExpiresAt, subject.ExpiresAt)
+
+	// the audience exchanges it again, which nests the actors and can't widen the scope
+	_, err = authService.ExchangeToken("jobs", "secret", exchangeRequest(exchanged.AccessToken, "ledger", ""))
+	assertOAuthError(t, err, "invalid_grant")
+	_, err = authService.ExchangeToken("billing", "secret", exchangeRequest(exchanged.AccessToken, "ledger", "openid"))
+	assertOAuthError(t, err, "invalid_scope")
+	again, err := authService.ExchangeToken("billing", "secret", exchangeRequest(exchanged.AccessToken, "ledger", ""))
+	assert.Nil(t, err)
+	assert.Equal(t, "email", again.Scope)
+	claims = parseAccessTokenClaims(t, authService, again.AccessToken)
+	assert.Equal(t, &ActorClaim{Subject: "billing", Act: &ActorClaim{Subject: "web"}}, claims.Act)
+	assert.Equal(t, []string{"billing", "web"}, claims.Act.Subjects())
+}
+
+func TestExchangeFirstPartyToken(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	viper.Set("IDTokenAudience", "gateway")
+	t.Cleanup(func() { viper.Set("IDTokenAudience", "") })
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: "gateway", Name: "Gateway"}, "secret"))
+	tokens := signInTestUser(t, authService)
+	claims := parseAccessTokenClaims(t, authService, tokens.AccessToken)
+	assert.Equal(t, "gateway", claims.Audience)
+	assert.Equal(t, firstPartyScope, claims.Scope)
+
+	// the token is only exchanged by the client of its audience, and the scope is narrowed
+	_, err := authService.ExchangeToken("jobs", "secret", exchangeRequest(tokens.AccessToken, "jobs-api", ""))
+	assertOAuthError(t, err, "invalid_grant")
+	exchanged, err := authService.ExchangeToken("gateway", "secret", exchangeRequest(tokens.AccessToken, "jobs-api", "email"))
+	assert.Nil(t, err)
+	assert.Equal(t, "email", exchanged.Scope)
+	_, err = authService.ExchangeToken("gateway", "secret", exchangeRequest(tokens.AccessToken, "jobs-api", "jobs:read"))
+	assertOAuthError(t, err, "invalid_scope")
+
+	// the exchanged token can't manage the account of the user
+	_, err = authService.ValidateAccessToken(exchanged.AccessToken)
+	assert.Nil(t, err)
+	_, err = authService.ValidateFirstPartyAccessToken(exchanged.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = authService.ValidateFirstPartyAccessToken(tokens.AccessToken)
+	assert.Nil(t, err)
+}
+
+func TestExchangeTokenErrors(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	viper.Set("IDTokenAudience", "jobs")
+	t.Cleanup(func() { viper.Set("IDTokenAudience", "") })
+	tokens := signInTestUser(t, authService)
+
+	_, err := authService.ExchangeToken(testClientID, "", exchangeRequest(tokens.AccessToken, "api", ""))
+	assertOAuthError(t, err, "unauthorized_client")
+	_, err = authService.ExchangeToken("jobs", "secret", exchangeRequest(tokens.AccessToken, "", ""))
+	assertOAuthError(t, err, "invalid_target")
+	_, err = authService.ExchangeToken("jobs", "secret", exchangeRequest(tokens.RefreshToken, "api", ""))
+	assertOAuthError(t, err, "invalid_grant")
+	request := exchangeRequest(tokens.AccessToken, "api", "")
+	request.SubjectTokenType = "urn:ietf:params:oauth:token-type:refresh_token"
+	_, err = authService.ExchangeToken("jobs", "secret", request)
+	assertOAuthError(t, err, "invalid_request")
+
+	assert.Nil(t, authService.Revoke("", "", tokens.AccessToken, ""))
+	_, err = authService.ExchangeToken("jobs", "secret", exchangeRequest(tokens.AccessToken, "api", ""))
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestValidateAccessTokenFor(t *testing.T) {
+	authService := initializeOAuthService(t)
+	viper.Set("IDTokenAudience", "gateway")
+	t.Cleanup(func() { viper.Set("IDTokenAudience", "") })
+	tokens := signInTestUser(t, authService)
+
+	tests := []struct {
+		name     string
+		required AccessTokenRequirements
+		wantErr  error
+	}{
+		{"NoRequirements", AccessTokenRequirements{}, nil},
+		{"Audience", AccessTokenRequirements{Audience: "gateway"}, nil},
+		{"OtherAudience", AccessTokenRequirements{Audience: "billing"}, ErrInvalidToken},
+		{"Scope", AccessTokenRequirements{Scope: "openid email"}, nil},
+		{"MissingScope", AccessTokenRequirements{Scope: "email jobs:read"}, ErrInsufficientScope},
+		{"Client", AccessTokenRequirements{ClientID: "jobs"}, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := authService.ValidateAccessTokenFor(tokens.AccessToken, tt.required)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testutil.TestEmail, claims.Data.UserEmail)
+		})
+	}
+}
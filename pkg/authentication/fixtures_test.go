@@ -0,0 +1,111 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const testUserID = "testUserID"
+
+// mockSessions backs the session and revocation functions of the database mock with in memory maps
+func mockSessions(dbService *database.DatabaseServiceMock) map[string]entity.Session {
+	var mu sync.Mutex
+	sessions := map[string]entity.Session{}
+	revokedTokens := map[string]time.Time{}
+	dbService.MockedRevokeToken = func(id string, expiresAt time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := revokedTokens[id]; ok {
+			return database.ErrTokenRevoked
+		}
+		revokedTokens[id] = expiresAt
+		return nil
+	}
+	dbService.MockedIsTokenRevoked = func(id string) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := revokedTokens[id]
+		return ok, nil
+	}
+	dbService.MockedCreateSession = func(session entity.Session) error {
+		mu.Lock()
+		defer mu.Unlock()
+		session.CreatedAt = time.Now()
+		sessions[session.ID] = session
+		return nil
+	}
+	dbService.MockedGetSession = func(id string) (entity.Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		session, ok := sessions[id]
+		if !ok {
+			return session, database.ErrSessionNotFound
+		}
+		return session, nil
+	}
+	dbService.MockedGetUserSessions = func(email string) ([]entity.Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		var userSessions []entity.Session
+		for _, session := range sessions {
+			if session.Email == email {
+				userSessions = append(userSessions, session)
+			}
+		}
+		sort.Slice(userSessions, func(i, j int) bool {
+			return userSessions[i].CreatedAt.Before(userSessions[j].CreatedAt)
+		})
+		return userSessions, nil
+	}
+	dbService.MockedUseSession = func(id string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		session, ok := sessions[id]
+		if !ok {
+			return database.ErrSessionNotFound
+		}
+		if session.Used {
+			return database.ErrSessionAlreadyUsed
+		}
+		session.Used = true
+		sessions[id] = session
+		return nil
+	}
+	dbService.MockedRevokeSessionFamily = func(familyID string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, session := range sessions {
+			if session.FamilyID == familyID {
+				session.Revoked = true
+				sessions[id] = session
+			}
+		}
+		return nil
+	}
+	return sessions
+}
+
+// mockUser makes the database mock return a signed up user with the TestEmail and TestPassword,
+// the user has no passkey
+func mockUser(dbService *database.DatabaseServiceMock) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(testutil.TestPassword), bcrypt.MinCost)
+	user := entity.User{ID: testUserID, Email: testutil.TestEmail, HashedPassword: string(hashedPassword), TokenHash: "tokenHash"}
+	dbService.MockedGetUser = func(email string) (entity.User, error) {
+		if email != user.Email {
+			return entity.User{}, database.ErrUserNotFound
+		}
+		return user, nil
+	}
+	dbService.MockedUpdateUser = func(updatedUser entity.User) error {
+		user = updatedUser
+		return nil
+	}
+	dbService.MockedGetUserWebAuthnCredentials = func(email string) ([]entity.WebAuthnCredential, error) {
+		return nil, nil
+	}
+}
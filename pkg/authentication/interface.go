@@ -1,10 +1,49 @@
 package authentication
 
-import "github.com/Hamifthi/authentication_microservice/entity"
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/go-webauthn/webauthn/protocol"
+)
 
 type AuthenticationInterface interface {
 	SignUp(email, password string) error
 	SignIn(email, password string) (entity.Tokens, error)
+	SendVerificationEmail(email string) error
+	VerifyEmail(token string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) error
+	ChangePassword(email, oldPassword, newPassword string, logoutAll bool, sessionID string) error
+	VerifyMFA(mfaToken, code string) (entity.Tokens, error)
+	EnrollMFA(email string) (MFAEnrollment, error)
+	ConfirmMFA(email, code string) ([]string, error)
+	DisableMFA(email, code string) error
+	BeginWebAuthnRegistration(email, password string) (WebAuthnRegistration, error)
+	FinishWebAuthnRegistration(email, session string, credential protocol.CredentialCreationResponse) error
+	BeginWebAuthnLogin(mfaToken string) (WebAuthnLogin, error)
+	FinishWebAuthnLogin(session string, credential protocol.CredentialAssertionResponse) (entity.Tokens, error)
 	ValidateRefreshToken(refreshToken string) (entity.User, error)
-	RefreshAccessToken(entity.User) (string, error)
+	RefreshAccessToken(refreshToken string) (entity.Tokens, error)
+	Logout(refreshToken string) error
+	LogoutAll(email string) error
+	ValidateAccessToken(accessToken string) (AccessTokenCustomClaims, error)
+	ValidateAccessTokenFor(accessToken string, required AccessTokenRequirements) (AccessTokenCustomClaims, error)
+	ValidateFirstPartyAccessToken(accessToken string) (AccessTokenCustomClaims, error)
+	GetUser(email string) (entity.User, error)
+	GetActiveSessions(email string) ([]entity.Session, error)
+	GetJWKS() (JSONWebKeySet, error)
+	GetOpenIDConfiguration() OpenIDConfiguration
+	GetUserInfo(accessToken string) (UserInfo, error)
+	ValidateRedirect(clientID, redirectURI string) (entity.Client, error)
+	ValidateAuthorizationRequest(request AuthorizationRequest) (entity.Client, error)
+	Authorize(request AuthorizationRequest, email, password, mfaCode string) (string, error)
+	ExchangeAuthorizationCode(clientID, clientSecret, code, redirectURI, codeVerifier string) (TokenResponse, error)
+	RefreshClientToken(clientID, clientSecret, refreshToken string) (TokenResponse, error)
+	ClientCredentials(clientID, clientSecret, scope string) (TokenResponse, error)
+	Introspect(clientID, clientSecret, token, tokenTypeHint string) (IntrospectionResponse, error)
+	Revoke(clientID, clientSecret, token, tokenTypeHint string) error
+	AuthorizeDevice(clientID, clientSecret, scope string) (DeviceAuthorizationResponse, error)
+	GetDeviceAuthorization(userCode string) (entity.DeviceCode, entity.Client, error)
+	VerifyDevice(userCode, email, password, mfaCode string, approve bool) error
+	ExchangeDeviceCode(clientID, clientSecret, deviceCode string) (TokenResponse, error)
+	ExchangeToken(clientID, clientSecret string, request TokenExchangeRequest) (TokenResponse, error)
 }
@@ -0,0 +1,106 @@
+package authentication
+
+import "github.com/pkg/errors"
+
+// IntrospectionResponse is the state of a token as RFC 7662 describes it. Only the revocation
+// status is reported for the inactive tokens, which is set when the token is revoked rather than
+// expired or malformed.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Revoked   bool   `json:"revoked,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// Introspect reports whether the access or refresh token is active to the confidential client of a
+// resource server. The hint is the token_type_hint of the request, it only changes the order in
+// which the token types are tried.
+func (a *AuthenticationService) Introspect(clientID, clientSecret, token, tokenTypeHint string) (IntrospectionResponse, error) {
+	client, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return IntrospectionResponse{}, err
+	}
+	if client.SecretHash == "" {
+		return IntrospectionResponse{}, newOAuthError("unauthorized_client", "Only confidential clients can introspect the tokens")
+	}
+	introspectors := []func(string) (IntrospectionResponse, error){a.introspectAccessToken, a.introspectRefreshToken}
+	if tokenTypeHint == "refresh_token" {
+		introspectors[0], introspectors[1] = introspectors[1], introspectors[0]
+	}
+	inactive := IntrospectionResponse{}
+	for _, introspect := range introspectors {
+		response, err := introspect(token)
+		if err != nil {
+			return IntrospectionResponse{}, err
+		}
+		if response.Active {
+			return response, nil
+		}
+		inactive.Revoked = inactive.Revoked || response.Revoked
+	}
+	return inactive, nil
+}
+
+func (a *AuthenticationService) introspectAccessToken(accessToken string) (IntrospectionResponse, error) {
+	claims, err := a.parseAccessToken(accessToken)
+	if errors.Is(err, ErrTokenRevoked) {
+		return IntrospectionResponse{Revoked: true}, nil
+	}
+	if isTokenError(err) {
+		return IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return IntrospectionResponse{}, err
+	}
+	return IntrospectionResponse{
+		Active:    true,
+		Subject:   claims.Subject,
+		Username:  claims.Data.UserEmail,
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+		Audience:  claims.Audience,
+		TokenType: "access_token",
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Issuer:    claims.Issuer,
+	}, nil
+}
+
+// introspectRefreshToken checks the refresh token without consuming it, so a used token is
+// reported as inactive rather than revoking its family
+func (a *AuthenticationService) introspectRefreshToken(refreshToken string) (IntrospectionResponse, error) {
+	claims, user, session, err := a.parseRefreshToken(refreshToken)
+	if errors.Is(err, ErrTokenRevoked) {
+		return IntrospectionResponse{Revoked: true}, nil
+	}
+	if isTokenError(err) {
+		return IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return IntrospectionResponse{}, err
+	}
+	revoked, err := a.isSessionRevoked(session)
+	if err != nil {
+		return IntrospectionResponse{}, err
+	}
+	if revoked || session.Used {
+		return IntrospectionResponse{Revoked: revoked}, nil
+	}
+	return IntrospectionResponse{
+		Active:    true,
+		Subject:   user.ID,
+		Username:  user.Email,
+		ClientID:  session.ClientID,
+		Scope:     session.Scope,
+		TokenType: "refresh_token",
+		ExpiresAt: claims.ExpiresAt,
+		Issuer:    claims.Issuer,
+	}, nil
+}
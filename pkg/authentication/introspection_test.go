@@ -0,0 +1,75 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIntrospectAccessToken(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	tokens := signInTestUser(t, authService)
+
+	response, err := authService.Introspect("jobs", "secret", tokens.AccessToken, "")
+	assert.Nil(t, err)
+	assert.True(t, response.Active)
+	assert.Equal(t, "access_token", response.TokenType)
+	assert.Equal(t, testutil.TestEmail, response.Username)
+	assert.NotEmpty(t, response.Subject)
+	assert.NotZero(t, response.ExpiresAt)
+
+	clientTokens, err := authService.ClientCredentials("jobs", "secret", "jobs:read")
+	assert.Nil(t, err)
+	response, err = authService.Introspect("jobs", "secret", clientTokens.AccessToken, "refresh_token")
+	assert.Nil(t, err)
+	assert.True(t, response.Active)
+	assert.Equal(t, "jobs", response.Subject)
+	assert.Equal(t, "jobs", response.ClientID)
+	assert.Equal(t, "jobs:read", response.Scope)
+
+	response, err = authService.Introspect("jobs", "secret", "malformed", "")
+	assert.Nil(t, err)
+	assert.Equal(t, IntrospectionResponse{}, response)
+	response, err = authService.Introspect("jobs", "secret", tokens.IDToken, "")
+	assert.Nil(t, err)
+	assert.False(t, response.Active)
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	tokens := signInTestUser(t, authService)
+
+	response, err := authService.Introspect("jobs", "secret", tokens.RefreshToken, "refresh_token")
+	assert.Nil(t, err)
+	assert.True(t, response.Active)
+	assert.Equal(t, "refresh_token", response.TokenType)
+	assert.Equal(t, testutil.TestEmail, response.Username)
+
+	// introspecting doesn't consume the token
+	refreshed, err := authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+	response, err = authService.Introspect("jobs", "secret", tokens.RefreshToken, "")
+	assert.Nil(t, err)
+	assert.Equal(t, IntrospectionResponse{}, response)
+	response, err = authService.Introspect("jobs", "secret", refreshed.RefreshToken, "")
+	assert.Nil(t, err)
+	assert.True(t, response.Active)
+
+	assert.Nil(t, authService.Logout(refreshed.RefreshToken))
+	response, err = authService.Introspect("jobs", "secret", refreshed.RefreshToken, "")
+	assert.Nil(t, err)
+	assert.Equal(t, IntrospectionResponse{Revoked: true}, response)
+}
+
+func TestIntrospectRequiresConfidentialClient(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	tokens := signInTestUser(t, authService)
+
+	_, err := authService.Introspect("jobs", "wrong", tokens.AccessToken, "")
+	assertOAuthError(t, err, "invalid_client")
+	_, err = authService.Introspect(testClientID, "", tokens.AccessToken, "")
+	assertOAuthError(t, err, "unauthorized_client")
+}
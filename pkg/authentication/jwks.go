@@ -0,0 +1,45 @@
+package authentication
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JSONWebKey is the RFC 7517 representation of a public key which verifies the tokens
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func newJSONWebKey(id string, publicKey *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Kid: id,
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
+
+// JWKS returns the keys which verify the tokens, the set changes as soon as the keys rotate
+func (k *KeyManager) JWKS() (JSONWebKeySet, error) {
+	keys, err := k.VerificationKeys()
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range keys {
+		keySet.Keys = append(keySet.Keys, newJSONWebKey(key.ID, &key.PrivateKey.PublicKey))
+	}
+	return keySet, nil
+}
@@ -0,0 +1,392 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key is an RSA key which signs the tokens, after the rotation it only verifies them until it retires
+type Key struct {
+	ID         string
+	PrivateKey *rsa.PrivateKey
+	CreatedAt  time.Time
+	// RetiresAt is zero for the signing key, it's set to the time the last token signed by the
+	// key expires once another key replaces it
+	RetiresAt time.Time
+}
+
+func (k Key) retired(now time.Time) bool {
+	return !k.RetiresAt.IsZero() && !now.Before(k.RetiresAt)
+}
+
+// KeyManager keeps the parsed signing keys in memory. The key of the TokenPrivateKeyPath and
+// the rotated keys of the TokenKeyDir are loaded once, and the newest of them signs the tokens.
+// It's replaced when the file changes, another instance stores a rotated key or the
+// KeyRotationInterval passes, the previous keys still verify the tokens they signed until those
+// tokens expire.
+type KeyManager struct {
+	mu         sync.RWMutex
+	keys       map[string]*Key
+	signingKey *Key
+	keyModTime time.Time
+	rotatedAt  time.Time
+	logger     *log.Logger
+}
+
+func NewKeyManager(logger *log.Logger) *KeyManager {
+	return &KeyManager{
+		keys:   map[string]*Key{},
+		logger: logger,
+	}
+}
+
+// keyID is the RFC 7638 thumbprint of the public key
+func keyID(publicKey *rsa.PublicKey) string {
+	jwk := newJSONWebKey("", publicKey)
+	thumbprint := sha256.Sum256([]byte(fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)))
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:])
+}
+
+func readKeyFile(key string) ([]byte, os.FileInfo, error) {
+	path, err := internal.GetEnv(key)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error reading %s from environment", key)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error reading %s", key)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error reading %s", key)
+	}
+	return content, info, nil
+}
+
+// keyDir is the TokenKeyDir which stores the rotated keys, the rotation is refused without it
+func keyDir() string {
+	dir, _ := internal.GetEnv("TokenKeyDir")
+	return dir
+}
+
+// Load reads the private key from the TokenPrivateKeyPath and the rotated keys of the TokenKeyDir,
+// the newest of them becomes the signing key. The TokenPublicKeyPath must hold the public key of
+// the TokenPrivateKeyPath.
+func (k *KeyManager) Load() error {
+	signBytes, info, err := readKeyFile("TokenPrivateKeyPath")
+	if err != nil {
+		k.logger.Println("[Error] reading the token private key")
+		return err
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		k.logger.Println("[Error] unable to parse the token private key")
+		return errors.Wrap(err, "Unable to parse the token private key")
+	}
+	verifyBytes, _, err := readKeyFile("TokenPublicKeyPath")
+	if err != nil {
+		k.logger.Println("[Error] reading the token public key")
+		return err
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
+	if err != nil {
+		k.logger.Println("[Error] unable to parse the token public key")
+		return errors.Wrap(err, "Unable to parse the token public key")
+	}
+	if !publicKey.Equal(&privateKey.PublicKey) {
+		k.logger.Println("[Error] the token public key doesn't belong to the private key")
+		return errors.New("The token public key doesn't belong to the private key")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keyModTime = info.ModTime()
+	k.addKey(privateKey, info.ModTime())
+	return k.loadKeyDir()
+}
+
+// loadKeyDir adds the rotated keys of the TokenKeyDir which aren't loaded yet, the file of a key
+// is named by its id and its modification time is the creation time of the key
+func (k *KeyManager) loadKeyDir() error {
+	dir := keyDir()
+	if dir == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		k.logger.Println("[Error] reading the token key directory")
+		return errors.Wrap(err, "Error reading the token key directory")
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), ".pem")
+		if _, ok := k.keys[id]; ok || file.IsDir() || id == file.Name() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			k.logger.Println("[Error] reading a rotated token key")
+			return errors.Wrapf(err, "Error reading the %s rotated token key", file.Name())
+		}
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(content)
+		if err != nil {
+			k.logger.Println("[Error] unable to parse a rotated token key")
+			return errors.Wrapf(err, "Unable to parse the %s rotated token key", file.Name())
+		}
+		k.addKey(privateKey, file.ModTime())
+	}
+	return nil
+}
+
+// Rotate generates a new signing key and stores it in the TokenKeyDir before using it, so the
+// tokens it signs are verified after a restart and by the other instances which share the
+// directory. The rotation is refused without the TokenKeyDir.
+func (k *KeyManager) Rotate() error {
+	dir := keyDir()
+	if dir == "" {
+		k.logger.Println("[Error] rotating the signing key without TokenKeyDir")
+		return errors.New("TokenKeyDir must be set to rotate the signing key")
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		k.logger.Println("[Error] generating the signing key")
+		return errors.Wrap(err, "Error generating the signing key")
+	}
+	createdAt, err := storeKey(dir, privateKey)
+	if err != nil {
+		k.logger.Println("[Error] storing the signing key")
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.addKey(privateKey, createdAt)
+	return nil
+}
+
+// storeKey writes the private key to the directory as a PEM file which is named by its id, it's
+// written to a temporary file first so the other instances never read a partial key. It returns
+// the modification time of the file.
+func storeKey(dir string, privateKey *rsa.PrivateKey) (time.Time, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Error creating the token key directory")
+	}
+	file, err := ioutil.TempFile(dir, ".key-")
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Error creating the token key file")
+	}
+	defer os.Remove(file.Name())
+	err = pem.Encode(file, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Error writing the token key file")
+	}
+	path := filepath.Join(dir, keyID(&privateKey.PublicKey)+".pem")
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Error writing the token key file")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Error reading the token key file")
+	}
+	return info.ModTime(), nil
+}
+
+// addKey adds the key which is created at the given time. The newest key signs the tokens, and
+// the key it replaces retires once the tokens which it signed until then expire.
+func (k *KeyManager) addKey(privateKey *rsa.PrivateKey, createdAt time.Time) {
+	id := keyID(&privateKey.PublicKey)
+	key, ok := k.keys[id]
+	if !ok {
+		key = &Key{ID: id, PrivateKey: privateKey, CreatedAt: createdAt}
+		k.keys[id] = key
+	}
+	if k.signingKey != nil && (k.signingKey.ID == id || !key.CreatedAt.After(k.signingKey.CreatedAt)) {
+		// an older key which is loaded after the signing key was replaced by it at the latest
+		if !ok && k.signingKey.ID != id {
+			key.RetiresAt = k.signingKey.CreatedAt.Add(tokenLifetime())
+		}
+		return
+	}
+	if k.signingKey != nil {
+		k.signingKey.RetiresAt = key.CreatedAt.Add(tokenLifetime())
+	}
+	key.RetiresAt = time.Time{}
+	k.signingKey = key
+	k.rotatedAt = key.CreatedAt
+}
+
+// tokenLifetime is how long a token lives at most, which is the time a replaced key still
+// has to verify the tokens. The email tokens are signed with the same keys, so the links
+// keep working after a rotation.
+func tokenLifetime() time.Duration {
+	lifetime := emailVerificationLifetime
+	if passwordResetLifetime > lifetime {
+		lifetime = passwordResetLifetime
+	}
+	for _, key := range []string{"JwtExpiration", "RefreshTokenExpiration"} {
+		value, _ := internal.GetEnv(key)
+		minutes, _ := strconv.Atoi(value)
+		if time.Minute*time.Duration(minutes) > lifetime {
+			lifetime = time.Minute * time.Duration(minutes)
+		}
+	}
+	return lifetime
+}
+
+func (k *KeyManager) ensureLoaded() error {
+	k.mu.RLock()
+	loaded := k.signingKey != nil
+	k.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	return k.Load()
+}
+
+// SigningKey returns the key which signs the new tokens
+func (k *KeyManager) SigningKey() (Key, error) {
+	if err := k.ensureLoaded(); err != nil {
+		return Key{}, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return *k.signingKey, nil
+}
+
+// VerificationKeys returns the keys which aren't retired, ordered by their creation time
+func (k *KeyManager) VerificationKeys() ([]Key, error) {
+	if err := k.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := []Key{}
+	for _, key := range k.keys {
+		if !key.retired(now) {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// VerifyKey is the jwt.Keyfunc which returns the public key of the kid header of the token,
+// the tokens without kid are verified by the signing key
+func (k *KeyManager) VerifyKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		k.logger.Println("[Error] unexpected signing method in auth token")
+		return nil, errors.New("Unexpected signing method in auth token")
+	}
+	if err := k.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	id, ok := token.Header["kid"].(string)
+	if !ok {
+		return &k.signingKey.PrivateKey.PublicKey, nil
+	}
+	key, ok := k.keys[id]
+	if !ok || key.retired(time.Now()) {
+		k.logger.Println("[Error] the key of the token is unknown or retired")
+		return nil, errors.New("The key of the token is unknown or retired")
+	}
+	return &key.PrivateKey.PublicKey, nil
+}
+
+// Run reloads the signing key when its file changes and rotates it every KeyRotationInterval
+// minutes until the context is done, the checks happen every KeyCheckInterval seconds
+func (k *KeyManager) Run(ctx context.Context) {
+	checkInterval := time.Minute
+	if value, err := internal.GetEnv("KeyCheckInterval"); err == nil {
+		if seconds, _ := strconv.Atoi(value); seconds > 0 {
+			checkInterval = time.Second * time.Duration(seconds)
+		}
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			k.check()
+		}
+	}
+}
+
+func (k *KeyManager) check() {
+	rotationValue, _ := internal.GetEnv("KeyRotationInterval")
+	rotationInterval, _ := strconv.Atoi(rotationValue)
+	path, _ := internal.GetEnv("TokenPrivateKeyPath")
+
+	k.mu.Lock()
+	now := time.Now()
+	for id, key := range k.keys {
+		if key.retired(now) {
+			delete(k.keys, id)
+			k.removeKeyFile(id)
+		}
+	}
+	if err := k.loadKeyDir(); err != nil {
+		k.logger.Printf("[Error] loading the rotated token keys has %s error", err)
+	}
+	keyModTime, rotatedAt := k.keyModTime, k.rotatedAt
+	k.mu.Unlock()
+
+	if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(keyModTime) {
+		k.logger.Println("The token private key is changed, reloading it")
+		if err := k.Load(); err != nil {
+			k.logger.Printf("[Error] reloading the token private key has %s error", err)
+		}
+		return
+	}
+	if rotationInterval > 0 && now.Sub(rotatedAt) >= time.Minute*time.Duration(rotationInterval) {
+		k.logger.Println("Rotating the token signing key")
+		if err := k.Rotate(); err != nil {
+			k.logger.Printf("[Error] rotating the token signing key has %s error", err)
+		}
+	}
+}
+
+// removeKeyFile removes the file of the retired key from the TokenKeyDir, so it isn't loaded again
+func (k *KeyManager) removeKeyFile(id string) {
+	dir := keyDir()
+	if dir == "" {
+		return
+	}
+	err := os.Remove(filepath.Join(dir, id+".pem"))
+	if err != nil && !os.IsNotExist(err) {
+		k.logger.Printf("[Error] removing the retired token key has %s error", err)
+	}
+}
@@ -0,0 +1,204 @@
+package authentication
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+func tokenKeyID(t *testing.T, tokenString string) string {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &AccessTokenCustomClaims{})
+	assert.Nil(t, err)
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestTokensHaveKeyID(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+
+	signingKey, err := authService.Keys().SigningKey()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, signingKey.ID)
+	assert.Equal(t, signingKey.ID, tokenKeyID(t, tokens.AccessToken))
+	assert.Equal(t, signingKey.ID, tokenKeyID(t, tokens.RefreshToken))
+}
+
+func TestKeysAreLoadedOnce(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+
+	assert.Nil(t, os.Remove(viper.GetString("TokenPrivateKeyPath")))
+	assert.Nil(t, os.Remove(viper.GetString("TokenPublicKeyPath")))
+	_, err := authService.ValidateAccessToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	signInTestUser(t, authService)
+}
+
+func TestRotatedKeyStillVerifiesItsTokens(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	oldTokens := signInTestUser(t, authService)
+
+	assert.Nil(t, authService.Keys().Rotate())
+	newTokens := signInTestUser(t, authService)
+	assert.NotEqual(t, tokenKeyID(t, oldTokens.AccessToken), tokenKeyID(t, newTokens.AccessToken))
+	_, err := authService.ValidateAccessToken(oldTokens.AccessToken)
+	assert.Nil(t, err)
+	_, err = authService.RefreshAccessToken(oldTokens.RefreshToken)
+	assert.Nil(t, err)
+	keys, err := authService.Keys().VerificationKeys()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+}
+
+func TestRetiredKeyIsRejected(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+	oldKeyID := tokenKeyID(t, tokens.AccessToken)
+
+	assert.Nil(t, authService.Keys().Rotate())
+	// the old key lives as long as the email verification links
+	oldKey := authService.Keys().keys[oldKeyID]
+	assert.True(t, oldKey.RetiresAt.After(time.Now().Add(emailVerificationLifetime-time.Minute)))
+	authService.Keys().mu.Lock()
+	oldKey.RetiresAt = time.Now()
+	authService.Keys().mu.Unlock()
+	_, err := authService.ValidateAccessToken(tokens.AccessToken)
+	assert.NotNil(t, err)
+	keys, err := authService.Keys().VerificationKeys()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestKeyFileChangeReloadsSigningKey(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	oldTokens := signInTestUser(t, authService)
+
+	privateKeyPath := viper.GetString("TokenPrivateKeyPath")
+	testutil.WriteKeyPair(t, privateKeyPath, viper.GetString("TokenPublicKeyPath"))
+	later := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(privateKeyPath, later, later))
+	authService.Keys().check()
+
+	newTokens := signInTestUser(t, authService)
+	assert.NotEqual(t, tokenKeyID(t, oldTokens.AccessToken), tokenKeyID(t, newTokens.AccessToken))
+	_, err := authService.ValidateAccessToken(oldTokens.AccessToken)
+	assert.Nil(t, err)
+}
+
+func TestScheduledRotation(t *testing.T) {
+	authService, _ := initializeAuthAndDBService(t)
+	oldKey, err := authService.Keys().SigningKey()
+	assert.Nil(t, err)
+
+	authService.Keys().check()
+	key, err := authService.Keys().SigningKey()
+	assert.Nil(t, err)
+	assert.Equal(t, oldKey.ID, key.ID, "rotation is disabled without KeyRotationInterval")
+
+	viper.Set("KeyRotationInterval", "1")
+	t.Cleanup(func() { viper.Set("KeyRotationInterval", "") })
+	authService.Keys().rotatedAt = time.Now().Add(-time.Minute)
+	authService.Keys().check()
+	key, err = authService.Keys().SigningKey()
+	assert.Nil(t, err)
+	assert.NotEqual(t, oldKey.ID, key.ID)
+}
+
+func TestJWKSVerifiesTokens(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+
+	keySet, err := authService.GetJWKS()
+	assert.Nil(t, err)
+	if !assert.Len(t, keySet.Keys, 1) {
+		return
+	}
+	jwk := keySet.Keys[0]
+	assert.Equal(t, "RSA", jwk.Kty)
+	assert.Equal(t, "RS256", jwk.Alg)
+	assert.Equal(t, "sig", jwk.Use)
+	assert.Equal(t, tokenKeyID(t, tokens.AccessToken), jwk.Kid)
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	assert.Nil(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	assert.Nil(t, err)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, &AccessTokenCustomClaims{}, func(*jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, authService.Keys().Rotate())
+	keySet, err = authService.GetJWKS()
+	assert.Nil(t, err)
+	assert.Len(t, keySet.Keys, 2)
+}
+
+func TestRotationRequiresKeyDir(t *testing.T) {
+	authService, _ := initializeAuthAndDBService(t)
+	oldKey, err := authService.Keys().SigningKey()
+	assert.Nil(t, err)
+	viper.Set("TokenKeyDir", "")
+	viper.Set("KeyRotationInterval", "1")
+	t.Cleanup(func() { viper.Set("KeyRotationInterval", "") })
+
+	assert.NotNil(t, authService.CheckConfig())
+	assert.NotNil(t, authService.Keys().Rotate())
+	key, err := authService.Keys().SigningKey()
+	assert.Nil(t, err)
+	assert.Equal(t, oldKey.ID, key.ID)
+}
+
+func TestRotatedKeysAreShared(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	oldTokens := signInTestUser(t, authService)
+	assert.Nil(t, authService.Keys().Rotate())
+	newTokens := signInTestUser(t, authService)
+
+	// a restarted instance signs with the rotated key and verifies the tokens of both keys
+	restarted := NewKeyManager(authService.logger)
+	assert.Nil(t, restarted.Load())
+	key, err := restarted.SigningKey()
+	assert.Nil(t, err)
+	assert.Equal(t, tokenKeyID(t, newTokens.AccessToken), key.ID)
+	keys, err := restarted.VerificationKeys()
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+	for _, tokens := range []entity.Tokens{oldTokens, newTokens} {
+		_, err = jwt.ParseWithClaims(tokens.AccessToken, &AccessTokenCustomClaims{}, restarted.VerifyKey)
+		assert.Nil(t, err)
+	}
+
+	// a running instance picks up the key which another one rotates
+	assert.Nil(t, restarted.Rotate())
+	authService.Keys().check()
+	key, err = authService.Keys().SigningKey()
+	assert.Nil(t, err)
+	rotatedKey, err := restarted.SigningKey()
+	assert.Nil(t, err)
+	assert.Equal(t, rotatedKey.ID, key.ID)
+}
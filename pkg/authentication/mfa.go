@@ -0,0 +1,401 @@
+package authentication
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"image/png"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	mfaChallengeLifetime = 5 * time.Minute
+	// maxMFAAttempts is how many invalid codes the user can send before the codes are locked for
+	// mfaLockoutDuration
+	maxMFAAttempts     = 5
+	mfaLockoutDuration = 15 * time.Minute
+	totpPeriod         = 30
+	totpQRCodeSize     = 256
+	// recoveryCodeCharset has no similar looking characters, the codes are two groups of five
+	recoveryCodeCharset = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength  = 10
+	recoveryCodeCount   = 10
+)
+
+// mfaIssuer is the name of the service which the authenticator apps show next to the account
+func mfaIssuer() string {
+	name, err := internal.GetEnv("MFAIssuer")
+	if err != nil || name == "" {
+		return defaultIssuer
+	}
+	return name
+}
+
+// MFAEnrollment is the TOTP secret of the user, QRCode is the PNG image of its otpauth URI
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode []byte `json:"qr_code"`
+}
+
+type MFAChallengeData struct {
+	UserEmail string `json:"userEmail"`
+	TokenType string `json:"tokenType"`
+}
+
+// MFAChallengeCustomClaims are the claims of the challenge token which signing in returns when the
+// user has MFA enabled, it's exchanged for the tokens of the user with a code by VerifyMFA
+type MFAChallengeCustomClaims struct {
+	Data MFAChallengeData `json:"data"`
+	jwt.StandardClaims
+}
+
+// matchTOTP checks the code against the time steps around now and returns the matching step
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	for skew := -1; skew <= 1; skew++ {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeRecoveryCode makes the recovery code which the user typed comparable to the issued one
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// generateRecoveryCodes returns the recovery codes which are shown to the user once and their
+// hashes which are stored
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code := make([]byte, recoveryCodeLength)
+		for i := range code {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeCharset))))
+			if err != nil {
+				return nil, nil, err
+			}
+			code[i] = recoveryCodeCharset[n.Int64()]
+		}
+		codes = append(codes, string(code[:5])+"-"+string(code[5:]))
+		hashes = append(hashes, hashCode(string(code)))
+	}
+	return codes, hashes, nil
+}
+
+func (a *AuthenticationService) updateUser(user entity.User) error {
+	err := a.dbService.UpdateUser(user)
+	if err != nil {
+		a.logger.Println("[Error] updating the user in database")
+		return errors.Wrap(err, "Error updating the user in database")
+	}
+	return nil
+}
+
+// EnrollMFA generates a new TOTP secret for the user, MFA is enabled once the user confirms it
+// with a code of the authenticator app
+func (a *AuthenticationService) EnrollMFA(email string) (MFAEnrollment, error) {
+	user, err := a.GetUser(email)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if user.MFAEnabled {
+		return MFAEnrollment{}, ErrMFAEnabled
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      mfaIssuer(),
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		a.logger.Println("[Error] generating the TOTP secret")
+		return MFAEnrollment{}, errors.Wrap(err, "Error generating the TOTP secret")
+	}
+	image, err := key.Image(totpQRCodeSize, totpQRCodeSize)
+	if err != nil {
+		a.logger.Println("[Error] generating the QR code of the TOTP secret")
+		return MFAEnrollment{}, errors.Wrap(err, "Error generating the QR code of the TOTP secret")
+	}
+	qrCode := bytes.Buffer{}
+	err = png.Encode(&qrCode, image)
+	if err != nil {
+		a.logger.Println("[Error] encoding the QR code of the TOTP secret")
+		return MFAEnrollment{}, errors.Wrap(err, "Error encoding the QR code of the TOTP secret")
+	}
+	user.TOTPSecret = key.Secret()
+	user.TOTPLastCounter = 0
+	err = a.updateUser(user)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	return MFAEnrollment{Secret: key.Secret(), URI: key.URL(), QRCode: qrCode.Bytes()}, nil
+}
+
+// ConfirmMFA enables MFA when the code matches the enrolled secret, it returns the recovery codes
+// which sign in the user when the authenticator app is lost
+func (a *AuthenticationService) ConfirmMFA(email, code string) ([]string, error) {
+	user, err := a.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.Wrap(ErrMFANotEnabled, "The user hasn't enrolled a TOTP secret")
+	}
+	counter, ok := matchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		a.logger.Println("[Error] generating the recovery codes")
+		return nil, errors.Wrap(err, "Error generating the recovery codes")
+	}
+	user.MFAEnabled = true
+	user.TOTPLastCounter = counter
+	user.MFAFailedAttempts = 0
+	user.RecoveryCodes = hashes
+	err = a.updateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	a.alert(user.Email, mfaEnabledNotification)
+	return codes, nil
+}
+
+// DisableMFA turns off MFA of the user with a TOTP or a recovery code
+func (a *AuthenticationService) DisableMFA(email, code string) error {
+	user, err := a.GetUser(email)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+	user, err = a.verifyMFACode(user, code)
+	if err != nil {
+		return err
+	}
+	user.MFAEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	user.RecoveryCodes = nil
+	err = a.updateUser(user)
+	if err != nil {
+		return err
+	}
+	a.alert(user.Email, mfaDisabledNotification)
+	return nil
+}
+
+// verifyMFACode accepts a TOTP code which isn't used yet or an unused recovery code, which is
+// removed. Every attempt is counted before the code is checked and after maxMFAAttempts of them
+// every code is rejected for mfaLockoutDuration, signing in again doesn't lift the lockout. The
+// database does the counting and the use of the codes atomically, so concurrent attempts can't
+// get past the lockout or use a code twice.
+func (a *AuthenticationService) verifyMFACode(user entity.User, code string) (entity.User, error) {
+	now := time.Now()
+	err := a.dbService.CountMFAAttempt(user.Email, maxMFAAttempts, now, now.Add(mfaLockoutDuration))
+	if errors.Is(err, database.ErrMFALocked) {
+		return user, ErrTooManyMFAAttempts
+	}
+	if err != nil {
+		a.logger.Println("[Error] occurred while counting the MFA attempt")
+		return user, errors.Wrap(err, "Error occurred while counting the MFA attempt")
+	}
+	if counter, ok := matchTOTP(user.TOTPSecret, code, now); ok {
+		err = a.dbService.UseTOTPCounter(user.Email, counter)
+		if err == nil {
+			user.TOTPLastCounter = counter
+			return resetMFAAttempts(user), nil
+		}
+		if !errors.Is(err, database.ErrTOTPCounterUsed) {
+			a.logger.Println("[Error] occurred while using the TOTP code")
+			return user, errors.Wrap(err, "Error occurred while using the TOTP code")
+		}
+	}
+	hash := hashCode(normalizeRecoveryCode(code))
+	err = a.dbService.UseRecoveryCode(user.Email, hash)
+	if err == nil {
+		user.RecoveryCodes = removeRecoveryCode(user.RecoveryCodes, hash)
+		return resetMFAAttempts(user), nil
+	}
+	if !errors.Is(err, database.ErrRecoveryCodeNotFound) {
+		a.logger.Println("[Error] occurred while using the recovery code")
+		return user, errors.Wrap(err, "Error occurred while using the recovery code")
+	}
+	return user, ErrInvalidMFACode
+}
+
+// resetMFAAttempts makes the user match the database after a code is accepted
+func resetMFAAttempts(user entity.User) entity.User {
+	user.MFAFailedAttempts = 0
+	user.MFALockedUntil = time.Time{}
+	return user
+}
+
+// removeRecoveryCode returns the recovery code hashes without the hash
+func removeRecoveryCode(recoveryCodes []string, hash string) []string {
+	for i, recoveryCode := range recoveryCodes {
+		if recoveryCode == hash {
+			return append(recoveryCodes[:i:i], recoveryCodes[i+1:]...)
+		}
+	}
+	return recoveryCodes
+}
+
+// authenticateMFA checks the credentials of the user and the code of the second factor when the
+// user has MFA enabled, it's used where signing in happens in a single step. The passkeys can't be
+// used there, so the users whose only second factor is a passkey are rejected.
+func (a *AuthenticationService) authenticateMFA(email, password, code string) (entity.User, error) {
+	user, err := a.authenticate(email, password)
+	if err != nil {
+		return user, err
+	}
+	if !user.MFAEnabled {
+		hasSecondFactor, err := a.hasSecondFactor(user)
+		if err != nil || !hasSecondFactor {
+			return user, err
+		}
+		return user, withType(ErrInvalidMFACode, errors.New("The passkey of the user can't be verified in a single step"))
+	}
+	return a.verifyMFACode(user, code)
+}
+
+// generateMFAChallenge issues the challenge token of the user who signed in with the password
+func (a *AuthenticationService) generateMFAChallenge(user entity.User) (string, error) {
+	now := time.Now()
+	claims := MFAChallengeCustomClaims{
+		Data: MFAChallengeData{UserEmail: user.Email, TokenType: "mfa"},
+		StandardClaims: jwt.StandardClaims{
+			Id:        internal.GenerateID(),
+			Subject:   user.ID,
+			Issuer:    issuer(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(mfaChallengeLifetime).Unix(),
+		},
+	}
+	return a.signToken(claims)
+}
+
+// parseMFAChallenge verifies the challenge token which isn't used yet and loads its user
+func (a *AuthenticationService) parseMFAChallenge(mfaToken string) (MFAChallengeCustomClaims, entity.User, error) {
+	claims := MFAChallengeCustomClaims{}
+	token, err := jwt.ParseWithClaims(mfaToken, &claims, a.keys.VerifyKey)
+	if err != nil {
+		a.logger.Println("[Error] parsing the claims from MFA token")
+		return claims, entity.User{}, tokenError(err, "Error parsing the claims from MFA token")
+	}
+	if !token.Valid || claims.Id == "" || claims.Data.UserEmail == "" || claims.Data.TokenType != "mfa" {
+		a.logger.Println("[Error] getting claims from token")
+		return claims, entity.User{}, errors.Wrap(ErrInvalidToken, "Error getting claims from token")
+	}
+	err = a.checkSingleUseToken(claims.Id, "MFA token is already used")
+	if err != nil {
+		return claims, entity.User{}, err
+	}
+	user, err := a.GetUser(claims.Data.UserEmail)
+	if errors.Is(err, ErrUserNotFound) {
+		return claims, user, errors.Wrap(ErrInvalidToken, "The user of the MFA token doesn't exist")
+	}
+	if err != nil {
+		return claims, user, err
+	}
+	hasSecondFactor, err := a.hasSecondFactor(user)
+	if err != nil {
+		return claims, user, err
+	}
+	if !hasSecondFactor {
+		return claims, user, errors.Wrap(ErrInvalidToken, "The user of the MFA token has no second factor")
+	}
+	return claims, user, nil
+}
+
+// hasSecondFactor reports whether signing in with the password needs a second factor, which is
+// a TOTP code or a passkey
+func (a *AuthenticationService) hasSecondFactor(user entity.User) (bool, error) {
+	if user.MFAEnabled {
+		return true, nil
+	}
+	credentials, err := a.dbService.GetUserWebAuthnCredentials(user.Email)
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the WebAuthn credentials from database")
+		return false, errors.Wrap(err, "Error can't retrieve the WebAuthn credentials from database")
+	}
+	return len(credentials) > 0, nil
+}
+
+// checkSingleUseToken returns ErrTokenRevoked when the token id is in the revocation list
+func (a *AuthenticationService) checkSingleUseToken(id, message string) error {
+	revoked, err := a.dbService.IsTokenRevoked(id)
+	if err != nil {
+		a.logger.Println("[Error] can't check the revocation list")
+		return errors.Wrap(err, "Error can't check the revocation list")
+	}
+	if revoked {
+		return errors.Wrap(ErrTokenRevoked, message)
+	}
+	return nil
+}
+
+// useSingleUseToken claims the token by adding its id to the revocation list, it returns
+// ErrTokenRevoked when the token is already used. Only one of the concurrent uses of the token
+// gets past it.
+func (a *AuthenticationService) useSingleUseToken(id string, expiresAt time.Time, message string) error {
+	err := a.dbService.RevokeToken(id, expiresAt)
+	if errors.Is(err, database.ErrTokenRevoked) {
+		return errors.Wrap(ErrTokenRevoked, message)
+	}
+	if err != nil {
+		a.logger.Println("[Error] adding the token to the revocation list")
+		return errors.Wrap(err, "Error adding the token to the revocation list")
+	}
+	return nil
+}
+
+// VerifyMFA exchanges the challenge token of signing in and a TOTP or recovery code for the tokens
+// of the user, the challenge can only be used once
+func (a *AuthenticationService) VerifyMFA(mfaToken, code string) (entity.Tokens, error) {
+	emptyTokens := entity.Tokens{AccessToken: "", RefreshToken: ""}
+	claims, user, err := a.parseMFAChallenge(mfaToken)
+	if err != nil {
+		return emptyTokens, err
+	}
+	if !user.MFAEnabled {
+		return emptyTokens, errors.Wrap(ErrMFANotEnabled, "The user has no TOTP, the passkey verifies the MFA token")
+	}
+	user, err = a.verifyMFACode(user, code)
+	if err != nil && !errors.Is(err, ErrTooManyMFAAttempts) {
+		return emptyTokens, err
+	}
+	// the challenge is done once it's verified or once it has no attempts left
+	revokeErr := a.useSingleUseToken(claims.Id, time.Unix(claims.ExpiresAt, 0), "MFA token is already used")
+	if revokeErr != nil {
+		return emptyTokens, revokeErr
+	}
+	if err != nil {
+		return emptyTokens, err
+	}
+	return a.issueTokens(user, entity.Session{FamilyID: internal.GenerateID()}, "")
+}
@@ -0,0 +1,166 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enableTestMFA enrolls and confirms MFA of the test user, it returns the TOTP secret and the
+// recovery codes. The current time step is used by confirming, so the next code is the one of
+// the next time step.
+func enableTestMFA(t *testing.T, authService *AuthenticationService) (string, []string) {
+	enrollment, err := authService.EnrollMFA(testutil.TestEmail)
+	assert.Nil(t, err)
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	assert.Nil(t, err)
+	recoveryCodes, err := authService.ConfirmMFA(testutil.TestEmail, code)
+	assert.Nil(t, err)
+	return enrollment.Secret, recoveryCodes
+}
+
+func nextTOTPCode(t *testing.T, secret string) string {
+	code, err := totp.GenerateCode(secret, time.Now().Add(totpPeriod*time.Second))
+	assert.Nil(t, err)
+	return code
+}
+
+func TestEnrollMFA(t *testing.T) {
+	authService := initializeOAuthService(t)
+	enrollment, err := authService.EnrollMFA(testutil.TestEmail)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/"))
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+	assert.Equal(t, "\x89PNG", string(enrollment.QRCode[:4]))
+
+	// signing in doesn't need MFA until the secret is confirmed
+	tokens := signInTestUser(t, authService)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Empty(t, tokens.MFAToken)
+	_, err = authService.ConfirmMFA(testutil.TestEmail, "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	assert.Nil(t, err)
+	recoveryCodes, err := authService.ConfirmMFA(testutil.TestEmail, code)
+	assert.Nil(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+
+	_, err = authService.EnrollMFA(testutil.TestEmail)
+	assert.ErrorIs(t, err, ErrMFAEnabled)
+	_, err = authService.ConfirmMFA(testutil.TestEmail, code)
+	assert.ErrorIs(t, err, ErrMFAEnabled)
+}
+
+func TestSignInWithMFA(t *testing.T) {
+	authService := initializeOAuthService(t)
+	secret, _ := enableTestMFA(t, authService)
+
+	challenge := signInTestUser(t, authService)
+	assert.NotEmpty(t, challenge.MFAToken)
+	assert.Empty(t, challenge.AccessToken)
+	assert.Empty(t, challenge.RefreshToken)
+	// the challenge isn't an access or refresh token
+	_, err := authService.ValidateAccessToken(challenge.MFAToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = authService.RefreshAccessToken(challenge.MFAToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	code := nextTOTPCode(t, secret)
+	tokens, err := authService.VerifyMFA(challenge.MFAToken, code)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	claims, err := authService.ValidateAccessToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, claims.Data.UserEmail)
+
+	// the challenge and the code can only be used once
+	_, err = authService.VerifyMFA(challenge.MFAToken, code)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = authService.VerifyMFA(signInTestUser(t, authService).MFAToken, code)
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	_, err = authService.VerifyMFA("invalid", code)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestSignInWithRecoveryCode(t *testing.T) {
+	authService := initializeOAuthService(t)
+	_, recoveryCodes := enableTestMFA(t, authService)
+
+	challenge := signInTestUser(t, authService)
+	_, err := authService.VerifyMFA(challenge.MFAToken, strings.ToUpper(recoveryCodes[0]))
+	assert.Nil(t, err)
+	_, err = authService.VerifyMFA(signInTestUser(t, authService).MFAToken, recoveryCodes[0])
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	_, err = authService.VerifyMFA(signInTestUser(t, authService).MFAToken, recoveryCodes[1])
+	assert.Nil(t, err)
+}
+
+func TestTooManyMFAAttempts(t *testing.T) {
+	authService := initializeOAuthService(t)
+	secret, _ := enableTestMFA(t, authService)
+
+	challenge := signInTestUser(t, authService)
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err := authService.VerifyMFA(challenge.MFAToken, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	_, err := authService.VerifyMFA(challenge.MFAToken, nextTOTPCode(t, secret))
+	assert.ErrorIs(t, err, ErrTooManyMFAAttempts)
+	_, err = authService.VerifyMFA(challenge.MFAToken, nextTOTPCode(t, secret))
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// signing in again doesn't lift the lockout
+	_, err = authService.VerifyMFA(signInTestUser(t, authService).MFAToken, nextTOTPCode(t, secret))
+	assert.ErrorIs(t, err, ErrTooManyMFAAttempts)
+
+	// the codes are accepted again once the lockout is over
+	user, err := authService.GetUser(testutil.TestEmail)
+	assert.Nil(t, err)
+	user.MFALockedUntil = time.Now().Add(-time.Second)
+	assert.Nil(t, authService.dbService.UpdateUser(user))
+	_, err = authService.VerifyMFA(signInTestUser(t, authService).MFAToken, nextTOTPCode(t, secret))
+	assert.Nil(t, err)
+}
+
+func TestTooManyMFAAttemptsInSingleStep(t *testing.T) {
+	authService := initializeOAuthService(t)
+	secret, _ := enableTestMFA(t, authService)
+
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err := authService.Authorize(testAuthorizationRequest("openid"), testutil.TestEmail, testutil.TestPassword, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	_, err := authService.Authorize(
+		testAuthorizationRequest("openid"), testutil.TestEmail, testutil.TestPassword, nextTOTPCode(t, secret),
+	)
+	assert.ErrorIs(t, err, ErrTooManyMFAAttempts)
+}
+
+func TestDisableMFA(t *testing.T) {
+	authService := initializeOAuthService(t)
+	assert.ErrorIs(t, authService.DisableMFA(testutil.TestEmail, "000000"), ErrMFANotEnabled)
+	_, recoveryCodes := enableTestMFA(t, authService)
+
+	assert.ErrorIs(t, authService.DisableMFA(testutil.TestEmail, "000000"), ErrInvalidMFACode)
+	assert.Nil(t, authService.DisableMFA(testutil.TestEmail, recoveryCodes[0]))
+	tokens := signInTestUser(t, authService)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Empty(t, tokens.MFAToken)
+}
+
+func TestAuthorizeWithMFA(t *testing.T) {
+	authService := initializeOAuthService(t)
+	secret, _ := enableTestMFA(t, authService)
+
+	_, err := authService.Authorize(testAuthorizationRequest("openid"), testutil.TestEmail, testutil.TestPassword, "")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	code, err := authService.Authorize(
+		testAuthorizationRequest("openid"), testutil.TestEmail, testutil.TestPassword, nextTOTPCode(t, secret),
+	)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, code)
+}
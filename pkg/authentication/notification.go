@@ -0,0 +1,82 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/notification"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	emailVerificationNotification = "email_verification"
+	passwordResetNotification     = "password_reset"
+	passwordChangedNotification   = "password_changed"
+	mfaEnabledNotification        = "mfa_enabled"
+	mfaDisabledNotification       = "mfa_disabled"
+	passkeyAddedNotification      = "passkey_added"
+)
+
+// notificationLocale is the locale of the notification templates, it's en by default
+func notificationLocale() string {
+	locale, err := internal.GetEnv("NotificationLocale")
+	if err != nil || locale == "" {
+		return notification.DefaultLocale
+	}
+	return locale
+}
+
+// baseURL is the public URL of the REST server which the links in the notifications point to
+func baseURL() string {
+	base, _ := internal.GetEnv("BaseURL")
+	return strings.TrimSuffix(base, "/")
+}
+
+// SetNotifier replaces the notifier which delivers the notifications of the service, they are
+// dropped until one is set
+func (a *AuthenticationService) SetNotifier(notifier notification.Notifier) {
+	a.notifier = notifier
+}
+
+// SetNotificationTemplates replaces the embedded notification templates
+func (a *AuthenticationService) SetNotificationTemplates(templates *notification.Templates) {
+	a.templates = templates
+}
+
+// render renders the template of the notification for the email with the data, the email is
+// added to the data
+func (a *AuthenticationService) render(email, name string, data map[string]interface{}) (notification.Message, error) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["Email"] = email
+	message, err := a.templates.Render(name, notificationLocale(), data)
+	if err != nil {
+		a.logger.Printf("[Error] rendering the %s notification", name)
+		return message, errors.Wrapf(err, "Error rendering the %s notification", name)
+	}
+	message.To = email
+	return message, nil
+}
+
+// notify renders the notification for the email with the data and sends it
+func (a *AuthenticationService) notify(email, name string, data map[string]interface{}) error {
+	message, err := a.render(email, name, data)
+	if err != nil {
+		return err
+	}
+	err = a.notifier.Send(message)
+	if err != nil {
+		a.logger.Printf("[Error] sending the %s notification to %s", name, email)
+		return errors.Wrapf(err, "Error sending the %s notification", name)
+	}
+	return nil
+}
+
+// alert sends the security alert of the notification, failing to send it is only logged so it
+// doesn't fail the action which is already done
+func (a *AuthenticationService) alert(email, name string) {
+	err := a.notify(email, name, nil)
+	if err != nil {
+		a.logger.Printf("[Error] sending the %s alert to %s. Err: %s", name, email, err)
+	}
+}
@@ -0,0 +1,65 @@
+package authentication
+
+import (
+	"bytes"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/Hamifthi/authentication_microservice/pkg/notification"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+)
+
+func lastSubject(notifier *testutil.Notifier) string {
+	if len(notifier.Messages) == 0 {
+		return ""
+	}
+	return notifier.Messages[len(notifier.Messages)-1].Subject
+}
+
+func TestSecurityAlerts(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	secret, _ := enableTestMFA(t, authService)
+	assert.Equal(t, "Multi-factor authentication is enabled", lastSubject(notifier))
+	assert.Nil(t, authService.DisableMFA(testutil.TestEmail, nextTOTPCode(t, secret)))
+	assert.Equal(t, "Multi-factor authentication is disabled", lastSubject(notifier))
+	registerTestAuthenticator(t, authService)
+	assert.Equal(t, "A passkey is added to your account", lastSubject(notifier))
+	for _, message := range notifier.Messages {
+		assert.Equal(t, testutil.TestEmail, message.To)
+		assert.Contains(t, message.Text, testutil.TestEmail)
+	}
+}
+
+func TestNotificationLocale(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	viper.Set("NotificationLocale", "de-AT")
+	t.Cleanup(func() { viper.Set("NotificationLocale", "") })
+	assert.Nil(t, authService.SendVerificationEmail(testutil.TestEmail))
+	assert.Equal(t, "Bestätigen Sie Ihre E-Mail-Adresse", lastSubject(notifier))
+	assert.Contains(t, notifier.Messages[len(notifier.Messages)-1].HTML, testutil.TestBaseURL+"/verify-email?token=")
+	assert.NotEmpty(t, notifier.LastToken(t, testutil.TestEmail))
+
+	// a broken notifier fails the verification email but not the signing up
+	authService.SetNotifier(failingNotifier{})
+	assert.NotNil(t, authService.SendVerificationEmail(testutil.TestEmail))
+	assert.Nil(t, authService.SignUp("other@test.com", testutil.TestPassword))
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Send(notification.Message) error {
+	return notification.ErrQueueFull
+}
+
+func TestDefaultNotifierKeepsTokensOutOfLogs(t *testing.T) {
+	testutil.InitializeConfig(t)
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", log.LstdFlags)
+	authService, err := New(database.NewMemorySrv(logger), logger)
+	assert.Nil(t, err)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Nil(t, authService.SendVerificationEmail(testutil.TestEmail))
+	assert.NotContains(t, logs.String(), "token=")
+}
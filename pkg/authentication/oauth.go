@@ -0,0 +1,353 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const authorizationCodeLifetime = 5 * time.Minute
+
+// supportedScopes are the scopes the clients are able to request
+var supportedScopes = []string{"openid", "email"}
+
+// firstPartyScope is the scope of the access tokens of signing in directly, they grant every
+// supported scope so the tokens which are exchanged for them can be narrowed
+var firstPartyScope = strings.Join(supportedScopes, " ")
+
+// OAuthError is an error of the OAuth 2.0 protocol, its code is reported to the client as it is
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// AuthorizationRequest holds the parameters of an authorization code request with PKCE
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenResponse is the successful response of the token endpoint, IssuedTokenType is only set for
+// the token exchange grant
+type TokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+func hasScope(scope, value string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hashCode is how the authorization codes are stored, so a leaked database can't redeem them
+func hashCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// clientRegistration is a client of the clients file, its secret is hashed before it's stored
+type clientRegistration struct {
+	entity.Client
+	Secret string `json:"secret"`
+}
+
+// RegisterClient adds the client or replaces the client which has the same id. The client is
+// confidential when it has a secret, only the hash of the secret is stored.
+func (a *AuthenticationService) RegisterClient(client entity.Client, secret string) error {
+	client.SecretHash = ""
+	if secret != "" {
+		secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return errors.Wrap(err, "The hashing process of client secret went wrong")
+		}
+		client.SecretHash = string(secretHash)
+	}
+	err := a.dbService.SaveClient(client)
+	if err != nil {
+		a.logger.Println("[Error] storing the client")
+		return errors.Wrap(err, "Error storing the client")
+	}
+	return nil
+}
+
+// LoadClients registers the clients of the JSON file
+func (a *AuthenticationService) LoadClients(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		a.logger.Println("[Error] reading the OAuth clients file")
+		return errors.Wrap(err, "Error reading the OAuth clients file")
+	}
+	var registrations []clientRegistration
+	err = json.Unmarshal(content, &registrations)
+	if err != nil {
+		a.logger.Println("[Error] parsing the OAuth clients file")
+		return errors.Wrap(err, "Error parsing the OAuth clients file")
+	}
+	for _, registration := range registrations {
+		err = a.RegisterClient(registration.Client, registration.Secret)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AuthenticationService) getClient(clientID string) (entity.Client, error) {
+	client, err := a.dbService.GetClient(clientID)
+	if errors.Is(err, database.ErrClientNotFound) {
+		return client, newOAuthError("invalid_client", "The client is unknown")
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the client from database")
+		return client, errors.Wrap(err, "Error can't retrieve the client from database")
+	}
+	return client, nil
+}
+
+// authenticateClient checks the secret of a confidential client, a public client mustn't send one
+func (a *AuthenticationService) authenticateClient(clientID, clientSecret string) (entity.Client, error) {
+	client, err := a.getClient(clientID)
+	if err != nil {
+		return client, err
+	}
+	if client.SecretHash == "" {
+		if clientSecret != "" {
+			return client, newOAuthError("invalid_client", "The client is public and has no secret")
+		}
+		return client, nil
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret))
+	if err != nil {
+		return client, newOAuthError("invalid_client", "The client authentication failed")
+	}
+	return client, nil
+}
+
+// ValidateRedirect checks the client and its redirect URI. Their errors mustn't be sent to the
+// redirect URI, so they're checked before anything else of the authorization request.
+func (a *AuthenticationService) ValidateRedirect(clientID, redirectURI string) (entity.Client, error) {
+	client, err := a.getClient(clientID)
+	if err != nil {
+		return client, err
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		return client, newOAuthError("invalid_request", "The redirect URI isn't registered for the client")
+	}
+	return client, nil
+}
+
+// ValidateAuthorizationRequest checks the authorization request, only the authorization code
+// response type with an S256 PKCE challenge is supported
+func (a *AuthenticationService) ValidateAuthorizationRequest(request AuthorizationRequest) (entity.Client, error) {
+	client, err := a.ValidateRedirect(request.ClientID, request.RedirectURI)
+	if err != nil {
+		return client, err
+	}
+	if request.ResponseType != "code" {
+		return client, newOAuthError("unsupported_response_type", "Only the code response type is supported")
+	}
+	if request.CodeChallengeMethod != "S256" || len(request.CodeChallenge) < 43 || len(request.CodeChallenge) > 128 {
+		return client, newOAuthError("invalid_request", "A code challenge with the S256 method is required")
+	}
+	return client, validateScope(request.Scope)
+}
+
+// validateScope checks the scopes which a client requests on behalf of a user
+func validateScope(scope string) error {
+	for _, s := range strings.Fields(scope) {
+		supported := false
+		for _, supportedScope := range supportedScopes {
+			supported = supported || s == supportedScope
+		}
+		if !supported {
+			return newOAuthError("invalid_scope", "The "+s+" scope isn't supported")
+		}
+	}
+	return nil
+}
+
+// Authorize signs in the user and returns the authorization code of the request, which the
+// client exchanges for the tokens at the token endpoint. The MFA code is only checked for the
+// users who have MFA enabled.
+func (a *AuthenticationService) Authorize(request AuthorizationRequest, email, password, mfaCode string) (string, error) {
+	_, err := a.ValidateAuthorizationRequest(request)
+	if err != nil {
+		return "", err
+	}
+	user, err := a.authenticateMFA(email, password, mfaCode)
+	if err != nil {
+		return "", err
+	}
+	code := internal.GenerateID() + internal.GenerateID()
+	err = a.dbService.CreateAuthorizationCode(entity.AuthorizationCode{
+		ID:            hashCode(code),
+		FamilyID:      internal.GenerateID(),
+		ClientID:      request.ClientID,
+		Email:         user.Email,
+		RedirectURI:   request.RedirectURI,
+		Scope:         strings.Join(strings.Fields(request.Scope), " "),
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeLifetime),
+	})
+	if err != nil {
+		a.logger.Println("[Error] storing the authorization code")
+		return "", errors.Wrap(err, "Error storing the authorization code")
+	}
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems the authorization code for the tokens, the code verifier
+// must match the challenge of the authorization request. Redeeming a code twice revokes the
+// refresh tokens which are issued for it.
+func (a *AuthenticationService) ExchangeAuthorizationCode(clientID, clientSecret, code, redirectURI, codeVerifier string) (TokenResponse, error) {
+	_, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	authorizationCode, err := a.dbService.GetAuthorizationCode(hashCode(code))
+	if errors.Is(err, database.ErrAuthorizationCodeNotFound) {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The authorization code is invalid")
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the authorization code from database")
+		return TokenResponse{}, errors.Wrap(err, "Error can't retrieve the authorization code from database")
+	}
+	if authorizationCode.ClientID != clientID || authorizationCode.RedirectURI != redirectURI {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The authorization code is issued to another client or redirect URI")
+	}
+	if authorizationCode.ExpiresAt.Before(time.Now()) {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The authorization code is expired")
+	}
+	verifierHash := sha256.Sum256([]byte(codeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(verifierHash[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(authorizationCode.CodeChallenge)) != 1 {
+		return TokenResponse{}, newOAuthError("invalid_grant", "The code verifier doesn't match the code challenge")
+	}
+	err = a.dbService.UseAuthorizationCode(authorizationCode.ID)
+	if errors.Is(err, database.ErrAuthorizationCodeAlreadyUsed) {
+		a.logger.Printf("[Error] authorization code reuse detected, revoking the %s family", authorizationCode.FamilyID)
+		if err := a.revokeSessionFamily(authorizationCode.FamilyID); err != nil {
+			a.logger.Println("[Error] revoking the family of the authorization code")
+		}
+		return TokenResponse{}, newOAuthError("invalid_grant", "The authorization code is already used")
+	}
+	if err != nil {
+		a.logger.Println("[Error] marking the authorization code as used")
+		return TokenResponse{}, errors.Wrap(err, "Error marking the authorization code as used")
+	}
+	user, err := a.GetUser(authorizationCode.Email)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	tokens, err := a.issueTokens(user, entity.Session{
+		FamilyID: authorizationCode.FamilyID,
+		ClientID: clientID,
+		Scope:    authorizationCode.Scope,
+	}, authorizationCode.Nonce)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return newTokenResponse(tokens, authorizationCode.Scope)
+}
+
+// RefreshClientToken rotates the refresh token which is issued to the client at the token endpoint
+func (a *AuthenticationService) RefreshClientToken(clientID, clientSecret, refreshToken string) (TokenResponse, error) {
+	_, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	tokens, session, err := a.rotateRefreshToken(refreshToken, clientID)
+	if isTokenError(err) {
+		return TokenResponse{}, newOAuthError("invalid_grant", err.Error())
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return newTokenResponse(tokens, session.Scope)
+}
+
+// ClientCredentials issues an access token to the confidential client itself, its subject is the
+// client. The requested scopes must be allowed for the client, all of them are granted by default.
+func (a *AuthenticationService) ClientCredentials(clientID, clientSecret, scope string) (TokenResponse, error) {
+	client, err := a.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if client.SecretHash == "" {
+		return TokenResponse{}, newOAuthError("unauthorized_client", "Only confidential clients can use the client credentials grant")
+	}
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, s := range scopes {
+		if !client.HasScope(s) {
+			return TokenResponse{}, newOAuthError("invalid_scope", "The "+s+" scope isn't allowed for the client")
+		}
+	}
+	grantedScope := strings.Join(scopes, " ")
+	accessToken, err := a.generateAccessToken(client.ID, "", client.ID, grantedScope)
+	if err != nil {
+		a.logger.Println("Unable to get access token")
+		return TokenResponse{}, errors.Wrap(err, "Unable to get access token")
+	}
+	return newTokenResponse(entity.Tokens{AccessToken: accessToken}, grantedScope)
+}
+
+// isTokenError reports whether the token is rejected, rather than failing to be checked
+func isTokenError(err error) bool {
+	for _, tokenErr := range []error{ErrInvalidToken, ErrTokenExpired, ErrTokenRevoked, ErrTokenReused} {
+		if errors.Is(err, tokenErr) {
+			return true
+		}
+	}
+	return false
+}
+
+func newTokenResponse(tokens entity.Tokens, scope string) (TokenResponse, error) {
+	lifetime, err := accessTokenLifetime()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(lifetime.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        scope,
+	}, nil
+}
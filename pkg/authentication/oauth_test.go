@@ -0,0 +1,203 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const (
+	testClientID     = "testClient"
+	testRedirectURI  = "https://client.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// initializeOAuthService creates the auth service on the memory database with a signed up user
+// and a registered client
+func initializeOAuthService(t *testing.T) *AuthenticationService {
+	testutil.InitializeConfig(t)
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	authService, err := New(database.NewMemorySrv(logger), logger)
+	assert.Nil(t, err)
+	assert.Nil(t, authService.SignUp(testutil.TestEmail, testutil.TestPassword))
+	assert.Nil(t, authService.RegisterClient(entity.Client{ID: testClientID, Name: "Test", RedirectURIs: []string{testRedirectURI}}, ""))
+	return authService
+}
+
+func codeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func testAuthorizationRequest(scope string) AuthorizationRequest {
+	return AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            testClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		State:               "state",
+		Nonce:               "nonce",
+		CodeChallenge:       codeChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+func authorizeTestUser(t *testing.T, authService *AuthenticationService, scope string) string {
+	code, err := authService.Authorize(testAuthorizationRequest(scope), testutil.TestEmail, testutil.TestPassword, "")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, code)
+	return code
+}
+
+func assertOAuthError(t *testing.T, err error, code string) {
+	oauthErr := &OAuthError{}
+	if assert.ErrorAs(t, err, &oauthErr) {
+		assert.Equal(t, code, oauthErr.Code)
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	authService := initializeOAuthService(t)
+	code := authorizeTestUser(t, authService, "openid email")
+
+	tokens, err := authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, testCodeVerifier)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int64(15*60), tokens.ExpiresIn)
+	assert.Equal(t, "openid email", tokens.Scope)
+	claims, err := authService.ValidateAccessToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, testClientID, claims.ClientID)
+	assert.Equal(t, "openid email", claims.Scope)
+	idTokenClaims := parseIDToken(t, authService, tokens.IDToken)
+	assert.Equal(t, testClientID, idTokenClaims.Audience)
+	assert.Equal(t, "nonce", idTokenClaims.Nonce)
+
+	refreshed, err := authService.RefreshClientToken(testClientID, "", tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "openid email", refreshed.Scope)
+	assert.NotEmpty(t, refreshed.IDToken)
+	_, err = authService.RefreshClientToken("otherClient", "", refreshed.RefreshToken)
+	assertOAuthError(t, err, "invalid_client")
+	_, err = authService.RefreshAccessToken(refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAuthorizationCodeWithoutOpenIDScope(t *testing.T) {
+	authService := initializeOAuthService(t)
+	code := authorizeTestUser(t, authService, "")
+	tokens, err := authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, testCodeVerifier)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Empty(t, tokens.IDToken)
+}
+
+func TestAuthorizationCodeWrongVerifier(t *testing.T) {
+	authService := initializeOAuthService(t)
+	code := authorizeTestUser(t, authService, "openid")
+
+	_, err := authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, "wrong"+testCodeVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+	_, err = authService.ExchangeAuthorizationCode(testClientID, "", code, "https://attacker.example.com", testCodeVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+	_, err = authService.ExchangeAuthorizationCode(testClientID, "", "unknown", testRedirectURI, testCodeVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+	_, err = authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, testCodeVerifier)
+	assert.Nil(t, err)
+}
+
+func TestAuthorizationCodeReuseRevokesTokens(t *testing.T) {
+	authService := initializeOAuthService(t)
+	code := authorizeTestUser(t, authService, "openid")
+	tokens, err := authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, testCodeVerifier)
+	assert.Nil(t, err)
+
+	_, err = authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, testCodeVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+	_, err = authService.RefreshClientToken(testClientID, "", tokens.RefreshToken)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestValidateAuthorizationRequest(t *testing.T) {
+	authService := initializeOAuthService(t)
+	_, err := authService.ValidateAuthorizationRequest(testAuthorizationRequest("openid email"))
+	assert.Nil(t, err)
+
+	request := testAuthorizationRequest("openid")
+	request.ClientID = "unknown"
+	_, err = authService.ValidateAuthorizationRequest(request)
+	assertOAuthError(t, err, "invalid_client")
+	request = testAuthorizationRequest("openid")
+	request.RedirectURI = "https://attacker.example.com"
+	_, err = authService.ValidateAuthorizationRequest(request)
+	assertOAuthError(t, err, "invalid_request")
+	request = testAuthorizationRequest("openid")
+	request.ResponseType = "token"
+	_, err = authService.ValidateAuthorizationRequest(request)
+	assertOAuthError(t, err, "unsupported_response_type")
+	request = testAuthorizationRequest("openid")
+	request.CodeChallengeMethod = "plain"
+	_, err = authService.ValidateAuthorizationRequest(request)
+	assertOAuthError(t, err, "invalid_request")
+	_, err = authService.ValidateAuthorizationRequest(testAuthorizationRequest("openid admin"))
+	assertOAuthError(t, err, "invalid_scope")
+
+	_, err = authService.Authorize(testAuthorizationRequest("openid"), testutil.TestEmail, "wrong", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func registerServiceClient(t *testing.T, authService *AuthenticationService) {
+	assert.Nil(t, authService.RegisterClient(entity.Client{
+		ID:     "jobs",
+		Name:   "Jobs",
+		Scopes: []string{"jobs:read", "jobs:write"},
+	}, "secret"))
+}
+
+func TestClientCredentials(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+
+	tokens, err := authService.ClientCredentials("jobs", "secret", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "jobs:read jobs:write", tokens.Scope)
+	assert.Empty(t, tokens.RefreshToken)
+	assert.Empty(t, tokens.IDToken)
+	tokens, err = authService.ClientCredentials("jobs", "secret", "jobs:read")
+	assert.Nil(t, err)
+	assert.Equal(t, "jobs:read", tokens.Scope)
+
+	claims := AccessTokenCustomClaims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, &claims, authService.Keys().VerifyKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "jobs", claims.Subject)
+	assert.Equal(t, "jobs", claims.ClientID)
+	assert.Equal(t, "jobs:read", claims.Scope)
+	assert.Empty(t, claims.Data.UserEmail)
+	// the tokens of the clients can't be used as the tokens of a user
+	_, err = authService.ValidateAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestClientCredentialsErrors(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+
+	_, err := authService.ClientCredentials("jobs", "wrong", "")
+	assertOAuthError(t, err, "invalid_client")
+	_, err = authService.ClientCredentials("unknown", "secret", "")
+	assertOAuthError(t, err, "invalid_client")
+	_, err = authService.ClientCredentials("jobs", "secret", "jobs:read admin")
+	assertOAuthError(t, err, "invalid_scope")
+	_, err = authService.ClientCredentials(testClientID, "", "")
+	assertOAuthError(t, err, "unauthorized_client")
+	_, err = authService.ClientCredentials(testClientID, "secret", "")
+	assertOAuthError(t, err, "invalid_client")
+}
@@ -0,0 +1,130 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const defaultIssuer = "authService"
+
+// issuer is the iss claim of the tokens, it's the public URL of the REST server when the
+// service acts as an OpenID Connect provider
+func issuer() string {
+	iss, err := internal.GetEnv("Issuer")
+	if err != nil || iss == "" {
+		return defaultIssuer
+	}
+	return strings.TrimSuffix(iss, "/")
+}
+
+// idTokenAudience is the aud claim of the ID and access tokens issued by signing in directly
+func idTokenAudience() string {
+	audience, err := internal.GetEnv("IDTokenAudience")
+	if err != nil || audience == "" {
+		return issuer()
+	}
+	return audience
+}
+
+// IDTokenCustomClaims are the claims of the OpenID Connect ID token, the subject is the id of the user
+type IDTokenCustomClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce,omitempty"`
+	jwt.StandardClaims
+}
+
+// UserInfo is the response of the OpenID Connect userinfo endpoint
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document of the service
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// GetOpenIDConfiguration returns the discovery document, its endpoints are relative to the issuer
+func (a *AuthenticationService) GetOpenIDConfiguration() OpenIDConfiguration {
+	iss := issuer()
+	return OpenIDConfiguration{
+		Issuer:                            iss,
+		AuthorizationEndpoint:             iss + "/authorize",
+		TokenEndpoint:                     iss + "/token",
+		UserinfoEndpoint:                  iss + "/userinfo",
+		IntrospectionEndpoint:             iss + "/introspect",
+		RevocationEndpoint:                iss + "/revoke",
+		DeviceAuthorizationEndpoint:       iss + "/device/code",
+		JwksURI:                           iss + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", deviceCodeGrantType, tokenExchangeGrantType},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   supportedScopes,
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "email_verified"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+	}
+}
+
+// generateIDToken issues the ID token of the user for the audience, the nonce of the
+// authentication request is echoed when it's given
+func (a *AuthenticationService) generateIDToken(user entity.User, audience, nonce string) (string, error) {
+	lifetime, err := accessTokenLifetime()
+	if err != nil {
+		a.logger.Println("[Error] reading jwt expiration key")
+		return "", err
+	}
+
+	now := time.Now()
+	claims := IDTokenCustomClaims{
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Nonce:         nonce,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   user.ID,
+			Audience:  audience,
+			Issuer:    issuer(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(lifetime).Unix(),
+		},
+	}
+	return a.signToken(claims)
+}
+
+// GetUserInfo returns the claims of the user who owns the access token
+func (a *AuthenticationService) GetUserInfo(accessToken string) (UserInfo, error) {
+	claims, err := a.ValidateAccessToken(accessToken)
+	if err != nil {
+		return UserInfo{}, err
+	}
+	user, err := a.GetUser(claims.Data.UserEmail)
+	if errors.Is(err, ErrUserNotFound) {
+		return UserInfo{}, errors.Wrap(ErrInvalidToken, "The user of the access token doesn't exist")
+	}
+	if err != nil {
+		return UserInfo{}, err
+	}
+	return UserInfo{Subject: user.ID, Email: user.Email, EmailVerified: user.EmailVerified}, nil
+}
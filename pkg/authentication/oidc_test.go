@@ -0,0 +1,83 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func parseIDToken(t *testing.T, authService *AuthenticationService, idToken string) IDTokenCustomClaims {
+	claims := IDTokenCustomClaims{}
+	_, err := jwt.ParseWithClaims(idToken, &claims, authService.Keys().VerifyKey)
+	assert.Nil(t, err)
+	return claims
+}
+
+func TestSignInIssuesIDToken(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	viper.Set("Issuer", "https://auth.example.com/")
+	viper.Set("IDTokenAudience", "frontend")
+	t.Cleanup(func() {
+		viper.Set("Issuer", "")
+		viper.Set("IDTokenAudience", "")
+	})
+
+	tokens := signInTestUser(t, authService)
+	claims := parseIDToken(t, authService, tokens.IDToken)
+	assert.Equal(t, testUserID, claims.Subject)
+	assert.Equal(t, "frontend", claims.Audience)
+	assert.Equal(t, "https://auth.example.com", claims.Issuer)
+	assert.Equal(t, testutil.TestEmail, claims.Email)
+	assert.False(t, claims.EmailVerified)
+	assert.Empty(t, claims.Nonce)
+	assert.InDelta(t, time.Now().Unix(), claims.IssuedAt, 5)
+
+	refreshed, err := authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, testUserID, parseIDToken(t, authService, refreshed.IDToken).Subject)
+}
+
+func TestIDTokenNonceAndDefaults(t *testing.T) {
+	authService, _ := initializeAuthAndDBService(t)
+	user := entity.User{ID: testUserID, Email: testutil.TestEmail}
+	idToken, err := authService.generateIDToken(user, "client", "nonce")
+	assert.Nil(t, err)
+	claims := parseIDToken(t, authService, idToken)
+	assert.Equal(t, "nonce", claims.Nonce)
+	assert.Equal(t, "client", claims.Audience)
+	assert.Equal(t, defaultIssuer, claims.Issuer)
+}
+
+func TestGetUserInfo(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+
+	userInfo, err := authService.GetUserInfo(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, UserInfo{Subject: testUserID, Email: testutil.TestEmail}, userInfo)
+	_, err = authService.GetUserInfo(tokens.IDToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestGetOpenIDConfiguration(t *testing.T) {
+	authService, _ := initializeAuthAndDBService(t)
+	viper.Set("Issuer", "https://auth.example.com")
+	t.Cleanup(func() { viper.Set("Issuer", "") })
+
+	configuration := authService.GetOpenIDConfiguration()
+	assert.Equal(t, "https://auth.example.com", configuration.Issuer)
+	assert.Equal(t, "https://auth.example.com/.well-known/jwks.json", configuration.JwksURI)
+	assert.Equal(t, "https://auth.example.com/userinfo", configuration.UserinfoEndpoint)
+	assert.Equal(t, []string{"RS256"}, configuration.IDTokenSigningAlgValuesSupported)
+	assert.Equal(t, "https://auth.example.com/authorize", configuration.AuthorizationEndpoint)
+	assert.Equal(t, "https://auth.example.com/token", configuration.TokenEndpoint)
+	assert.Equal(t, []string{"S256"}, configuration.CodeChallengeMethodsSupported)
+}
@@ -0,0 +1,110 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"time"
+)
+
+const (
+	passwordResetLifetime = 30 * time.Minute
+	passwordResetToken    = "password_reset"
+)
+
+// RequestPasswordReset mails the link of /password/reset with a new reset token to the user. No
+// error is returned when the user doesn't exist or the email can't be sent, and the token and the
+// email of the unknown users are made and dropped, so neither the response nor its timing reveals
+// the registered emails.
+func (a *AuthenticationService) RequestPasswordReset(email string) error {
+	user, err := a.GetUser(email)
+	exists := err == nil
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	if !exists {
+		user = entity.User{ID: internal.GenerateID(), Email: email}
+	}
+	token, err := a.generateEmailToken(user, passwordResetToken, passwordResetLifetime)
+	if err != nil {
+		a.logger.Println("[Error] generating the password reset token")
+		return errors.Wrap(err, "Error generating the password reset token")
+	}
+	data := map[string]interface{}{
+		"Link":    baseURL() + "/password/reset?token=" + url.QueryEscape(token),
+		"Minutes": int(passwordResetLifetime.Minutes()),
+	}
+	if !exists {
+		a.render(email, passwordResetNotification, data)
+		return nil
+	}
+	err = a.notify(user.Email, passwordResetNotification, data)
+	if err != nil {
+		a.logger.Printf("[Error] sending the password reset email to %s. Err: %s", user.Email, err)
+	}
+	return nil
+}
+
+// ResetPassword sets the new password of the user of the reset token. The token hash of the user
+// is rotated, so every refresh token of the user is invalidated, and as the reset link proves the
+// ownership of the email, it's verified too.
+func (a *AuthenticationService) ResetPassword(token, newPassword string) error {
+	// the password is checked first so a weak one doesn't use up the token
+	hashedPass, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user, err := a.useEmailToken(token, passwordResetToken)
+	if err != nil {
+		return err
+	}
+	user.HashedPassword = string(hashedPass)
+	user.EmailVerified = true
+	err = a.endSessions(user, "")
+	if err != nil {
+		return err
+	}
+	a.alert(user.Email, passwordChangedNotification)
+	return nil
+}
+
+// ChangePassword sets the new password of the signed in user after checking the old one. When
+// logoutAll is set the other sessions of the user are revoked, the session of sessionID which
+// made the change stays signed in.
+func (a *AuthenticationService) ChangePassword(email, oldPassword, newPassword string, logoutAll bool, sessionID string) error {
+	user, err := a.GetUser(email)
+	if err != nil {
+		return err
+	}
+	err = checkPassword(user, oldPassword)
+	if err != nil {
+		return err
+	}
+	hashedPass, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.HashedPassword = string(hashedPass)
+	if logoutAll {
+		err = a.endSessions(user, sessionID)
+	} else {
+		err = a.updateUser(user)
+	}
+	if err != nil {
+		return err
+	}
+	a.alert(user.Email, passwordChangedNotification)
+	return nil
+}
+
+// checkPassword returns ErrInvalidCredentials when the password isn't the one of the user, it
+// confirms the password of the signed in user before the sensitive changes
+func checkPassword(user entity.User, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
+	if err != nil {
+		return errors.Wrap(ErrInvalidCredentials, "The password is wrong")
+	}
+	return nil
+}
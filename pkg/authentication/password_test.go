@@ -0,0 +1,106 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testNewPassword = "914#_Resetting456"
+
+func TestResetPassword(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	tokens := signInTestUser(t, authService)
+	assert.Nil(t, authService.RequestPasswordReset(testutil.TestEmail))
+	assert.Equal(t, "Reset your password", notifier.Messages[len(notifier.Messages)-1].Subject)
+	token := notifier.LastToken(t, testutil.TestEmail)
+
+	// a weak password doesn't use up the token
+	assert.ErrorIs(t, authService.ResetPassword(token, "123"), ErrWeakPassword)
+	assert.Nil(t, authService.ResetPassword(token, testNewPassword))
+	assert.ErrorIs(t, authService.ResetPassword(token, testNewPassword), ErrTokenRevoked)
+	assert.Equal(t, "Your password is changed", notifier.Messages[len(notifier.Messages)-1].Subject)
+
+	_, err := authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.NotNil(t, err)
+	_, err = authService.SignIn(testutil.TestEmail, testutil.TestPassword)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.SignIn(testutil.TestEmail, testNewPassword)
+	assert.Nil(t, err)
+	user, err := authService.GetUser(testutil.TestEmail)
+	assert.Nil(t, err)
+	assert.True(t, user.EmailVerified)
+}
+
+func TestResetPasswordErrors(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	sent := len(notifier.Messages)
+	assert.Nil(t, authService.RequestPasswordReset("missing@test.com"))
+	assert.Len(t, notifier.Messages, sent)
+
+	// the verification token can't reset the password
+	verificationToken := notifier.LastToken(t, testutil.TestEmail)
+	assert.ErrorIs(t, authService.ResetPassword(verificationToken, testNewPassword), ErrInvalidToken)
+	assert.ErrorIs(t, authService.ResetPassword("invalid", testNewPassword), ErrInvalidToken)
+	assert.Nil(t, authService.VerifyEmail(verificationToken))
+}
+
+func TestResetTokensOfOldPassword(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	assert.Nil(t, authService.RequestPasswordReset(testutil.TestEmail))
+	first := notifier.LastToken(t, testutil.TestEmail)
+	assert.Nil(t, authService.RequestPasswordReset(testutil.TestEmail))
+	second := notifier.LastToken(t, testutil.TestEmail)
+	assert.Nil(t, authService.RequestPasswordReset(testutil.TestEmail))
+	third := notifier.LastToken(t, testutil.TestEmail)
+
+	// resetting the password invalidates the other reset tokens
+	assert.Nil(t, authService.ResetPassword(first, testNewPassword))
+	assert.ErrorIs(t, authService.ResetPassword(second, testutil.TestPassword), ErrInvalidToken)
+
+	// and so does changing it
+	assert.Nil(t, authService.RequestPasswordReset(testutil.TestEmail))
+	fourth := notifier.LastToken(t, testutil.TestEmail)
+	assert.Nil(t, authService.ChangePassword(testutil.TestEmail, testNewPassword, testutil.TestPassword, false, ""))
+	assert.ErrorIs(t, authService.ResetPassword(fourth, testNewPassword), ErrInvalidToken)
+	assert.ErrorIs(t, authService.ResetPassword(third, testNewPassword), ErrInvalidToken)
+}
+
+func TestChangePassword(t *testing.T) {
+	authService, notifier := initializeNotifierService(t)
+	tokens := signInTestUser(t, authService)
+
+	err := authService.ChangePassword(testutil.TestEmail, "wrong password", testNewPassword, false, "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	err = authService.ChangePassword(testutil.TestEmail, testutil.TestPassword, "123", false, "")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	err = authService.ChangePassword("missing@test.com", testutil.TestPassword, testNewPassword, false, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	assert.Nil(t, authService.ChangePassword(testutil.TestEmail, testutil.TestPassword, testNewPassword, false, ""))
+	assert.Equal(t, "Your password is changed", notifier.Messages[len(notifier.Messages)-1].Subject)
+	_, err = authService.SignIn(testutil.TestEmail, testutil.TestPassword)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	// the sessions are kept unless logging out of them is asked
+	tokens, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+
+	// logging out of the other sessions keeps the session which changes the password
+	otherTokens, err := authService.SignIn(testutil.TestEmail, testNewPassword)
+	assert.Nil(t, err)
+	claims, err := authService.ValidateFirstPartyAccessToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, claims.SessionID)
+	assert.Nil(t, authService.ChangePassword(testutil.TestEmail, testNewPassword, testutil.TestPassword, true, claims.SessionID))
+	_, err = authService.RefreshAccessToken(otherTokens.RefreshToken)
+	assert.NotNil(t, err)
+	tokens, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+
+	assert.Nil(t, authService.ChangePassword(testutil.TestEmail, testutil.TestPassword, testNewPassword, true, ""))
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.NotNil(t, err)
+	tokens, err = authService.SignIn(testutil.TestEmail, testNewPassword)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
@@ -0,0 +1,77 @@
+package authentication
+
+import (
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Revoke invalidates the access or refresh token as RFC 7009 describes it. The token must be
+// issued to the client, and the tokens of signing in directly are revoked without a client. The
+// tokens which are invalid, expired or already revoked are ignored. The hint is the
+// token_type_hint of the request, it only changes the order in which the token types are tried.
+func (a *AuthenticationService) Revoke(clientID, clientSecret, token, tokenTypeHint string) error {
+	if clientID != "" {
+		_, err := a.authenticateClient(clientID, clientSecret)
+		if err != nil {
+			return err
+		}
+	}
+	revokers := []func(clientID, token string) (bool, error){a.revokeAccessToken, a.revokeRefreshToken}
+	if tokenTypeHint == "refresh_token" {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+	for _, revoke := range revokers {
+		found, err := revoke(clientID, token)
+		if found || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAccessToken adds the jti of the access token to the revocation list until the token
+// expires, it reports whether the token is an access token
+func (a *AuthenticationService) revokeAccessToken(clientID, accessToken string) (bool, error) {
+	claims, err := a.parseAccessToken(accessToken)
+	if isTokenError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if claims.ClientID != clientID {
+		return true, newOAuthError("unauthorized_client", "The token is issued to another client")
+	}
+	// the tokens which are issued before the access tokens had a jti can't be revoked
+	if claims.Id == "" {
+		return true, nil
+	}
+	err = a.dbService.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil && !errors.Is(err, database.ErrTokenRevoked) {
+		a.logger.Println("[Error] adding the access token to the revocation list")
+		return true, errors.Wrap(err, "Error adding the access token to the revocation list")
+	}
+	return true, nil
+}
+
+// revokeRefreshToken revokes the family of the refresh token and the access tokens which are
+// issued with it, it reports whether the token is a refresh token
+func (a *AuthenticationService) revokeRefreshToken(clientID, refreshToken string) (bool, error) {
+	_, _, session, err := a.parseRefreshToken(refreshToken)
+	if isTokenError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.ClientID != clientID {
+		return true, newOAuthError("unauthorized_client", "The token is issued to another client")
+	}
+	err = a.revokeSessionFamily(session.FamilyID)
+	if err != nil {
+		a.logger.Println("[Error] revoking the family of the refresh token")
+		return true, errors.Wrap(err, "Error revoking the family of the refresh token")
+	}
+	return true, nil
+}
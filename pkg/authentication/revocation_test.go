@@ -0,0 +1,58 @@
+package authentication
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRevokeFirstPartyTokens(t *testing.T) {
+	authService := initializeOAuthService(t)
+	tokens := signInTestUser(t, authService)
+
+	assert.Nil(t, authService.Revoke("", "", tokens.AccessToken, ""))
+	_, err := authService.ValidateAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+
+	tokens = signInTestUser(t, authService)
+	assert.Nil(t, authService.Revoke("", "", tokens.RefreshToken, "refresh_token"))
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = authService.ValidateAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// revoking an invalid or already revoked token succeeds
+	assert.Nil(t, authService.Revoke("", "", tokens.RefreshToken, ""))
+	assert.Nil(t, authService.Revoke("", "", "malformed", "access_token"))
+}
+
+func TestRevokeClientTokens(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registerServiceClient(t, authService)
+	code := authorizeTestUser(t, authService, "openid")
+	tokens, err := authService.ExchangeAuthorizationCode(testClientID, "", code, testRedirectURI, testCodeVerifier)
+	assert.Nil(t, err)
+
+	err = authService.Revoke("jobs", "secret", tokens.AccessToken, "")
+	assertOAuthError(t, err, "unauthorized_client")
+	err = authService.Revoke("", "", tokens.RefreshToken, "")
+	assertOAuthError(t, err, "unauthorized_client")
+	err = authService.Revoke("jobs", "wrong", tokens.AccessToken, "")
+	assertOAuthError(t, err, "invalid_client")
+
+	assert.Nil(t, authService.Revoke(testClientID, "", tokens.AccessToken, "access_token"))
+	response, err := authService.Introspect("jobs", "secret", tokens.AccessToken, "")
+	assert.Nil(t, err)
+	assert.Equal(t, IntrospectionResponse{Revoked: true}, response)
+	assert.Nil(t, authService.Revoke(testClientID, "", tokens.RefreshToken, ""))
+	_, err = authService.RefreshClientToken(testClientID, "", tokens.RefreshToken)
+	assertOAuthError(t, err, "invalid_grant")
+
+	clientTokens, err := authService.ClientCredentials("jobs", "secret", "")
+	assert.Nil(t, err)
+	assert.Nil(t, authService.Revoke("jobs", "secret", clientTokens.AccessToken, ""))
+	response, err = authService.Introspect("jobs", "secret", clientTokens.AccessToken, "")
+	assert.Nil(t, err)
+	assert.True(t, response.Revoked)
+}
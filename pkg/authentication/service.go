@@ -4,230 +4,668 @@ import (
 	"github.com/Hamifthi/authentication_microservice/entity"
 	"github.com/Hamifthi/authentication_microservice/internal"
 	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/Hamifthi/authentication_microservice/pkg/notification"
 	"github.com/golang-jwt/jwt"
 	"github.com/pkg/errors"
 	passwordValidator "github.com/wagslane/go-password-validator"
 	"golang.org/x/crypto/bcrypt"
-	"io/ioutil"
 	"log"
 	"net/mail"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type AuthenticationService struct {
 	dbService database.DatabaseInterface
+	keys      *KeyManager
+	notifier  notification.Notifier
+	templates *notification.Templates
 	logger    *log.Logger
 }
 
-func New(dbService database.DatabaseInterface, logger *log.Logger) *AuthenticationService {
+// New returns the authentication service of the database, its notifications are dropped until
+// SetNotifier sets the notifier of a driver
+func New(dbService database.DatabaseInterface, logger *log.Logger) (*AuthenticationService, error) {
+	templates, err := notification.DefaultTemplates()
+	if err != nil {
+		logger.Println("[Error] parsing the embedded notification templates")
+		return nil, errors.Wrap(err, "Error parsing the embedded notification templates")
+	}
 	return &AuthenticationService{
 		dbService: dbService,
+		keys:      NewKeyManager(logger),
+		notifier:  notification.NopNotifier{},
+		templates: templates,
 		logger:    logger,
-	}
+	}, nil
 }
 
-func (a *AuthenticationService) readPrivateKey() ([]byte, error) {
-	accessTokenPrivateKeyPath, err := internal.GetEnv("TokenPrivateKeyPath")
+// signToken signs the claims with the signing key and stamps its id in the kid header
+func (a *AuthenticationService) signToken(claims jwt.Claims) (string, error) {
+	key, err := a.keys.SigningKey()
 	if err != nil {
-		a.logger.Println("[Error] reading access token private key path from environment")
-		return nil, errors.Wrap(err, "Error reading access token private key path")
+		a.logger.Println("[Error] getting the token signing key")
+		return "", errors.Wrap(err, "Error getting the token signing key")
 	}
-	signBytes, err := ioutil.ReadFile(accessTokenPrivateKeyPath)
-	if err != nil {
-		a.logger.Println("[Error] reading access token private key")
-		return nil, errors.Wrap(err, "Error reading access token private key")
-	}
-	return signBytes, nil
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-func (a *AuthenticationService) readPublicKey() ([]byte, error) {
-	accessTokenPublicKeyPath, err := internal.GetEnv("TokenPublicKeyPath")
+// GetJWKS returns the public keys which verify the tokens of the service
+func (a *AuthenticationService) GetJWKS() (JSONWebKeySet, error) {
+	keySet, err := a.keys.JWKS()
 	if err != nil {
-		a.logger.Println("[Error] reading access token public key path from environment")
-		return nil, errors.Wrap(err, "Error reading access token public key path")
+		a.logger.Println("[Error] getting the token verification keys")
+		return keySet, errors.Wrap(err, "Error getting the token verification keys")
 	}
-	verifyBytes, err := ioutil.ReadFile(accessTokenPublicKeyPath)
+	return keySet, nil
+}
+
+// Keys returns the key manager which signs and verifies the tokens of the service
+func (a *AuthenticationService) Keys() *KeyManager {
+	return a.keys
+}
+
+type AccessTokenData struct {
+	UserEmail string `json:"userEmail"`
+	TokenType string `json:"tokenType"`
+}
+
+// AccessTokenCustomClaims are the claims of the access token, ClientID is only set for the tokens
+// which are issued to an OAuth client. The tokens of signing in directly have every supported
+// scope and the IDTokenAudience as their audience. The tokens of the client credentials grant
+// have no user email and their subject is the client. Act is the actor of the exchanged tokens.
+// SessionID is the family of the refresh token which is issued with the access token.
+type AccessTokenCustomClaims struct {
+	Data      AccessTokenData `json:"data"`
+	ClientID  string          `json:"client_id,omitempty"`
+	Scope     string          `json:"scope,omitempty"`
+	Act       *ActorClaim     `json:"act,omitempty"`
+	SessionID string          `json:"sid,omitempty"`
+	jwt.StandardClaims
+}
+
+// accessTokenLifetime reads the JwtExpiration which is in minutes
+func accessTokenLifetime() (time.Duration, error) {
+	jwtExpirationStr, err := internal.GetEnv("JwtExpiration")
 	if err != nil {
-		a.logger.Println("[Error] reading access token public key")
-		return nil, errors.Wrap(err, "Error reading access token public key")
+		return 0, errors.Wrap(err, "Error reading jwt expiration")
 	}
-	return verifyBytes, nil
+	jwtExpiration, _ := strconv.Atoi(jwtExpirationStr)
+	return time.Minute * time.Duration(jwtExpiration), nil
 }
 
-func (a *AuthenticationService) generateAccessToken(email string) (string, error) {
-	jwtExpirationStr, err := internal.GetEnv("JwtExpiration")
+// newAccessTokenClaims returns the claims of the access token of the subject, which is the id of
+// the user or the id of the client for the tokens of the client credentials grant which have no user
+func (a *AuthenticationService) newAccessTokenClaims(subject, email, clientID, scope string) (AccessTokenCustomClaims, error) {
+	lifetime, err := accessTokenLifetime()
 	if err != nil {
 		a.logger.Println("[Error] reading jwt expiration key")
-		return "", errors.Wrap(err, "Error reading jwt expiration")
+		return AccessTokenCustomClaims{}, err
 	}
-	jwtExpiration, _ := strconv.Atoi(jwtExpirationStr)
 
-	claims := jwt.MapClaims{
-		"iss": "authService",
-		"exp": time.Now().Add(time.Minute * time.Duration(jwtExpiration)).Unix(),
-		"data": map[string]string{
-			"userEmail": email,
-			"tokenType": "access",
+	claims := AccessTokenCustomClaims{
+		Data: AccessTokenData{
+			UserEmail: email,
+			TokenType: "access",
+		},
+		ClientID: clientID,
+		Scope:    scope,
+		StandardClaims: jwt.StandardClaims{
+			Id:        internal.GenerateID(),
+			Subject:   subject,
+			Issuer:    issuer(),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(lifetime).Unix(),
 		},
 	}
-	signBytes, err := a.readPrivateKey()
-	if err != nil {
-		a.logger.Println("[Error] reading access token private key")
-		return "", errors.Wrap(err, "Error reading access token private key")
-	}
-	signKey, err := jwt.ParseRSAPrivateKeyFromPEM(signBytes)
+	return claims, nil
+}
+
+func (a *AuthenticationService) generateAccessToken(subject, email, clientID, scope string) (string, error) {
+	claims, err := a.newAccessTokenClaims(subject, email, clientID, scope)
 	if err != nil {
-		a.logger.Println("[Error] Unable to parse the access token private key")
-		return "", errors.New("Unable to parse the access token private key")
+		return "", err
 	}
-	// its better use environment variable here
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(signKey)
+	return a.signToken(claims)
+}
+
+type RefreshTokenData struct {
+	UserEmail string `json:"userEmail"`
+	CustomKey string `json:"customKey"`
+	TokenType string `json:"tokenType"`
+	FamilyID  string `json:"familyId"`
 }
 
 type RefreshTokenCustomClaims struct {
-	Foo string `json:"foo"`
-	jwt.MapClaims
+	Data RefreshTokenData `json:"data"`
+	jwt.StandardClaims
 }
 
-func (a *AuthenticationService) generateRefreshToken(email, tokenHash string) (string, error) {
-	customKey := internal.GenerateCustomKey(email, tokenHash)
+// generateRefreshToken issues a single use refresh token for the family, email, client and
+// scope of the session and stores the session so that it can be rotated and revoked later
+func (a *AuthenticationService) generateRefreshToken(tokenHash string, session entity.Session) (string, error) {
+	refreshExpirationStr, err := internal.GetEnv("RefreshTokenExpiration")
+	if err != nil {
+		a.logger.Println("[Error] reading refresh token expiration key")
+		return "", errors.Wrap(err, "Error reading refresh token expiration")
+	}
+	refreshExpiration, _ := strconv.Atoi(refreshExpirationStr)
+	expiresAt := time.Now().Add(time.Minute * time.Duration(refreshExpiration))
+
+	session.ID = internal.GenerateID()
+	session.ExpiresAt = expiresAt
 	claims := RefreshTokenCustomClaims{
-		"authServiceCustomClaims",
-		jwt.MapClaims{
-			"iss": "authService",
-			"data": map[string]string{
-				"userEmail": email,
-				"customKey": customKey,
-				"tokenType": "refresh",
-			},
+		RefreshTokenData{
+			UserEmail: session.Email,
+			CustomKey: internal.GenerateCustomKey(session.Email, tokenHash),
+			TokenType: "refresh",
+			FamilyID:  session.FamilyID,
+		},
+		jwt.StandardClaims{
+			Id:        session.ID,
+			Issuer:    issuer(),
+			ExpiresAt: expiresAt.Unix(),
 		},
 	}
-	signBytes, err := a.readPrivateKey()
+	signedToken, err := a.signToken(claims)
 	if err != nil {
-		a.logger.Println("[Error] reading access token private key")
-		return "", errors.Wrap(err, "Error reading access token private key")
+		a.logger.Println("[Error] signing the refresh token")
+		return "", errors.Wrap(err, "Error signing the refresh token")
 	}
-	signKey, err := jwt.ParseRSAPrivateKeyFromPEM(signBytes)
+	err = a.dbService.CreateSession(session)
 	if err != nil {
-		a.logger.Println("Unable to parse the refresh token private key")
-		return "", errors.New("Unable to parse the refresh token private key")
+		a.logger.Println("[Error] storing the refresh token session")
+		return "", errors.Wrap(err, "Error storing the refresh token session")
 	}
-	// its better use environment variable here
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(signKey)
+	return signedToken, nil
 }
 
-func (a *AuthenticationService) SignUp(email, password string) error {
-	_, err := mail.ParseAddress(email)
-	if err != nil {
-		return errors.Wrap(err, "The email address is invalid")
-	}
-	user, err := a.dbService.GetUser(email)
-	if user.Email != "" {
-		return errors.Errorf("the user with %s email is already exist", email)
-	}
+// hashPassword checks the entropy of the password against MinEntropyBits and hashes it
+func hashPassword(password string) ([]byte, error) {
 	entropyBits, err := internal.GetEnv("MinEntropyBits")
 	if err != nil {
-		return errors.Wrap(err, "Problem getting the min entropy bits from config file")
+		return nil, errors.Wrap(err, "Problem getting the min entropy bits from config file")
 	}
 	minEntropyBits, err := strconv.ParseFloat(entropyBits, 64)
 	if err != nil {
-		return errors.Wrap(err, "Problem converting the min entropy bits to the float64")
+		return nil, errors.Wrap(err, "Problem converting the min entropy bits to the float64")
 	}
 	err = passwordValidator.Validate(password, minEntropyBits)
 	if err != nil {
-		return err
+		return nil, withType(ErrWeakPassword, err)
 	}
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return errors.Wrap(err, "The hashing process of password went wrong")
+		return nil, errors.Wrap(err, "The hashing process of password went wrong")
+	}
+	return hashedPass, nil
+}
+
+func (a *AuthenticationService) SignUp(email, password string) error {
+	_, err := mail.ParseAddress(email)
+	if err != nil {
+		return withType(ErrInvalidEmail, errors.Wrap(err, "The email address is invalid"))
+	}
+	user, err := a.dbService.GetUser(email)
+	if user.Email != "" {
+		return errors.Wrapf(ErrUserExists, "the user with %s email is already exist", email)
+	}
+	hashedPass, err := hashPassword(password)
+	if err != nil {
+		return err
 	}
 	// its better use environment variable here
 	tokenHash := internal.RandString(15)
 	err = a.dbService.CreateUser(email, string(hashedPass), tokenHash)
+	if errors.Is(err, database.ErrUserExists) {
+		return errors.Wrapf(ErrUserExists, "the user with %s email is already exist", email)
+	}
 	if err != nil {
 		return errors.Wrap(err, "The user can't be inserted to the database")
 	}
+	// the account is created even when the email can't be sent, the user can ask for another one
+	err = a.SendVerificationEmail(email)
+	if err != nil {
+		a.logger.Printf("[Error] sending the verification email to %s. Err: %s", email, err)
+	}
 	return nil
 }
 
-func (a *AuthenticationService) SignIn(email, password string) (entity.Tokens, error) {
-	emptyTokens := entity.Tokens{AccessToken: "", RefreshToken: ""}
+// authenticate checks the credentials of the user and whether it can sign in before verifying
+// the email
+func (a *AuthenticationService) authenticate(email, password string) (entity.User, error) {
 	_, err := mail.ParseAddress(email)
 	if err != nil {
-		return emptyTokens, errors.Wrap(err, "The email address is invalid")
+		return entity.User{}, withType(ErrInvalidEmail, errors.Wrap(err, "The email address is invalid"))
 	}
 	user, err := a.dbService.GetUser(email)
-	if user.Email == "" {
-		return emptyTokens, errors.Wrapf(err, "the user with %s email doesn't exist", email)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return user, errors.Wrapf(ErrInvalidCredentials, "the user with %s email doesn't exist", email)
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve user from database")
+		return user, errors.Wrap(err, "Error can't retrieve user from database")
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return emptyTokens, errors.Wrap(err, "The invalid credentials, please try again.")
+	if err != nil {
+		return user, ErrInvalidCredentials
 	}
-	accessToken, err := a.generateAccessToken(email)
+	return user, checkEmailVerified(user)
+}
+
+// issueTokens issues the access, refresh and ID tokens of the user for the grant of the session.
+// The tokens of an OAuth client only include the ID token when the openid scope is granted.
+func (a *AuthenticationService) issueTokens(user entity.User, session entity.Session, nonce string) (entity.Tokens, error) {
+	emptyTokens := entity.Tokens{AccessToken: "", RefreshToken: ""}
+	scope := session.Scope
+	if session.ClientID == "" {
+		scope = firstPartyScope
+	}
+	claims, err := a.newAccessTokenClaims(user.ID, user.Email, session.ClientID, scope)
 	if err != nil {
 		a.logger.Println("Unable to get access token")
-		return emptyTokens, errors.New("Unable to get access token")
+		return emptyTokens, errors.Wrap(err, "Unable to get access token")
+	}
+	if session.ClientID == "" {
+		claims.Audience = idTokenAudience()
 	}
-	refreshToken, err := a.generateRefreshToken(email, user.TokenHash)
+	claims.SessionID = session.FamilyID
+	accessToken, err := a.signToken(claims)
 	if err != nil {
-		a.logger.Println("Unable to get refresh token")
-		return emptyTokens, errors.New("Unable to get refresh token")
+		a.logger.Println("Unable to get access token")
+		return emptyTokens, errors.Wrap(err, "Unable to get access token")
 	}
-	return entity.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
-}
-
-func (a *AuthenticationService) ValidateRefreshToken(refreshToken string) (entity.User, error) {
-	token, err := jwt.ParseWithClaims(refreshToken, &RefreshTokenCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			a.logger.Println("[Error] unexpected signing method in auth token")
-			return nil, errors.New("Unexpected signing method in auth token")
+	idToken := ""
+	if session.ClientID == "" || hasScope(session.Scope, "openid") {
+		audience := session.ClientID
+		if audience == "" {
+			audience = idTokenAudience()
 		}
-		verifyBytes, err := a.readPublicKey()
+		idToken, err = a.generateIDToken(user, audience, nonce)
 		if err != nil {
-			a.logger.Println("[Error] reading access token public key")
-			return "", errors.Wrap(err, "Error reading access token private key")
+			a.logger.Println("Unable to get id token")
+			return emptyTokens, errors.Wrap(err, "Unable to get id token")
 		}
-		verifyKey, err := jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
+	}
+	session.Email = user.Email
+	refreshToken, err := a.generateRefreshToken(user.TokenHash, session)
+	if err != nil {
+		a.logger.Println("Unable to get refresh token")
+		return emptyTokens, errors.Wrap(err, "Unable to get refresh token")
+	}
+	return entity.Tokens{AccessToken: accessToken, RefreshToken: refreshToken, IDToken: idToken}, nil
+}
+
+// SignIn checks the credentials of the user and issues its tokens. When the user has TOTP or a
+// passkey only the MFA token is returned, which VerifyMFA or the passkey exchanges for the tokens.
+func (a *AuthenticationService) SignIn(email, password string) (entity.Tokens, error) {
+	user, err := a.authenticate(email, password)
+	if err != nil {
+		return entity.Tokens{AccessToken: "", RefreshToken: ""}, err
+	}
+	hasSecondFactor, err := a.hasSecondFactor(user)
+	if err != nil {
+		return entity.Tokens{AccessToken: "", RefreshToken: ""}, err
+	}
+	if hasSecondFactor {
+		mfaToken, err := a.generateMFAChallenge(user)
 		if err != nil {
-			a.logger.Println("[Error] unable to parse public key", "error", err)
-			return nil, err
+			a.logger.Println("Unable to get MFA token")
+			return entity.Tokens{AccessToken: "", RefreshToken: ""}, errors.Wrap(err, "Unable to get MFA token")
 		}
+		return entity.Tokens{MFAToken: mfaToken}, nil
+	}
+	return a.issueTokens(user, entity.Session{FamilyID: internal.GenerateID()}, "")
+}
 
-		return verifyKey, nil
-	})
+// parseRefreshToken verifies the refresh token and loads its user and session, it doesn't check
+// whether the session is revoked or used
+func (a *AuthenticationService) parseRefreshToken(refreshToken string) (*RefreshTokenCustomClaims, entity.User, entity.Session, error) {
 	user := entity.User{}
+	session := entity.Session{}
+	token, err := jwt.ParseWithClaims(refreshToken, &RefreshTokenCustomClaims{}, a.keys.VerifyKey)
 	if err != nil {
 		a.logger.Println("[Error] parsing the claims from refresh token")
-		return user, errors.Wrap(err, "Error parsing the claims from refresh token")
+		return nil, user, session, tokenError(err, "Error parsing the claims from refresh token")
 	}
 	claims, ok := token.Claims.(*RefreshTokenCustomClaims)
-	data, ok := claims.MapClaims["data"].(map[string]string)
-	if !ok || !token.Valid || data["userEmail"] == "" || data["tokenType"] != "refresh" {
+	if !ok || !token.Valid || claims.Id == "" || claims.Data.UserEmail == "" || claims.Data.TokenType != "refresh" {
 		a.logger.Println("[Error] getting claims from token")
-		return user, errors.New("Error getting claims from token")
+		return nil, user, session, errors.Wrap(ErrInvalidToken, "Error getting claims from token")
+	}
+	user, err = a.dbService.GetUser(claims.Data.UserEmail)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return nil, user, session, errors.Wrap(ErrInvalidToken, "The user of the refresh token doesn't exist")
 	}
-	user, err = a.dbService.GetUser(data["userEmail"])
 	if err != nil {
 		a.logger.Println("[Error] can't retrieve user from database")
-		return user, errors.Wrap(err, "Error can't retrieve user from database")
+		return nil, user, session, errors.Wrap(err, "Error can't retrieve user from database")
 	}
 	generatedCustomKey := internal.GenerateCustomKey(user.Email, user.TokenHash)
-	if data["customKey"] != generatedCustomKey {
+	if claims.Data.CustomKey != generatedCustomKey {
 		a.logger.Println("[Error] refresh token is malformed")
-		return user, errors.New("Refresh token is malformed")
+		return nil, user, session, errors.Wrap(ErrTokenRevoked, "Refresh token is malformed")
 	}
-	return user, nil
+	session, err = a.dbService.GetSession(claims.Id)
+	if errors.Is(err, database.ErrSessionNotFound) {
+		return nil, user, session, errors.Wrap(ErrInvalidToken, "The session of the refresh token doesn't exist")
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve refresh token session from database")
+		return nil, user, session, errors.Wrap(err, "Error can't retrieve refresh token session from database")
+	}
+	return claims, user, session, nil
+}
+
+// isSessionRevoked reports whether the session or its family is revoked
+func (a *AuthenticationService) isSessionRevoked(session entity.Session) (bool, error) {
+	revoked, err := a.dbService.IsTokenRevoked(session.FamilyID)
+	if err != nil {
+		a.logger.Println("[Error] can't check the revocation list")
+		return false, errors.Wrap(err, "Error can't check the revocation list")
+	}
+	return session.Revoked || revoked, nil
+}
+
+// validateRefreshToken verifies the refresh token and its session. Presenting a refresh token
+// which is already used means the token is replayed, so the whole family gets revoked.
+func (a *AuthenticationService) validateRefreshToken(refreshToken string) (entity.User, entity.Session, error) {
+	_, user, session, err := a.parseRefreshToken(refreshToken)
+	if err != nil {
+		return user, session, err
+	}
+	revoked, err := a.isSessionRevoked(session)
+	if err != nil {
+		return user, session, err
+	}
+	if revoked {
+		a.logger.Println("[Error] refresh token is revoked")
+		return user, session, errors.Wrap(ErrTokenRevoked, "Refresh token is revoked")
+	}
+	if session.Used {
+		a.logger.Printf("[Error] refresh token reuse detected, revoking the %s family", session.FamilyID)
+		return user, session, a.revokeFamily(session.FamilyID)
+	}
+	return user, session, nil
+}
+
+func (a *AuthenticationService) revokeFamily(familyID string) error {
+	err := a.revokeSessionFamily(familyID)
+	if err != nil {
+		a.logger.Println("[Error] revoking the refresh token family")
+		return errors.Wrap(err, "Refresh token reuse detected and revoking its family failed")
+	}
+	return ErrTokenReused
+}
+
+// revokeSessionFamily revokes the refresh tokens of the family and adds the family to the
+// revocation list until the access tokens which are issued with them expire, so their sid is
+// rejected as well
+func (a *AuthenticationService) revokeSessionFamily(familyID string) error {
+	err := a.dbService.RevokeSessionFamily(familyID)
+	if err != nil {
+		return err
+	}
+	lifetime, err := accessTokenLifetime()
+	if err != nil {
+		return err
+	}
+	err = a.dbService.RevokeToken(familyID, time.Now().Add(lifetime))
+	if err != nil && !errors.Is(err, database.ErrTokenRevoked) {
+		return err
+	}
+	return nil
+}
+
+func (a *AuthenticationService) ValidateRefreshToken(refreshToken string) (entity.User, error) {
+	user, _, err := a.validateRefreshToken(refreshToken)
+	return user, err
+}
+
+// RefreshAccessToken consumes the refresh token and returns a new access token alongside
+// a rotated refresh token from the same family
+func (a *AuthenticationService) RefreshAccessToken(refreshToken string) (entity.Tokens, error) {
+	tokens, _, err := a.rotateRefreshToken(refreshToken, "")
+	return tokens, err
+}
+
+// rotateRefreshToken consumes the refresh token which is issued to the client, the clientID is
+// empty for the refresh tokens of signing in directly. It returns the consumed session as well.
+func (a *AuthenticationService) rotateRefreshToken(refreshToken, clientID string) (entity.Tokens, entity.Session, error) {
+	emptyTokens := entity.Tokens{AccessToken: "", RefreshToken: ""}
+	user, session, err := a.validateRefreshToken(refreshToken)
+	if err != nil {
+		a.logger.Println("Unable to validate refresh token")
+		return emptyTokens, session, errors.Wrap(err, "Unable to validate refresh token")
+	}
+	if session.ClientID != clientID {
+		a.logger.Println("[Error] refresh token is issued to another client")
+		return emptyTokens, session, errors.Wrap(ErrInvalidToken, "Refresh token is issued to another client")
+	}
+	err = a.dbService.UseSession(session.ID)
+	if errors.Is(err, database.ErrSessionAlreadyUsed) {
+		a.logger.Printf("[Error] refresh token reuse detected, revoking the %s family", session.FamilyID)
+		return emptyTokens, session, a.revokeFamily(session.FamilyID)
+	}
+	if err != nil {
+		a.logger.Println("Unable to mark refresh token as used")
+		return emptyTokens, session, errors.Wrap(err, "Unable to mark refresh token as used")
+	}
+	tokens, err := a.issueTokens(user, entity.Session{
+		FamilyID: session.FamilyID,
+		ClientID: session.ClientID,
+		Scope:    session.Scope,
+	}, "")
+	if err != nil {
+		a.logger.Println("Unable to rotate refresh token")
+		return emptyTokens, session, errors.Wrap(err, "Unable to rotate refresh token")
+	}
+	return tokens, session, nil
+}
+
+// Logout ends the session of the refresh token by adding its family to the revocation list
+func (a *AuthenticationService) Logout(refreshToken string) error {
+	_, session, err := a.validateRefreshToken(refreshToken)
+	if err != nil {
+		a.logger.Println("Unable to validate refresh token")
+		return errors.Wrap(err, "Unable to validate refresh token")
+	}
+	err = a.dbService.RevokeToken(session.FamilyID, session.ExpiresAt)
+	if err != nil && !errors.Is(err, database.ErrTokenRevoked) {
+		a.logger.Println("[Error] adding the session to the revocation list")
+		return errors.Wrap(err, "Error adding the session to the revocation list")
+	}
+	return nil
 }
 
-func (a *AuthenticationService) RefreshAccessToken(user entity.User) (string, error) {
-	accessToken, err := a.generateAccessToken(user.Email)
+// LogoutAll ends every session of the user by rotating its token hash, which makes the custom
+// key of all the issued refresh tokens invalid. The session families are revoked as well, so
+// the sessions of the user don't look usable in the database.
+func (a *AuthenticationService) LogoutAll(email string) error {
+	user, err := a.dbService.GetUser(email)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return errors.Wrapf(ErrUserNotFound, "the user with %s email doesn't exist", email)
+	}
 	if err != nil {
-		a.logger.Println("Unable to refresh access token")
-		return "", errors.Wrap(err, "Unable to refresh access token")
+		a.logger.Println("[Error] can't retrieve user from database")
+		return errors.Wrap(err, "Error can't retrieve user from database")
+	}
+	return a.endSessions(user, "")
+}
+
+// endSessions rotates the token hash of the user and revokes its session families, the other
+// changes of the user are stored with the new token hash. When keepFamilyID is set the token
+// hash is kept and only the other families are revoked, so that session stays signed in.
+func (a *AuthenticationService) endSessions(user entity.User, keepFamilyID string) error {
+	if keepFamilyID == "" {
+		user.TokenHash = internal.RandString(15)
 	}
-	return accessToken, nil
+	err := a.dbService.UpdateUser(user)
+	if err != nil {
+		a.logger.Println("[Error] rotating the token hash of the user")
+		return errors.Wrap(err, "Error rotating the token hash of the user")
+	}
+	sessions, err := a.GetActiveSessions(user.Email)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.FamilyID == keepFamilyID {
+			continue
+		}
+		err = a.revokeSessionFamily(session.FamilyID)
+		if err != nil {
+			a.logger.Println("[Error] revoking the session family of the user")
+			return errors.Wrap(err, "Error revoking the session family of the user")
+		}
+	}
+	return nil
+}
+
+// GetActiveSessions returns the refresh tokens of the user which can still be used, there is
+// at most one of them for every login
+func (a *AuthenticationService) GetActiveSessions(email string) ([]entity.Session, error) {
+	sessions, err := a.dbService.GetUserSessions(email)
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the sessions of the user from database")
+		return nil, errors.Wrap(err, "Error can't retrieve the sessions of the user from database")
+	}
+	activeSessions := []entity.Session{}
+	for _, session := range sessions {
+		if session.Used || session.Revoked || session.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+		revoked, err := a.isSessionRevoked(session)
+		if err != nil {
+			return nil, err
+		}
+		if !revoked {
+			activeSessions = append(activeSessions, session)
+		}
+	}
+	return activeSessions, nil
+}
+
+// parseAccessToken verifies the signature and expiration of the access token of a user or a client,
+// and checks its jti and the family of its session against the revocation list
+func (a *AuthenticationService) parseAccessToken(accessToken string) (AccessTokenCustomClaims, error) {
+	claims := AccessTokenCustomClaims{}
+	token, err := jwt.ParseWithClaims(accessToken, &claims, a.keys.VerifyKey)
+	if err != nil {
+		a.logger.Println("[Error] parsing the claims from access token")
+		return claims, tokenError(err, "Error parsing the claims from access token")
+	}
+	if !token.Valid || (claims.Subject == "" && claims.Data.UserEmail == "") || claims.Data.TokenType != "access" {
+		a.logger.Println("[Error] getting claims from token")
+		return claims, errors.Wrap(ErrInvalidToken, "Error getting claims from token")
+	}
+	for _, id := range []string{claims.Id, claims.SessionID} {
+		if id == "" {
+			continue
+		}
+		revoked, err := a.dbService.IsTokenRevoked(id)
+		if err != nil {
+			a.logger.Println("[Error] can't check the revocation list")
+			return claims, errors.Wrap(err, "Error can't check the revocation list")
+		}
+		if revoked {
+			a.logger.Println("[Error] access token is revoked")
+			return claims, errors.Wrap(ErrTokenRevoked, "Access token is revoked")
+		}
+	}
+	return claims, nil
+}
+
+// CheckConfig returns an error when a setting which has no usable default is missing, it's
+// checked at startup so the misconfiguration doesn't surface on the first request
+func (a *AuthenticationService) CheckConfig() error {
+	if webAuthnRPID() == "" {
+		return errors.New("WebAuthnRPID must be set when the Issuer isn't a URL")
+	}
+	base, err := url.Parse(baseURL())
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return errors.New("BaseURL must be set to the public URL of the REST server")
+	}
+	rotationInterval, _ := internal.GetEnv("KeyRotationInterval")
+	if minutes, _ := strconv.Atoi(rotationInterval); minutes > 0 && keyDir() == "" {
+		return errors.New("TokenKeyDir must be set when the KeyRotationInterval is set")
+	}
+	return nil
+}
+
+// ValidateAccessToken verifies the signature and expiration of the access token of a user and
+// returns its claims
+func (a *AuthenticationService) ValidateAccessToken(accessToken string) (AccessTokenCustomClaims, error) {
+	claims, err := a.parseAccessToken(accessToken)
+	if err != nil {
+		return claims, err
+	}
+	if claims.Data.UserEmail == "" {
+		a.logger.Println("[Error] access token isn't issued to a user")
+		return claims, errors.Wrap(ErrInvalidToken, "Access token isn't issued to a user")
+	}
+	return claims, nil
+}
+
+// AccessTokenRequirements are the claims which a resource server requires from the access
+// token, the empty ones aren't checked. Scope is a space separated list of required scopes.
+type AccessTokenRequirements struct {
+	Audience string
+	Scope    string
+	ClientID string
+}
+
+// ValidateAccessTokenFor validates the access token of a user like ValidateAccessToken and checks
+// that it's issued for the audience and the client of the requirements and grants their scopes
+func (a *AuthenticationService) ValidateAccessTokenFor(accessToken string, required AccessTokenRequirements) (AccessTokenCustomClaims, error) {
+	claims, err := a.ValidateAccessToken(accessToken)
+	if err != nil {
+		return claims, err
+	}
+	if required.Audience != "" && claims.Audience != required.Audience {
+		a.logger.Println("[Error] access token is issued for another audience")
+		return claims, errors.Wrap(ErrInvalidToken, "Access token is issued for another audience")
+	}
+	if required.ClientID != "" && claims.ClientID != required.ClientID {
+		a.logger.Println("[Error] access token is issued to another client")
+		return claims, errors.Wrap(ErrInvalidToken, "Access token is issued to another client")
+	}
+	for _, s := range strings.Fields(required.Scope) {
+		if !hasScope(claims.Scope, s) {
+			a.logger.Println("[Error] access token doesn't grant the required scope")
+			return claims, errors.Wrapf(ErrInsufficientScope, "Access token doesn't grant the %s scope", s)
+		}
+	}
+	return claims, nil
+}
+
+// ValidateFirstPartyAccessToken validates the access token of a user which signed in to the
+// service directly. The tokens of the OAuth clients and the exchanged ones are rejected, so they
+// can't manage the account of the user.
+func (a *AuthenticationService) ValidateFirstPartyAccessToken(accessToken string) (AccessTokenCustomClaims, error) {
+	claims, err := a.ValidateAccessToken(accessToken)
+	if err != nil {
+		return claims, err
+	}
+	if claims.ClientID != "" || claims.Act != nil {
+		a.logger.Println("[Error] access token is issued to an OAuth client")
+		return claims, errors.Wrap(ErrInvalidToken, "Access token is issued to an OAuth client")
+	}
+	return claims, nil
+}
+
+func (a *AuthenticationService) GetUser(email string) (entity.User, error) {
+	user, err := a.dbService.GetUser(email)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return user, errors.Wrapf(ErrUserNotFound, "the user with %s email doesn't exist", email)
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve user from database")
+		return user, errors.Wrap(err, "Error can't retrieve user from database")
+	}
+	return user, nil
 }
@@ -4,22 +4,33 @@ import (
 	"errors"
 	"github.com/Hamifthi/authentication_microservice/entity"
 	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
 	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
 	"log"
 	"testing"
 )
 
-func initializeAuthAndDBService() (*AuthenticationService, *database.DatabaseServiceMock) {
+func initializeAuthAndDBService(t *testing.T) (*AuthenticationService, *database.DatabaseServiceMock) {
+	testutil.InitializeConfig(t)
 	dbService := database.DatabaseServiceMock{}
-	logger := log.Logger{}
-	authService := New(&dbService, &logger)
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	authService, err := New(&dbService, logger)
+	assert.Nil(t, err)
 	return authService, &dbService
 }
 
+func signInTestUser(t *testing.T, authService *AuthenticationService) entity.Tokens {
+	tokens, err := authService.SignIn(testutil.TestEmail, testutil.TestPassword)
+	assert.Nil(t, err)
+	return tokens
+}
+
 func TestSignUpWithInvalidEmail(t *testing.T) {
-	authService, _ := initializeAuthAndDBService()
+	authService, _ := initializeAuthAndDBService(t)
 	email := "test.com"
 	password := "123test123"
 	err := authService.SignUp(email, password)
@@ -28,7 +39,7 @@ func TestSignUpWithInvalidEmail(t *testing.T) {
 }
 
 func TestSignUpExistedEmail(t *testing.T) {
-	authService, dbService := initializeAuthAndDBService()
+	authService, dbService := initializeAuthAndDBService(t)
 	email := "test@test.com"
 	password := "123test123"
 	user := entity.User{Email: email, Password: password}
@@ -41,7 +52,7 @@ func TestSignUpExistedEmail(t *testing.T) {
 }
 
 func TestSignUpInvalidPassword(t *testing.T) {
-	authService, dbService := initializeAuthAndDBService()
+	authService, dbService := initializeAuthAndDBService(t)
 	err := internal.InitializeEnv("../../.env")
 	dbService.MockedGetUser = func(email string) (entity.User, error) {
 		return entity.User{}, nil
@@ -55,7 +66,7 @@ func TestSignUpInvalidPassword(t *testing.T) {
 }
 
 func TestSignUpSuccessfully(t *testing.T) {
-	authService, dbService := initializeAuthAndDBService()
+	authService, dbService := initializeAuthAndDBService(t)
 	_ = internal.InitializeEnv("../../test.env")
 	dbService.MockedGetUser = func(email string) (entity.User, error) {
 		return entity.User{}, nil
@@ -70,7 +81,7 @@ func TestSignUpSuccessfully(t *testing.T) {
 }
 
 func TestSignInWithInvalidEmail(t *testing.T) {
-	authService, _ := initializeAuthAndDBService()
+	authService, _ := initializeAuthAndDBService(t)
 	email := "test.com"
 	password := "123test123"
 	_, err := authService.SignIn(email, password)
@@ -79,7 +90,7 @@ func TestSignInWithInvalidEmail(t *testing.T) {
 }
 
 func TestSignInUserNotExist(t *testing.T) {
-	authService, dbService := initializeAuthAndDBService()
+	authService, dbService := initializeAuthAndDBService(t)
 	dbService.MockedGetUser = func(email string) (entity.User, error) {
 		return entity.User{}, errors.New("user doesn't exist")
 	}
@@ -91,7 +102,7 @@ func TestSignInUserNotExist(t *testing.T) {
 }
 
 func TestSignInUserSuccessfully(t *testing.T) {
-	authService, dbService := initializeAuthAndDBService()
+	authService, dbService := initializeAuthAndDBService(t)
 	_ = internal.InitializeEnv("../../test.env")
 	email := "test@test.com"
 	password := "587@_Testing123"
@@ -100,7 +111,198 @@ func TestSignInUserSuccessfully(t *testing.T) {
 	dbService.MockedGetUser = func(email string) (entity.User, error) {
 		return user, nil
 	}
+	dbService.MockedGetUserWebAuthnCredentials = func(email string) ([]entity.WebAuthnCredential, error) {
+		return nil, nil
+	}
+	sessions := mockSessions(dbService)
 	tokens, err := authService.SignIn(email, password)
 	assert.Nil(t, err)
 	assert.NotNil(t, tokens)
+	assert.Len(t, sessions, 1)
+}
+
+func TestRefreshAccessTokenRotatesRefreshToken(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	sessions := mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+	user, err := authService.ValidateRefreshToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "test@test.com", user.Email)
+
+	rotated, err := authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, rotated.AccessToken)
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+	assert.Len(t, sessions, 2)
+	var familyID string
+	for _, session := range sessions {
+		if familyID == "" {
+			familyID = session.FamilyID
+		}
+		assert.Equal(t, familyID, session.FamilyID)
+	}
+
+	_, err = authService.RefreshAccessToken(rotated.RefreshToken)
+	assert.Nil(t, err)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	sessions := mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+	rotated, err := authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "Refresh token reuse detected")
+	for _, session := range sessions {
+		assert.True(t, session.Revoked)
+	}
+
+	_, err = authService.RefreshAccessToken(rotated.RefreshToken)
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "Refresh token is revoked")
+	_, err = authService.ValidateAccessToken(rotated.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestRefreshTokenFromAnotherFamilyStaysValid(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	first := signInTestUser(t, authService)
+	second := signInTestUser(t, authService)
+	_, err := authService.RefreshAccessToken(first.RefreshToken)
+	assert.Nil(t, err)
+	_, err = authService.RefreshAccessToken(first.RefreshToken)
+	assert.NotNil(t, err)
+
+	_, err = authService.RefreshAccessToken(second.RefreshToken)
+	assert.Nil(t, err)
+}
+
+func TestValidateRefreshTokenRejectsAccessToken(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+	_, err := authService.ValidateRefreshToken(tokens.AccessToken)
+	assert.NotNil(t, err)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	tokens := signInTestUser(t, authService)
+	other := signInTestUser(t, authService)
+	err := authService.Logout(tokens.RefreshToken)
+	assert.Nil(t, err)
+
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "Refresh token is revoked")
+	_, err = authService.ValidateAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = authService.ValidateAccessToken(other.AccessToken)
+	assert.Nil(t, err)
+	_, err = authService.RefreshAccessToken(other.RefreshToken)
+	assert.Nil(t, err)
+}
+
+func TestLogoutAllInvalidatesEverySession(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	first := signInTestUser(t, authService)
+	second := signInTestUser(t, authService)
+	err := authService.LogoutAll(testutil.TestEmail)
+	assert.Nil(t, err)
+
+	_, err = authService.RefreshAccessToken(first.RefreshToken)
+	assert.NotNil(t, err)
+	_, err = authService.ValidateRefreshToken(second.RefreshToken)
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "Refresh token is malformed")
+	for _, tokens := range []entity.Tokens{first, second} {
+		_, err = authService.ValidateAccessToken(tokens.AccessToken)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+	}
+}
+
+func TestLogoutAllRevokesSessionFamilies(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	sessions := mockSessions(dbService)
+	mockUser(dbService)
+	signInTestUser(t, authService)
+	signInTestUser(t, authService)
+	assert.Len(t, sessions, 2)
+
+	assert.Nil(t, authService.LogoutAll(testutil.TestEmail))
+	for _, session := range sessions {
+		assert.True(t, session.Revoked, "the session family isn't revoked")
+	}
+}
+
+func TestGetActiveSessions(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+	first := signInTestUser(t, authService)
+	second := signInTestUser(t, authService)
+	_, err := authService.RefreshAccessToken(first.RefreshToken)
+	assert.Nil(t, err)
+	assert.Nil(t, authService.Logout(second.RefreshToken))
+
+	sessions, err := authService.GetActiveSessions(testutil.TestEmail)
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+
+	assert.Nil(t, authService.LogoutAll(testutil.TestEmail))
+	sessions, err = authService.GetActiveSessions(testutil.TestEmail)
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestTypedErrors(t *testing.T) {
+	authService, dbService := initializeAuthAndDBService(t)
+	mockSessions(dbService)
+	mockUser(dbService)
+
+	err := authService.SignUp("test.com", testutil.TestPassword)
+	assert.True(t, errors.Is(err, ErrInvalidEmail), "got %v", err)
+	err = authService.SignUp(testutil.TestEmail, testutil.TestPassword)
+	assert.True(t, errors.Is(err, ErrUserExists), "got %v", err)
+	err = authService.SignUp("new@test.com", "123test123")
+	assert.True(t, errors.Is(err, ErrWeakPassword), "got %v", err)
+	_, err = authService.SignIn(testutil.TestEmail, "wrong_Password123")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials), "got %v", err)
+	_, err = authService.SignIn("missing@test.com", testutil.TestPassword)
+	assert.True(t, errors.Is(err, ErrInvalidCredentials), "got %v", err)
+	_, err = authService.GetUser("missing@test.com")
+	assert.True(t, errors.Is(err, ErrUserNotFound), "got %v", err)
+
+	tokens := signInTestUser(t, authService)
+	_, err = authService.ValidateAccessToken("invalid")
+	assert.True(t, errors.Is(err, ErrInvalidToken), "got %v", err)
+	_, err = authService.ValidateRefreshToken(tokens.AccessToken)
+	assert.True(t, errors.Is(err, ErrInvalidToken), "got %v", err)
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.Nil(t, err)
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.True(t, errors.Is(err, ErrTokenReused), "got %v", err)
+	_, err = authService.RefreshAccessToken(tokens.RefreshToken)
+	assert.True(t, errors.Is(err, ErrTokenRevoked), "got %v", err)
+}
+
+func TestExpiredAccessToken(t *testing.T) {
+	authService, _ := initializeAuthAndDBService(t)
+	viper.Set("JwtExpiration", "-1")
+	accessToken, err := authService.generateAccessToken("", testutil.TestEmail, "", "")
+	assert.Nil(t, err)
+	_, err = authService.ValidateAccessToken(accessToken)
+	assert.True(t, errors.Is(err, ErrTokenExpired), "got %v", err)
 }
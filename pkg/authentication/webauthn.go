@@ -0,0 +1,451 @@
+package authentication
+
+import (
+	"encoding/base64"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	webAuthnSessionLifetime   = 5 * time.Minute
+	webAuthnRegistrationToken = "webauthn_registration"
+	webAuthnLoginToken        = "webauthn_login"
+)
+
+// webAuthnRPID is the relying party id which the passkeys are scoped to, it's the host of the
+// issuer by default and empty when the issuer isn't a URL
+func webAuthnRPID() string {
+	rpID, err := internal.GetEnv("WebAuthnRPID")
+	if err == nil && rpID != "" {
+		return rpID
+	}
+	iss, err := url.Parse(issuer())
+	if err == nil && iss.Hostname() != "" {
+		return iss.Hostname()
+	}
+	return ""
+}
+
+// webAuthnOrigin is the origin of the pages which run the ceremonies, it's the origin of the
+// issuer by default
+func webAuthnOrigin() string {
+	origin, err := internal.GetEnv("WebAuthnOrigin")
+	if err == nil && origin != "" {
+		return strings.TrimSuffix(origin, "/")
+	}
+	iss, err := url.Parse(issuer())
+	if err == nil && iss.Scheme != "" && iss.Host != "" {
+		return iss.Scheme + "://" + iss.Host
+	}
+	return "https://" + webAuthnRPID()
+}
+
+// newWebAuthn returns the relying party of the configured id and origin. The attestation isn't
+// requested, the passkeys are trusted because the signed in user registers them.
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Timeout: webAuthnSessionLifetime, TimeoutUVD: webAuthnSessionLifetime}
+	return webauthn.New(&webauthn.Config{
+		RPID:                  webAuthnRPID(),
+		RPDisplayName:         mfaIssuer(),
+		RPOrigins:             []string{webAuthnOrigin()},
+		AttestationPreference: protocol.PreferNoAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+// WebAuthnRegistration starts registering a credential, the public key is passed to
+// navigator.credentials.create and the session is sent back with the created credential
+type WebAuthnRegistration struct {
+	Session   string                                      `json:"session"`
+	PublicKey protocol.PublicKeyCredentialCreationOptions `json:"publicKey"`
+}
+
+// WebAuthnLogin starts signing in with a credential, the public key is passed to
+// navigator.credentials.get and the session is sent back with the assertion
+type WebAuthnLogin struct {
+	Session   string                                     `json:"session"`
+	PublicKey protocol.PublicKeyCredentialRequestOptions `json:"publicKey"`
+}
+
+type WebAuthnSessionData struct {
+	UserEmail      string               `json:"userEmail,omitempty"`
+	TokenType      string               `json:"tokenType"`
+	Ceremony       webauthn.SessionData `json:"ceremony"`
+	MFATokenID     string               `json:"mfaTokenId,omitempty"`
+	MFATokenExpiry int64                `json:"mfaTokenExpiry,omitempty"`
+}
+
+// WebAuthnSessionCustomClaims are the claims of the session token which keeps the challenge of a
+// ceremony between its steps, a session can only be finished once
+type WebAuthnSessionCustomClaims struct {
+	Data WebAuthnSessionData `json:"data"`
+	jwt.StandardClaims
+}
+
+// webAuthnUser is the user of the ceremonies with its passkeys, the user handle is the id of the user
+type webAuthnUser struct {
+	user        entity.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// webAuthnError types the errors of the ceremonies, an invalid signature or an unknown credential
+// rejects the credentials and the other errors the response
+func webAuthnError(err error, message string) error {
+	if errors.Is(err, ErrInvalidCredentials) {
+		return errors.Wrap(err, message)
+	}
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.Type == protocol.ErrAssertionSignature.Type {
+		return withType(ErrInvalidCredentials, errors.Wrap(err, message))
+	}
+	return withType(ErrInvalidWebAuthnResponse, errors.Wrap(err, message))
+}
+
+// toWebAuthnCredential converts the stored passkey to the credential of the ceremonies
+func toWebAuthnCredential(credential entity.WebAuthnCredential) (webauthn.Credential, error) {
+	id, err := base64.RawURLEncoding.DecodeString(credential.ID)
+	if err != nil {
+		return webauthn.Credential{}, errors.Wrap(err, "The id of the stored WebAuthn credential is malformed")
+	}
+	transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+	for _, transport := range credential.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+	return webauthn.Credential{
+		ID:              id,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.CredentialFlags{BackupEligible: credential.BackupEligible},
+		Authenticator:   webauthn.Authenticator{SignCount: uint32(credential.SignCount)},
+	}, nil
+}
+
+// getWebAuthnUser loads the passkeys of the user for the ceremonies
+func (a *AuthenticationService) getWebAuthnUser(user entity.User) (*webAuthnUser, error) {
+	stored, err := a.dbService.GetUserWebAuthnCredentials(user.Email)
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the WebAuthn credentials from database")
+		return nil, errors.Wrap(err, "Error can't retrieve the WebAuthn credentials from database")
+	}
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, credential := range stored {
+		converted, err := toWebAuthnCredential(credential)
+		if err != nil {
+			a.logger.Println("[Error] converting the WebAuthn credential")
+			return nil, err
+		}
+		credentials = append(credentials, converted)
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// generateWebAuthnSession issues the session token which keeps the data of a ceremony
+func (a *AuthenticationService) generateWebAuthnSession(data WebAuthnSessionData) (string, error) {
+	now := time.Now()
+	claims := WebAuthnSessionCustomClaims{
+		Data: data,
+		StandardClaims: jwt.StandardClaims{
+			Id:        internal.GenerateID(),
+			Issuer:    issuer(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(webAuthnSessionLifetime).Unix(),
+		},
+	}
+	session, err := a.signToken(claims)
+	if err != nil {
+		a.logger.Println("[Error] signing the WebAuthn session")
+		return "", errors.Wrap(err, "Error signing the WebAuthn session")
+	}
+	return session, nil
+}
+
+// useWebAuthnSession verifies the session token of the ceremony and revokes it, so a failed
+// ceremony has to start again with a new challenge
+func (a *AuthenticationService) useWebAuthnSession(session, tokenType string) (WebAuthnSessionCustomClaims, error) {
+	claims := WebAuthnSessionCustomClaims{}
+	token, err := jwt.ParseWithClaims(session, &claims, a.keys.VerifyKey)
+	if err != nil {
+		a.logger.Println("[Error] parsing the claims from WebAuthn session")
+		return claims, tokenError(err, "Error parsing the claims from WebAuthn session")
+	}
+	if !token.Valid || claims.Id == "" || claims.Data.Ceremony.Challenge == "" || claims.Data.TokenType != tokenType {
+		a.logger.Println("[Error] getting claims from token")
+		return claims, errors.Wrap(ErrInvalidToken, "Error getting claims from token")
+	}
+	err = a.useSingleUseToken(claims.Id, time.Unix(claims.ExpiresAt, 0), "WebAuthn session is already used")
+	return claims, err
+}
+
+// BeginWebAuthnRegistration returns the options of creating a passkey for the signed in user, who
+// confirms the password again so a leaked access token can't add a passkey. The credentials which
+// the user already has are excluded.
+func (a *AuthenticationService) BeginWebAuthnRegistration(email, password string) (WebAuthnRegistration, error) {
+	user, err := a.GetUser(email)
+	if err != nil {
+		return WebAuthnRegistration{}, err
+	}
+	err = checkPassword(user, password)
+	if err != nil {
+		return WebAuthnRegistration{}, err
+	}
+	passkeyUser, err := a.getWebAuthnUser(user)
+	if err != nil {
+		return WebAuthnRegistration{}, err
+	}
+	relyingParty, err := newWebAuthn()
+	if err != nil {
+		a.logger.Println("[Error] configuring the WebAuthn relying party")
+		return WebAuthnRegistration{}, errors.Wrap(err, "Error configuring the WebAuthn relying party")
+	}
+	excluded := webauthn.Credentials(passkeyUser.credentials).CredentialDescriptors()
+	creation, ceremony, err := relyingParty.BeginRegistration(passkeyUser, webauthn.WithExclusions(excluded))
+	if err != nil {
+		a.logger.Println("[Error] beginning the WebAuthn registration")
+		return WebAuthnRegistration{}, errors.Wrap(err, "Error beginning the WebAuthn registration")
+	}
+	session, err := a.generateWebAuthnSession(WebAuthnSessionData{
+		UserEmail: user.Email, TokenType: webAuthnRegistrationToken, Ceremony: *ceremony,
+	})
+	if err != nil {
+		return WebAuthnRegistration{}, err
+	}
+	return WebAuthnRegistration{Session: session, PublicKey: creation.Response}, nil
+}
+
+// FinishWebAuthnRegistration verifies the created credential and stores it as a passkey of the user
+func (a *AuthenticationService) FinishWebAuthnRegistration(email, session string, credential protocol.CredentialCreationResponse) error {
+	claims, err := a.useWebAuthnSession(session, webAuthnRegistrationToken)
+	if err != nil {
+		return err
+	}
+	if claims.Data.UserEmail != email {
+		return errors.Wrap(ErrInvalidToken, "The WebAuthn session belongs to another user")
+	}
+	parsed, err := credential.Parse()
+	if err != nil {
+		return webAuthnError(err, "The created credential is malformed")
+	}
+	passkeyUser, err := a.getSessionUser(email)
+	if err != nil {
+		return err
+	}
+	relyingParty, err := newWebAuthn()
+	if err != nil {
+		a.logger.Println("[Error] configuring the WebAuthn relying party")
+		return errors.Wrap(err, "Error configuring the WebAuthn relying party")
+	}
+	created, err := relyingParty.CreateCredential(passkeyUser, claims.Data.Ceremony, parsed)
+	if err != nil {
+		return webAuthnError(err, "The created credential is invalid")
+	}
+	transports := make([]string, 0, len(created.Transport))
+	for _, transport := range created.Transport {
+		transports = append(transports, string(transport))
+	}
+	err = a.dbService.CreateWebAuthnCredential(entity.WebAuthnCredential{
+		ID:              base64.RawURLEncoding.EncodeToString(created.ID),
+		Email:           email,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		BackupEligible:  created.Flags.BackupEligible,
+		SignCount:       int64(created.Authenticator.SignCount),
+		Transports:      transports,
+	})
+	if errors.Is(err, database.ErrWebAuthnCredentialExists) {
+		return errors.Wrap(ErrInvalidWebAuthnResponse, "The credential is already registered")
+	}
+	if err != nil {
+		a.logger.Println("[Error] storing the WebAuthn credential")
+		return errors.Wrap(err, "Error storing the WebAuthn credential")
+	}
+	a.alert(email, passkeyAddedNotification)
+	return nil
+}
+
+// BeginWebAuthnLogin returns the options of signing in with a passkey. The passkey is the second
+// factor when the MFA token of signing in is given, and the options list the passkeys of its user.
+// Otherwise any discoverable passkey signs in without the password and the user has to be
+// verified by the authenticator, the options don't depend on any account so they don't reveal
+// which users exist.
+func (a *AuthenticationService) BeginWebAuthnLogin(mfaToken string) (WebAuthnLogin, error) {
+	relyingParty, err := newWebAuthn()
+	if err != nil {
+		a.logger.Println("[Error] configuring the WebAuthn relying party")
+		return WebAuthnLogin{}, errors.Wrap(err, "Error configuring the WebAuthn relying party")
+	}
+	data := WebAuthnSessionData{TokenType: webAuthnLoginToken}
+	var assertion *protocol.CredentialAssertion
+	var ceremony *webauthn.SessionData
+	if mfaToken == "" {
+		assertion, ceremony, err = relyingParty.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		challenge, user, err := a.parseMFAChallenge(mfaToken)
+		if err != nil {
+			return WebAuthnLogin{}, err
+		}
+		passkeyUser, err := a.getWebAuthnUser(user)
+		if err != nil {
+			return WebAuthnLogin{}, err
+		}
+		if len(passkeyUser.credentials) == 0 {
+			return WebAuthnLogin{}, errors.Wrap(ErrInvalidCredentials, "The user of the MFA token has no passkey")
+		}
+		data.UserEmail = user.Email
+		data.MFATokenID = challenge.Id
+		data.MFATokenExpiry = challenge.ExpiresAt
+		assertion, ceremony, err = relyingParty.BeginLogin(passkeyUser)
+	}
+	if err != nil {
+		a.logger.Println("[Error] beginning the WebAuthn login")
+		return WebAuthnLogin{}, errors.Wrap(err, "Error beginning the WebAuthn login")
+	}
+	data.Ceremony = *ceremony
+	session, err := a.generateWebAuthnSession(data)
+	if err != nil {
+		return WebAuthnLogin{}, err
+	}
+	return WebAuthnLogin{Session: session, PublicKey: assertion.Response}, nil
+}
+
+// findPasskeyUser returns the user of the discoverable passkey which the assertion is made with
+func (a *AuthenticationService) findPasskeyUser(rawID, userHandle []byte) (*webAuthnUser, error) {
+	stored, err := a.dbService.GetWebAuthnCredential(base64.RawURLEncoding.EncodeToString(rawID))
+	if errors.Is(err, database.ErrWebAuthnCredentialNotFound) {
+		return nil, errors.Wrap(ErrInvalidCredentials, "The WebAuthn credential isn't registered")
+	}
+	if err != nil {
+		a.logger.Println("[Error] can't retrieve the WebAuthn credential from database")
+		return nil, errors.Wrap(err, "Error can't retrieve the WebAuthn credential from database")
+	}
+	user, err := a.GetUser(stored.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, errors.Wrap(ErrInvalidCredentials, "The user of the WebAuthn credential doesn't exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if string(userHandle) != user.ID {
+		return nil, errors.Wrap(ErrInvalidCredentials, "The user handle doesn't match the credential")
+	}
+	return a.getWebAuthnUser(user)
+}
+
+// getSessionUser returns the user who started the ceremony with its passkeys
+func (a *AuthenticationService) getSessionUser(email string) (*webAuthnUser, error) {
+	user, err := a.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+	return a.getWebAuthnUser(user)
+}
+
+// verifyAssertion checks the assertion of the credential for the session, stores the new signature
+// counter of the credential and returns its user
+func (a *AuthenticationService) verifyAssertion(claims WebAuthnSessionCustomClaims, credential protocol.CredentialAssertionResponse) (entity.User, error) {
+	parsed, err := credential.Parse()
+	if err != nil {
+		return entity.User{}, webAuthnError(err, "The assertion is malformed")
+	}
+	relyingParty, err := newWebAuthn()
+	if err != nil {
+		a.logger.Println("[Error] configuring the WebAuthn relying party")
+		return entity.User{}, errors.Wrap(err, "Error configuring the WebAuthn relying party")
+	}
+	var passkeyUser *webAuthnUser
+	var validated *webauthn.Credential
+	if claims.Data.UserEmail != "" {
+		passkeyUser, err = a.getSessionUser(claims.Data.UserEmail)
+		if err != nil {
+			return entity.User{}, err
+		}
+		validated, err = relyingParty.ValidateLogin(passkeyUser, claims.Data.Ceremony, parsed)
+	} else {
+		handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+			found, err := a.findPasskeyUser(rawID, userHandle)
+			if err != nil {
+				return nil, err
+			}
+			passkeyUser = found
+			return found, nil
+		}
+		_, validated, err = relyingParty.ValidatePasskeyLogin(handler, claims.Data.Ceremony, parsed)
+	}
+	if err != nil {
+		return entity.User{}, webAuthnError(err, "The assertion is invalid")
+	}
+	// the counter only stays zero for the authenticators which don't count, otherwise it grows
+	// unless the authenticator is cloned
+	if validated.Authenticator.CloneWarning {
+		return entity.User{}, errors.Wrap(ErrInvalidCredentials, "The WebAuthn signature counter didn't increase")
+	}
+	err = a.dbService.UpdateWebAuthnCredential(entity.WebAuthnCredential{
+		ID:         base64.RawURLEncoding.EncodeToString(validated.ID),
+		SignCount:  int64(validated.Authenticator.SignCount),
+		LastUsedAt: time.Now(),
+	})
+	if err != nil {
+		a.logger.Println("[Error] updating the WebAuthn credential")
+		return entity.User{}, errors.Wrap(err, "Error updating the WebAuthn credential")
+	}
+	return passkeyUser.user, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion of the passkey and issues the tokens of its user, the
+// MFA token which the session was started with is used up
+func (a *AuthenticationService) FinishWebAuthnLogin(session string, credential protocol.CredentialAssertionResponse) (entity.Tokens, error) {
+	emptyTokens := entity.Tokens{AccessToken: "", RefreshToken: ""}
+	claims, err := a.useWebAuthnSession(session, webAuthnLoginToken)
+	if err != nil {
+		return emptyTokens, err
+	}
+	if claims.Data.MFATokenID != "" {
+		err = a.checkSingleUseToken(claims.Data.MFATokenID, "MFA token is already used")
+		if err != nil {
+			return emptyTokens, err
+		}
+	}
+	user, err := a.verifyAssertion(claims, credential)
+	if err != nil {
+		return emptyTokens, err
+	}
+	err = checkEmailVerified(user)
+	if err != nil {
+		return emptyTokens, err
+	}
+	if claims.Data.MFATokenID != "" {
+		err = a.useSingleUseToken(claims.Data.MFATokenID, time.Unix(claims.Data.MFATokenExpiry, 0), "MFA token is already used")
+		if err != nil {
+			return emptyTokens, err
+		}
+	}
+	return a.issueTokens(user, entity.Session{FamilyID: internal.GenerateID()}, "")
+}
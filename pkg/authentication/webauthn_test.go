@@ -0,0 +1,307 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Hamifthi/authentication_microservice/internal/testutil"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func decodeCreation(t *testing.T, credentialJSON []byte) protocol.CredentialCreationResponse {
+	credential := protocol.CredentialCreationResponse{}
+	assert.Nil(t, json.Unmarshal(credentialJSON, &credential))
+	return credential
+}
+
+func decodeAssertion(t *testing.T, credentialJSON []byte) protocol.CredentialAssertionResponse {
+	credential := protocol.CredentialAssertionResponse{}
+	assert.Nil(t, json.Unmarshal(credentialJSON, &credential))
+	return credential
+}
+
+// registerTestAuthenticator registers a new software authenticator as a passkey of the test user
+func registerTestAuthenticator(t *testing.T, authService *AuthenticationService) *testutil.Authenticator {
+	authenticator := testutil.NewAuthenticator(t)
+	registration, err := authService.BeginWebAuthnRegistration(testutil.TestEmail, testutil.TestPassword)
+	assert.Nil(t, err)
+	credential := decodeCreation(t, authenticator.Create(t, registration.PublicKey.Challenge.String()))
+	assert.Nil(t, authService.FinishWebAuthnRegistration(testutil.TestEmail, registration.Session, credential))
+	return authenticator
+}
+
+func getTestUserID(t *testing.T, authService *AuthenticationService) string {
+	user, err := authService.GetUser(testutil.TestEmail)
+	assert.Nil(t, err)
+	return user.ID
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	authService := initializeOAuthService(t)
+	registration, err := authService.BeginWebAuthnRegistration(testutil.TestEmail, testutil.TestPassword)
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestRPID, registration.PublicKey.RelyingParty.ID)
+	assert.Equal(t, testutil.TestEmail, registration.PublicKey.User.Name)
+	assert.Empty(t, registration.PublicKey.CredentialExcludeList)
+
+	authenticator := testutil.NewAuthenticator(t)
+	credential := decodeCreation(t, authenticator.Create(t, registration.PublicKey.Challenge.String()))
+	assert.Nil(t, authService.FinishWebAuthnRegistration(testutil.TestEmail, registration.Session, credential))
+	err = authService.FinishWebAuthnRegistration(testutil.TestEmail, registration.Session, credential)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	stored, err := authService.dbService.GetWebAuthnCredential(authenticator.ID())
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, stored.Email)
+	assert.Equal(t, "none", stored.AttestationType)
+	assert.Equal(t, []string{"internal"}, stored.Transports)
+
+	// the registered credential is excluded and can't be registered again
+	registration, err = authService.BeginWebAuthnRegistration(testutil.TestEmail, testutil.TestPassword)
+	assert.Nil(t, err)
+	if assert.Len(t, registration.PublicKey.CredentialExcludeList, 1) {
+		assert.Equal(t, authenticator.ID(), registration.PublicKey.CredentialExcludeList[0].CredentialID.String())
+	}
+	credential = decodeCreation(t, authenticator.Create(t, registration.PublicKey.Challenge.String()))
+	err = authService.FinishWebAuthnRegistration(testutil.TestEmail, registration.Session, credential)
+	assert.ErrorIs(t, err, ErrInvalidWebAuthnResponse)
+
+	// packed self attestation is signed by the credential
+	authenticator = testutil.NewAuthenticator(t)
+	authenticator.Format = "packed"
+	registration, err = authService.BeginWebAuthnRegistration(testutil.TestEmail, testutil.TestPassword)
+	assert.Nil(t, err)
+	credential = decodeCreation(t, authenticator.Create(t, registration.PublicKey.Challenge.String()))
+	assert.Nil(t, authService.FinishWebAuthnRegistration(testutil.TestEmail, registration.Session, credential))
+}
+
+func TestWebAuthnRegistrationErrors(t *testing.T) {
+	authService := initializeOAuthService(t)
+	assert.Nil(t, authService.SignUp("other@test.com", testutil.TestPassword))
+	authenticator := testutil.NewAuthenticator(t)
+	tests := []struct {
+		name    string
+		forge   func(authenticator *testutil.Authenticator, challenge string) string
+		email   string
+		wantErr error
+	}{
+		{"WrongOrigin", func(a *testutil.Authenticator, challenge string) string {
+			a.Origin = "https://evil.example.com"
+			return challenge
+		}, testutil.TestEmail, ErrInvalidWebAuthnResponse},
+		{"WrongRPID", func(a *testutil.Authenticator, challenge string) string {
+			a.RPID = "evil.example.com"
+			return challenge
+		}, testutil.TestEmail, ErrInvalidWebAuthnResponse},
+		{"WrongChallenge", func(a *testutil.Authenticator, challenge string) string {
+			return "AAAA" + challenge[4:]
+		}, testutil.TestEmail, ErrInvalidWebAuthnResponse},
+		{"OtherUser", func(a *testutil.Authenticator, challenge string) string {
+			return challenge
+		}, "other@test.com", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forged := *authenticator
+			registration, err := authService.BeginWebAuthnRegistration(testutil.TestEmail, testutil.TestPassword)
+			assert.Nil(t, err)
+			challenge := tt.forge(&forged, registration.PublicKey.Challenge.String())
+			credential := decodeCreation(t, forged.Create(t, challenge))
+			err = authService.FinishWebAuthnRegistration(tt.email, registration.Session, credential)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+	_, err := authService.dbService.GetWebAuthnCredential(authenticator.ID())
+	assert.NotNil(t, err)
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+	authService := initializeOAuthService(t)
+	authenticator := registerTestAuthenticator(t, authService)
+	userID := getTestUserID(t, authService)
+
+	// a discoverable credential is chosen by the user
+	login, err := authService.BeginWebAuthnLogin("")
+	assert.Nil(t, err)
+	assert.Empty(t, login.PublicKey.AllowedCredentials)
+	assert.Equal(t, protocol.VerificationRequired, login.PublicKey.UserVerification)
+	tokens, err := authService.FinishWebAuthnLogin(login.Session, decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), userID)))
+	assert.Nil(t, err)
+	claims, err := authService.ValidateAccessToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, testutil.TestEmail, claims.Data.UserEmail)
+
+	// signing in without the password needs user verification
+	authenticator.UserVerification = false
+	login, err = authService.BeginWebAuthnLogin("")
+	assert.Nil(t, err)
+	_, err = authService.FinishWebAuthnLogin(login.Session, decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), userID)))
+	assert.ErrorIs(t, err, ErrInvalidWebAuthnResponse)
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	authService := initializeOAuthService(t)
+	enableTestMFA(t, authService)
+	authenticator := registerTestAuthenticator(t, authService)
+	authenticator.UserVerification = false
+	userID := getTestUserID(t, authService)
+
+	challenge := signInTestUser(t, authService)
+	assert.NotEmpty(t, challenge.MFAToken)
+	login, err := authService.BeginWebAuthnLogin(challenge.MFAToken)
+	assert.Nil(t, err)
+	if assert.Len(t, login.PublicKey.AllowedCredentials, 1) {
+		assert.Equal(t, authenticator.ID(), login.PublicKey.AllowedCredentials[0].CredentialID.String())
+	}
+	assert.Equal(t, protocol.VerificationPreferred, login.PublicKey.UserVerification)
+	tokens, err := authService.FinishWebAuthnLogin(login.Session, decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), userID)))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	// the MFA token is used up by the passkey
+	_, err = authService.VerifyMFA(challenge.MFAToken, "000000")
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = authService.BeginWebAuthnLogin(challenge.MFAToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = authService.BeginWebAuthnLogin("invalid")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestWebAuthnOnlySecondFactor(t *testing.T) {
+	authService := initializeOAuthService(t)
+	_, err := authService.BeginWebAuthnRegistration(testutil.TestEmail, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	authenticator := registerTestAuthenticator(t, authService)
+	authenticator.UserVerification = false
+	userID := getTestUserID(t, authService)
+
+	// the passkey is the second factor of signing in with the password, without any TOTP
+	challenge := signInTestUser(t, authService)
+	assert.Empty(t, challenge.AccessToken)
+	assert.NotEmpty(t, challenge.MFAToken)
+	_, err = authService.VerifyMFA(challenge.MFAToken, "000000")
+	assert.ErrorIs(t, err, ErrMFANotEnabled)
+	login, err := authService.BeginWebAuthnLogin(challenge.MFAToken)
+	assert.Nil(t, err)
+	tokens, err := authService.FinishWebAuthnLogin(login.Session, decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), userID)))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	// the single step pages can't verify the passkey
+	_, err = authService.Authorize(testAuthorizationRequest("openid"), testutil.TestEmail, testutil.TestPassword, "")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+}
+
+func TestWebAuthnLoginErrors(t *testing.T) {
+	authService := initializeOAuthService(t)
+	authenticator := registerTestAuthenticator(t, authService)
+	authenticator.SignCount = 10
+	userID := getTestUserID(t, authService)
+
+	login, err := authService.BeginWebAuthnLogin("")
+	assert.Nil(t, err)
+	credential := decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), userID))
+	_, err = authService.FinishWebAuthnLogin(login.Session, credential)
+	assert.Nil(t, err)
+	// the session can only be finished once
+	_, err = authService.FinishWebAuthnLogin(login.Session, credential)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	tests := []struct {
+		name    string
+		forge   func(authenticator *testutil.Authenticator, challenge string) (string, string)
+		wantErr error
+	}{
+		{"WrongOrigin", func(a *testutil.Authenticator, challenge string) (string, string) {
+			a.Origin = "https://evil.example.com"
+			return challenge, userID
+		}, ErrInvalidWebAuthnResponse},
+		{"WrongRPID", func(a *testutil.Authenticator, challenge string) (string, string) {
+			a.RPID = "evil.example.com"
+			return challenge, userID
+		}, ErrInvalidWebAuthnResponse},
+		{"WrongChallenge", func(a *testutil.Authenticator, challenge string) (string, string) {
+			return "AAAA" + challenge[4:], userID
+		}, ErrInvalidWebAuthnResponse},
+		{"WrongSignature", func(a *testutil.Authenticator, challenge string) (string, string) {
+			a.Key = testutil.NewAuthenticator(t).Key
+			return challenge, userID
+		}, ErrInvalidCredentials},
+		{"SignCountRegression", func(a *testutil.Authenticator, challenge string) (string, string) {
+			a.SignCount = 5
+			return challenge, userID
+		}, ErrInvalidCredentials},
+		{"UnknownCredential", func(a *testutil.Authenticator, challenge string) (string, string) {
+			a.CredentialID = []byte("unknown")
+			return challenge, userID
+		}, ErrInvalidCredentials},
+		{"WrongUserHandle", func(a *testutil.Authenticator, challenge string) (string, string) {
+			return challenge, "otherUserID"
+		}, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forged := *authenticator
+			login, err := authService.BeginWebAuthnLogin("")
+			assert.Nil(t, err)
+			challenge, userHandle := tt.forge(&forged, login.PublicKey.Challenge.String())
+			_, err = authService.FinishWebAuthnLogin(login.Session, decodeAssertion(t, forged.Get(t, challenge, userHandle)))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	// the invalid assertions don't change the counter
+	login, err = authService.BeginWebAuthnLogin("")
+	assert.Nil(t, err)
+	_, err = authService.FinishWebAuthnLogin(login.Session, decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), userID)))
+	assert.Nil(t, err)
+}
+
+func TestConcurrentWebAuthnLogin(t *testing.T) {
+	authService := initializeOAuthService(t)
+	authenticator := registerTestAuthenticator(t, authService)
+	login, err := authService.BeginWebAuthnLogin("")
+	assert.Nil(t, err)
+	credential := decodeAssertion(t, authenticator.Get(t, login.PublicKey.Challenge.String(), getTestUserID(t, authService)))
+	var signedIn, revoked int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := authService.FinishWebAuthnLogin(login.Session, credential)
+			if err == nil {
+				atomic.AddInt32(&signedIn, 1)
+			} else if errors.Is(err, ErrTokenRevoked) {
+				atomic.AddInt32(&revoked, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), signedIn)
+	assert.Equal(t, int32(9), revoked)
+}
+
+func TestWebAuthnRPIDConfig(t *testing.T) {
+	authService := initializeOAuthService(t)
+	assert.Nil(t, authService.CheckConfig())
+	viper.Set("WebAuthnRPID", "")
+	t.Cleanup(func() { viper.Set("WebAuthnRPID", testutil.TestRPID) })
+	assert.NotNil(t, authService.CheckConfig())
+	viper.Set("Issuer", "https://auth.example.com")
+	t.Cleanup(func() { viper.Set("Issuer", "") })
+	assert.Nil(t, authService.CheckConfig())
+	assert.Equal(t, "auth.example.com", webAuthnRPID())
+}
+
+func TestBaseURLConfig(t *testing.T) {
+	authService := initializeOAuthService(t)
+	t.Cleanup(func() { viper.Set("BaseURL", testutil.TestBaseURL) })
+	for _, base := range []string{"", "authService", "/path"} {
+		viper.Set("BaseURL", base)
+		assert.NotNil(t, authService.CheckConfig(), base)
+	}
+}
@@ -0,0 +1,106 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/internal"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/Hamifthi/authentication_microservice/pkg/database/databasetest"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+var logger = log.New(ioutil.Discard, "", log.LstdFlags)
+
+func TestMemoryContract(t *testing.T) {
+	databasetest.RunContract(t, func(t *testing.T) database.DatabaseInterface {
+		return database.NewMemorySrv(logger)
+	})
+}
+
+// TestPostgresContract runs against the database of the POSTGRES_TEST_DSN environment variable,
+// its tables are truncated before every test
+func TestPostgresContract(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN isn't set")
+	}
+	db, err := internal.CreateDBConnection(dsn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, internal.AutoMigrate(db, entity.User{}, entity.Session{}, entity.RevokedToken{}, entity.AuthorizationCode{}, entity.Client{}, entity.DeviceCode{}, entity.WebAuthnCredential{}))
+	databasetest.RunContract(t, func(t *testing.T) database.DatabaseInterface {
+		assert.Nil(t, db.Exec("TRUNCATE users, sessions, revoked_tokens, authorization_codes, clients, device_codes, web_authn_credentials").Error)
+		return database.New(db, logger)
+	})
+}
+
+// TestMongoContract runs against the server of the MONGO_TEST_URI environment variable, every
+// test uses a new database which is dropped afterwards
+func TestMongoContract(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI isn't set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	databasetest.RunContract(t, func(t *testing.T) database.DatabaseInterface {
+		db := client.Database(fmt.Sprintf("auth_contract_%d", time.Now().UnixNano()))
+		t.Cleanup(func() { db.Drop(ctx) })
+		dbService := database.NewMongoSrv(db.Collection("users"), ctx, logger)
+		assert.Nil(t, dbService.CreateIndexes())
+		return dbService
+	})
+}
+
+// TestMongoObjectIDUser updates a user which is created with an ObjectID _id, like the users of
+// the collections which are older than the string ids
+func TestMongoObjectIDUser(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI isn't set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database(fmt.Sprintf("auth_objectid_%d", time.Now().UnixNano()))
+	defer db.Drop(ctx)
+	id := primitive.NewObjectID()
+	_, err = db.Collection("users").InsertOne(ctx, bson.D{
+		{Key: "_id", Value: id}, {Key: "email", Value: "test@test.com"}, {Key: "hashedpassword", Value: "hash"},
+	})
+	assert.Nil(t, err)
+	dbService := database.NewMongoSrv(db.Collection("users"), ctx, logger)
+
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, id.Hex(), user.ID)
+	user.TokenHash = "rotated"
+	user.MFAFailedAttempts = 3
+	assert.Nil(t, dbService.UpdateUser(user))
+	user, err = dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated", user.TokenHash)
+	assert.Equal(t, 3, user.MFAFailedAttempts)
+	assert.Equal(t, "hash", user.HashedPassword)
+	count, err := db.Collection("users").CountDocuments(ctx, bson.D{{Key: "_id", Value: id}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,590 @@
+// Package databasetest holds the behaviour every database.DatabaseInterface backend has to follow
+package databasetest
+
+import (
+	"errors"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/Hamifthi/authentication_microservice/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Factory returns an empty database service, it's called once for every test of the contract
+type Factory func(t *testing.T) database.DatabaseInterface
+
+// RunContract runs the storage contract against the backend which is created by the factory
+func RunContract(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, dbService database.DatabaseInterface)
+	}{
+		{"UserNotFound", testUserNotFound},
+		{"CreateAndGetUser", testCreateAndGetUser},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"UpdateUser", testUpdateUser},
+		{"UpdateMissingUser", testUpdateMissingUser},
+		{"CountMFAAttempt", testCountMFAAttempt},
+		{"UseTOTPCounter", testUseTOTPCounter},
+		{"UseRecoveryCode", testUseRecoveryCode},
+		{"SessionNotFound", testSessionNotFound},
+		{"DuplicateSession", testDuplicateSession},
+		{"CreateAndGetSession", testCreateAndGetSession},
+		{"UserSessions", testUserSessions},
+		{"UseSession", testUseSession},
+		{"RevokeSessionFamily", testRevokeSessionFamily},
+		{"RevokeToken", testRevokeToken},
+		{"AuthorizationCode", testAuthorizationCode},
+		{"SaveClient", testSaveClient},
+		{"DeviceCode", testDeviceCode},
+		{"WebAuthnCredential", testWebAuthnCredential},
+		{"ConcurrentCreateUser", testConcurrentCreateUser},
+		{"ConcurrentUseSession", testConcurrentUseSession},
+		{"ConcurrentRevokeToken", testConcurrentRevokeToken},
+		{"ConcurrentCountMFAAttempt", testConcurrentCountMFAAttempt},
+		{"ConcurrentUseTOTPCounter", testConcurrentUseTOTPCounter},
+		{"ConcurrentUseRecoveryCode", testConcurrentUseRecoveryCode},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+func newSession(id, familyID, email string) entity.Session {
+	return entity.Session{
+		ID:        id,
+		FamilyID:  familyID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Millisecond),
+	}
+}
+
+func testUserNotFound(t *testing.T, dbService database.DatabaseInterface) {
+	_, err := dbService.GetUser("missing@test.com")
+	assert.True(t, errors.Is(err, database.ErrUserNotFound), "got %v", err)
+}
+
+func testCreateAndGetUser(t *testing.T, dbService database.DatabaseInterface) {
+	before := time.Now().Add(-time.Second)
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, user.ID)
+	assert.Equal(t, "test@test.com", user.Email)
+	assert.Equal(t, "hashedPass", user.HashedPassword)
+	assert.Equal(t, "tokenHash", user.TokenHash)
+	assert.Empty(t, user.Password)
+	assert.True(t, user.CreatedAt.After(before), "created at isn't set")
+	assert.True(t, user.UpdatedAt.After(before), "updated at isn't set")
+}
+
+func testDuplicateEmail(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	err := dbService.CreateUser("test@test.com", "otherPass", "otherHash")
+	assert.True(t, errors.Is(err, database.ErrUserExists), "got %v", err)
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "hashedPass", user.HashedPassword)
+}
+
+func testUpdateUser(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	user.HashedPassword = "newHashedPass"
+	user.TokenHash = "newTokenHash"
+	user.EmailVerified = true
+	user.MFAEnabled = true
+	user.TOTPSecret = "secret"
+	user.TOTPLastCounter = 42
+	user.RecoveryCodes = []string{"first", "second"}
+	assert.Nil(t, dbService.UpdateUser(user))
+	updatedUser, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, updatedUser.ID)
+	assert.Equal(t, "newHashedPass", updatedUser.HashedPassword)
+	assert.Equal(t, "newTokenHash", updatedUser.TokenHash)
+	assert.True(t, updatedUser.EmailVerified)
+	assert.True(t, updatedUser.MFAEnabled)
+	assert.Equal(t, "secret", updatedUser.TOTPSecret)
+	assert.Equal(t, int64(42), updatedUser.TOTPLastCounter)
+	assert.Equal(t, []string{"first", "second"}, updatedUser.RecoveryCodes)
+	assert.True(t, user.CreatedAt.Equal(updatedUser.CreatedAt), "created at is changed")
+	assert.True(t, updatedUser.UpdatedAt.After(user.UpdatedAt), "updated at isn't changed")
+}
+
+func testUpdateMissingUser(t *testing.T, dbService database.DatabaseInterface) {
+	err := dbService.UpdateUser(entity.User{Email: "missing@test.com", TokenHash: "tokenHash"})
+	assert.True(t, errors.Is(err, database.ErrUserNotFound), "got %v", err)
+}
+
+func testCountMFAAttempt(t *testing.T, dbService database.DatabaseInterface) {
+	now := time.Now().Truncate(time.Millisecond)
+	lockedUntil := now.Add(time.Minute)
+	err := dbService.CountMFAAttempt("test@test.com", 3, now, lockedUntil)
+	assert.True(t, errors.Is(err, database.ErrUserNotFound), "got %v", err)
+
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, dbService.CountMFAAttempt("test@test.com", 3, now, lockedUntil))
+	}
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, user.MFAFailedAttempts)
+	assert.True(t, user.MFALockedUntil.Equal(lockedUntil), "got %v", user.MFALockedUntil)
+	err = dbService.CountMFAAttempt("test@test.com", 3, now, lockedUntil)
+	assert.True(t, errors.Is(err, database.ErrMFALocked), "got %v", err)
+
+	// the counting restarts once the lockout is over
+	assert.Nil(t, dbService.CountMFAAttempt("test@test.com", 3, lockedUntil, lockedUntil.Add(time.Minute)))
+	user, err = dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, user.MFAFailedAttempts)
+	assert.True(t, user.MFALockedUntil.Equal(lockedUntil), "got %v", user.MFALockedUntil)
+}
+
+func testUseTOTPCounter(t *testing.T, dbService database.DatabaseInterface) {
+	err := dbService.UseTOTPCounter("test@test.com", 5)
+	assert.True(t, errors.Is(err, database.ErrUserNotFound), "got %v", err)
+
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	now := time.Now().Truncate(time.Millisecond)
+	assert.Nil(t, dbService.CountMFAAttempt("test@test.com", 1, now, now.Add(time.Minute)))
+	assert.Nil(t, dbService.UseTOTPCounter("test@test.com", 5))
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), user.TOTPLastCounter)
+	assert.Equal(t, 0, user.MFAFailedAttempts)
+	assert.True(t, user.MFALockedUntil.IsZero(), "got %v", user.MFALockedUntil)
+
+	err = dbService.UseTOTPCounter("test@test.com", 5)
+	assert.True(t, errors.Is(err, database.ErrTOTPCounterUsed), "got %v", err)
+	err = dbService.UseTOTPCounter("test@test.com", 4)
+	assert.True(t, errors.Is(err, database.ErrTOTPCounterUsed), "got %v", err)
+	assert.Nil(t, dbService.UseTOTPCounter("test@test.com", 6))
+}
+
+func testUseRecoveryCode(t *testing.T, dbService database.DatabaseInterface) {
+	err := dbService.UseRecoveryCode("test@test.com", "first")
+	assert.True(t, errors.Is(err, database.ErrUserNotFound), "got %v", err)
+
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	user.RecoveryCodes = []string{"first", "second"}
+	user.MFAFailedAttempts = 2
+	assert.Nil(t, dbService.UpdateUser(user))
+
+	assert.Nil(t, dbService.UseRecoveryCode("test@test.com", "first"))
+	err = dbService.UseRecoveryCode("test@test.com", "first")
+	assert.True(t, errors.Is(err, database.ErrRecoveryCodeNotFound), "got %v", err)
+	user, err = dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second"}, user.RecoveryCodes)
+	assert.Equal(t, 0, user.MFAFailedAttempts)
+}
+
+func testSessionNotFound(t *testing.T, dbService database.DatabaseInterface) {
+	_, err := dbService.GetSession("missing")
+	assert.True(t, errors.Is(err, database.ErrSessionNotFound), "got %v", err)
+	err = dbService.UseSession("missing")
+	assert.True(t, errors.Is(err, database.ErrSessionNotFound), "got %v", err)
+}
+
+func testDuplicateSession(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateSession(newSession("id", "family", "test@test.com")))
+	err := dbService.CreateSession(newSession("id", "otherFamily", "test@test.com"))
+	assert.True(t, errors.Is(err, database.ErrSessionExists), "got %v", err)
+}
+
+func testCreateAndGetSession(t *testing.T, dbService database.DatabaseInterface) {
+	before := time.Now().Add(-time.Second)
+	session := newSession("id", "family", "test@test.com")
+	session.ClientID = "client"
+	session.Scope = "openid"
+	assert.Nil(t, dbService.CreateSession(session))
+	storedSession, err := dbService.GetSession("id")
+	assert.Nil(t, err)
+	assert.Equal(t, session.FamilyID, storedSession.FamilyID)
+	assert.Equal(t, session.Email, storedSession.Email)
+	assert.Equal(t, session.ClientID, storedSession.ClientID)
+	assert.Equal(t, session.Scope, storedSession.Scope)
+	assert.False(t, storedSession.Used)
+	assert.False(t, storedSession.Revoked)
+	assert.True(t, session.ExpiresAt.Equal(storedSession.ExpiresAt), "expires at is changed")
+	assert.True(t, storedSession.CreatedAt.After(before), "created at isn't set")
+}
+
+func testUserSessions(t *testing.T, dbService database.DatabaseInterface) {
+	sessions, err := dbService.GetUserSessions("test@test.com")
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+
+	for _, id := range []string{"first", "second", "third"} {
+		assert.Nil(t, dbService.CreateSession(newSession(id, "family", "test@test.com")))
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Nil(t, dbService.CreateSession(newSession("other", "otherFamily", "other@test.com")))
+	sessions, err = dbService.GetUserSessions("test@test.com")
+	assert.Nil(t, err)
+	if assert.Len(t, sessions, 3) {
+		assert.Equal(t, "first", sessions[0].ID)
+		assert.Equal(t, "second", sessions[1].ID)
+		assert.Equal(t, "third", sessions[2].ID)
+	}
+}
+
+func testUseSession(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateSession(newSession("id", "family", "test@test.com")))
+	assert.Nil(t, dbService.UseSession("id"))
+	err := dbService.UseSession("id")
+	assert.True(t, errors.Is(err, database.ErrSessionAlreadyUsed), "got %v", err)
+	session, err := dbService.GetSession("id")
+	assert.Nil(t, err)
+	assert.True(t, session.Used)
+}
+
+func testRevokeSessionFamily(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateSession(newSession("first", "family", "test@test.com")))
+	assert.Nil(t, dbService.CreateSession(newSession("second", "family", "test@test.com")))
+	assert.Nil(t, dbService.CreateSession(newSession("other", "otherFamily", "test@test.com")))
+	assert.Nil(t, dbService.RevokeSessionFamily("family"))
+	assert.Nil(t, dbService.RevokeSessionFamily("missing"))
+
+	for id, revoked := range map[string]bool{"first": true, "second": true, "other": false} {
+		session, err := dbService.GetSession(id)
+		assert.Nil(t, err)
+		assert.Equal(t, revoked, session.Revoked, id)
+	}
+}
+
+func testRevokeToken(t *testing.T, dbService database.DatabaseInterface) {
+	revoked, err := dbService.IsTokenRevoked("id")
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+
+	expiresAt := time.Now().Add(time.Hour)
+	assert.Nil(t, dbService.RevokeToken("id", expiresAt))
+	err = dbService.RevokeToken("id", expiresAt)
+	assert.True(t, errors.Is(err, database.ErrTokenRevoked), "got %v", err)
+	revoked, err = dbService.IsTokenRevoked("id")
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+}
+
+func testAuthorizationCode(t *testing.T, dbService database.DatabaseInterface) {
+	_, err := dbService.GetAuthorizationCode("id")
+	assert.True(t, errors.Is(err, database.ErrAuthorizationCodeNotFound), "got %v", err)
+	err = dbService.UseAuthorizationCode("id")
+	assert.True(t, errors.Is(err, database.ErrAuthorizationCodeNotFound), "got %v", err)
+
+	code := entity.AuthorizationCode{
+		ID:            "id",
+		FamilyID:      "family",
+		ClientID:      "client",
+		Email:         "test@test.com",
+		RedirectURI:   "https://client.test/callback",
+		Scope:         "openid email",
+		Nonce:         "nonce",
+		CodeChallenge: "challenge",
+		ExpiresAt:     time.Now().Add(time.Minute).Truncate(time.Millisecond),
+	}
+	assert.Nil(t, dbService.CreateAuthorizationCode(code))
+	err = dbService.CreateAuthorizationCode(code)
+	assert.True(t, errors.Is(err, database.ErrAuthorizationCodeExists), "got %v", err)
+	storedCode, err := dbService.GetAuthorizationCode("id")
+	assert.Nil(t, err)
+	assert.Equal(t, code.FamilyID, storedCode.FamilyID)
+	assert.Equal(t, code.ClientID, storedCode.ClientID)
+	assert.Equal(t, code.Email, storedCode.Email)
+	assert.Equal(t, code.RedirectURI, storedCode.RedirectURI)
+	assert.Equal(t, code.Scope, storedCode.Scope)
+	assert.Equal(t, code.Nonce, storedCode.Nonce)
+	assert.Equal(t, code.CodeChallenge, storedCode.CodeChallenge)
+	assert.True(t, code.ExpiresAt.Equal(storedCode.ExpiresAt), "expires at is changed")
+	assert.False(t, storedCode.Used)
+
+	assert.Nil(t, dbService.UseAuthorizationCode("id"))
+	err = dbService.UseAuthorizationCode("id")
+	assert.True(t, errors.Is(err, database.ErrAuthorizationCodeAlreadyUsed), "got %v", err)
+	storedCode, err = dbService.GetAuthorizationCode("id")
+	assert.Nil(t, err)
+	assert.True(t, storedCode.Used)
+}
+
+func testSaveClient(t *testing.T, dbService database.DatabaseInterface) {
+	_, err := dbService.GetClient("client")
+	assert.True(t, errors.Is(err, database.ErrClientNotFound), "got %v", err)
+
+	client := entity.Client{
+		ID:           "client",
+		Name:         "Client",
+		SecretHash:   "secretHash",
+		RedirectURIs: []string{"https://client.test/callback"},
+		Scopes:       []string{"jobs:read", "jobs:write"},
+	}
+	assert.Nil(t, dbService.SaveClient(client))
+	storedClient, err := dbService.GetClient("client")
+	assert.Nil(t, err)
+	assert.Equal(t, client.Name, storedClient.Name)
+	assert.Equal(t, client.SecretHash, storedClient.SecretHash)
+	assert.Equal(t, client.RedirectURIs, storedClient.RedirectURIs)
+	assert.Equal(t, client.Scopes, storedClient.Scopes)
+	assert.False(t, storedClient.CreatedAt.IsZero(), "created at isn't set")
+
+	client.Name = "Renamed"
+	client.Scopes = []string{"jobs:read"}
+	assert.Nil(t, dbService.SaveClient(client))
+	renamedClient, err := dbService.GetClient("client")
+	assert.Nil(t, err)
+	assert.Equal(t, "Renamed", renamedClient.Name)
+	assert.Equal(t, []string{"jobs:read"}, renamedClient.Scopes)
+	assert.True(t, storedClient.CreatedAt.Equal(renamedClient.CreatedAt), "created at is changed")
+}
+
+func testDeviceCode(t *testing.T, dbService database.DatabaseInterface) {
+	_, err := dbService.GetDeviceCode("id")
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeNotFound), "got %v", err)
+	_, err = dbService.GetDeviceCodeByUserCode("USERCODE")
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeNotFound), "got %v", err)
+	err = dbService.UpdateDeviceCode(entity.DeviceCode{ID: "id"})
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeNotFound), "got %v", err)
+
+	code := entity.DeviceCode{
+		ID:        "id",
+		UserCode:  "USERCODE",
+		ClientID:  "client",
+		Scope:     "openid",
+		Status:    entity.DeviceCodePending,
+		Interval:  5 * time.Second,
+		ExpiresAt: time.Now().Add(time.Minute).Truncate(time.Millisecond),
+	}
+	assert.Nil(t, dbService.CreateDeviceCode(code))
+	duplicate := code
+	duplicate.ID = "other"
+	err = dbService.CreateDeviceCode(duplicate)
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeExists), "got %v", err)
+	storedCode, err := dbService.GetDeviceCodeByUserCode("USERCODE")
+	assert.Nil(t, err)
+	assert.Equal(t, "id", storedCode.ID)
+	assert.Equal(t, code.ClientID, storedCode.ClientID)
+	assert.Equal(t, code.Scope, storedCode.Scope)
+	assert.Equal(t, code.Interval, storedCode.Interval)
+	assert.True(t, code.ExpiresAt.Equal(storedCode.ExpiresAt), "expires at is changed")
+
+	err = dbService.PollDeviceCode("missing", time.Time{}, time.Now(), time.Second)
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeNotFound), "got %v", err)
+	// the device polls with the code it read before the user approved it
+	approvedCode := storedCode
+	approvedCode.Status = entity.DeviceCodeApproved
+	approvedCode.Email = "test@test.com"
+	assert.Nil(t, dbService.UpdateDeviceCode(approvedCode))
+	polledAt := time.Now().Truncate(time.Millisecond)
+	assert.Nil(t, dbService.PollDeviceCode("id", storedCode.LastPolledAt, polledAt, 10*time.Second))
+	err = dbService.PollDeviceCode("id", storedCode.LastPolledAt, time.Now(), 15*time.Second)
+	assert.True(t, errors.Is(err, database.ErrDeviceCodePolled), "got %v", err)
+	updatedCode, err := dbService.GetDeviceCode("id")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.DeviceCodeApproved, updatedCode.Status)
+	assert.Equal(t, "test@test.com", updatedCode.Email)
+	assert.Equal(t, 10*time.Second, updatedCode.Interval)
+	assert.True(t, polledAt.Equal(updatedCode.LastPolledAt), "last polled at isn't updated")
+	assert.Nil(t, dbService.PollDeviceCode("id", updatedCode.LastPolledAt, time.Now(), 10*time.Second))
+
+	assert.Nil(t, dbService.UseDeviceCode("id"))
+	err = dbService.UseDeviceCode("id")
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeAlreadyUsed), "got %v", err)
+	err = dbService.UseDeviceCode("missing")
+	assert.True(t, errors.Is(err, database.ErrDeviceCodeNotFound), "got %v", err)
+}
+
+func testWebAuthnCredential(t *testing.T, dbService database.DatabaseInterface) {
+	_, err := dbService.GetWebAuthnCredential("id")
+	assert.True(t, errors.Is(err, database.ErrWebAuthnCredentialNotFound), "got %v", err)
+	err = dbService.UpdateWebAuthnCredential(entity.WebAuthnCredential{ID: "id"})
+	assert.True(t, errors.Is(err, database.ErrWebAuthnCredentialNotFound), "got %v", err)
+	credentials, err := dbService.GetUserWebAuthnCredentials("test@test.com")
+	assert.Nil(t, err)
+	assert.Empty(t, credentials)
+
+	credential := entity.WebAuthnCredential{
+		ID:              "id",
+		Email:           "test@test.com",
+		PublicKey:       []byte{1, 2, 3},
+		AttestationType: "none",
+		BackupEligible:  true,
+		SignCount:       1,
+		Transports:      []string{"internal", "hybrid"},
+	}
+	assert.Nil(t, dbService.CreateWebAuthnCredential(credential))
+	err = dbService.CreateWebAuthnCredential(credential)
+	assert.True(t, errors.Is(err, database.ErrWebAuthnCredentialExists), "got %v", err)
+	time.Sleep(10 * time.Millisecond)
+	second := credential
+	second.ID = "second"
+	assert.Nil(t, dbService.CreateWebAuthnCredential(second))
+	other := credential
+	other.ID = "other"
+	other.Email = "other@test.com"
+	assert.Nil(t, dbService.CreateWebAuthnCredential(other))
+
+	storedCredential, err := dbService.GetWebAuthnCredential("id")
+	assert.Nil(t, err)
+	assert.Equal(t, credential.Email, storedCredential.Email)
+	assert.Equal(t, credential.PublicKey, storedCredential.PublicKey)
+	assert.Equal(t, credential.AttestationType, storedCredential.AttestationType)
+	assert.Equal(t, credential.BackupEligible, storedCredential.BackupEligible)
+	assert.Equal(t, credential.Transports, storedCredential.Transports)
+	assert.False(t, storedCredential.CreatedAt.IsZero(), "created at isn't set")
+	credentials, err = dbService.GetUserWebAuthnCredentials("test@test.com")
+	assert.Nil(t, err)
+	if assert.Len(t, credentials, 2) {
+		assert.Equal(t, "id", credentials[0].ID)
+		assert.Equal(t, "second", credentials[1].ID)
+	}
+
+	storedCredential.SignCount = 5
+	storedCredential.LastUsedAt = time.Now().Truncate(time.Millisecond)
+	assert.Nil(t, dbService.UpdateWebAuthnCredential(storedCredential))
+	updatedCredential, err := dbService.GetWebAuthnCredential("id")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), updatedCredential.SignCount)
+	assert.True(t, storedCredential.LastUsedAt.Equal(updatedCredential.LastUsedAt), "last used at isn't updated")
+}
+
+func testConcurrentCreateUser(t *testing.T, dbService database.DatabaseInterface) {
+	var created, exists int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dbService.CreateUser("test@test.com", "hashedPass", "tokenHash")
+			if err == nil {
+				atomic.AddInt32(&created, 1)
+			} else if errors.Is(err, database.ErrUserExists) {
+				atomic.AddInt32(&exists, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), created)
+	assert.Equal(t, int32(9), exists)
+}
+
+func testConcurrentUseSession(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateSession(newSession("id", "family", "test@test.com")))
+	var used, alreadyUsed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dbService.UseSession("id")
+			if err == nil {
+				atomic.AddInt32(&used, 1)
+			} else if errors.Is(err, database.ErrSessionAlreadyUsed) {
+				atomic.AddInt32(&alreadyUsed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), used)
+	assert.Equal(t, int32(9), alreadyUsed)
+}
+
+func testConcurrentRevokeToken(t *testing.T, dbService database.DatabaseInterface) {
+	expiresAt := time.Now().Add(time.Hour)
+	var revoked, alreadyRevoked int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dbService.RevokeToken("id", expiresAt)
+			if err == nil {
+				atomic.AddInt32(&revoked, 1)
+			} else if errors.Is(err, database.ErrTokenRevoked) {
+				atomic.AddInt32(&alreadyRevoked, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), revoked)
+	assert.Equal(t, int32(9), alreadyRevoked)
+}
+
+func testConcurrentCountMFAAttempt(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	now := time.Now()
+	var counted, locked int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dbService.CountMFAAttempt("test@test.com", 5, now, now.Add(time.Minute))
+			if err == nil {
+				atomic.AddInt32(&counted, 1)
+			} else if errors.Is(err, database.ErrMFALocked) {
+				atomic.AddInt32(&locked, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), counted)
+	assert.Equal(t, int32(5), locked)
+}
+
+func testConcurrentUseTOTPCounter(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	var used, alreadyUsed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dbService.UseTOTPCounter("test@test.com", 1)
+			if err == nil {
+				atomic.AddInt32(&used, 1)
+			} else if errors.Is(err, database.ErrTOTPCounterUsed) {
+				atomic.AddInt32(&alreadyUsed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), used)
+	assert.Equal(t, int32(9), alreadyUsed)
+}
+
+func testConcurrentUseRecoveryCode(t *testing.T, dbService database.DatabaseInterface) {
+	assert.Nil(t, dbService.CreateUser("test@test.com", "hashedPass", "tokenHash"))
+	user, err := dbService.GetUser("test@test.com")
+	assert.Nil(t, err)
+	user.RecoveryCodes = []string{"first", "second"}
+	assert.Nil(t, dbService.UpdateUser(user))
+	var used, notFound int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dbService.UseRecoveryCode("test@test.com", "first")
+			if err == nil {
+				atomic.AddInt32(&used, 1)
+			} else if errors.Is(err, database.ErrRecoveryCodeNotFound) {
+				atomic.AddInt32(&notFound, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), used)
+	assert.Equal(t, int32(9), notFound)
+}
@@ -1,8 +1,93 @@
 package database
 
-import "github.com/Hamifthi/authentication_microservice/entity"
+import (
+	"errors"
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"time"
+)
+
+// The errors every backend returns, so callers can check them with errors.Is
+var (
+	ErrUserNotFound       = errors.New("User not found")
+	ErrUserExists         = errors.New("User already exists")
+	ErrSessionNotFound    = errors.New("Session not found")
+	ErrSessionExists      = errors.New("Session already exists")
+	ErrSessionAlreadyUsed = errors.New("Session is already used")
+	ErrTokenRevoked       = errors.New("Token is already revoked")
+
+	ErrMFALocked            = errors.New("MFA codes are locked")
+	ErrTOTPCounterUsed      = errors.New("TOTP code is already used")
+	ErrRecoveryCodeNotFound = errors.New("Recovery code not found")
+
+	ErrAuthorizationCodeNotFound    = errors.New("Authorization code not found")
+	ErrAuthorizationCodeExists      = errors.New("Authorization code already exists")
+	ErrAuthorizationCodeAlreadyUsed = errors.New("Authorization code is already used")
+
+	ErrClientNotFound = errors.New("Client not found")
+
+	ErrDeviceCodeNotFound    = errors.New("Device code not found")
+	ErrDeviceCodeExists      = errors.New("Device code already exists")
+	ErrDeviceCodeAlreadyUsed = errors.New("Device code is already used")
+	ErrDeviceCodePolled      = errors.New("Device code is polled concurrently")
+
+	ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("WebAuthn credential already exists")
+)
+
+// ClientInterface stores the registered OAuth clients
+type ClientInterface interface {
+	// SaveClient creates the client or replaces the client which has the same id
+	SaveClient(client entity.Client) error
+	GetClient(id string) (entity.Client, error)
+}
 
 type DatabaseInterface interface {
+	ClientInterface
 	GetUser(email string) (entity.User, error)
 	CreateUser(email, hashedPass, tokenHash string) error
+	// UpdateUser persists the changes of the user which is identified by its email
+	UpdateUser(user entity.User) error
+	// CountMFAAttempt atomically counts an MFA code attempt of the user, the counting restarts once
+	// a lockout is over. The attempt which reaches maxAttempts locks the codes until lockedUntil,
+	// and while they are locked it returns ErrMFALocked.
+	CountMFAAttempt(email string, maxAttempts int, now, lockedUntil time.Time) error
+	// UseTOTPCounter sets the last used TOTP counter of the user only if it's lower than counter,
+	// otherwise it returns ErrTOTPCounterUsed. The MFA attempts and lockout are reset as well.
+	UseTOTPCounter(email string, counter int64) error
+	// UseRecoveryCode removes the recovery code hash of the user only if it's still present,
+	// otherwise it returns ErrRecoveryCodeNotFound. The MFA attempts and lockout are reset as well.
+	UseRecoveryCode(email, hash string) error
+	CreateSession(session entity.Session) error
+	GetSession(id string) (entity.Session, error)
+	GetUserSessions(email string) ([]entity.Session, error)
+	// UseSession atomically marks the session as used and returns ErrSessionAlreadyUsed
+	// if it has been used before
+	UseSession(id string) error
+	RevokeSessionFamily(familyID string) error
+	// RevokeToken adds the token id to the revocation list and returns ErrTokenRevoked if it's
+	// already there, so revoking a single use token is the atomic claim of it
+	RevokeToken(id string, expiresAt time.Time) error
+	IsTokenRevoked(id string) (bool, error)
+	CreateAuthorizationCode(code entity.AuthorizationCode) error
+	GetAuthorizationCode(id string) (entity.AuthorizationCode, error)
+	// UseAuthorizationCode atomically marks the code as used and returns
+	// ErrAuthorizationCodeAlreadyUsed if it has been used before
+	UseAuthorizationCode(id string) error
+	CreateDeviceCode(code entity.DeviceCode) error
+	GetDeviceCode(id string) (entity.DeviceCode, error)
+	GetDeviceCodeByUserCode(userCode string) (entity.DeviceCode, error)
+	// UpdateDeviceCode persists the status and user of the device code
+	UpdateDeviceCode(code entity.DeviceCode) error
+	// PollDeviceCode sets the polling time and interval of the device code only if its polling time
+	// is still lastPolledAt, otherwise it returns ErrDeviceCodePolled
+	PollDeviceCode(id string, lastPolledAt, polledAt time.Time, interval time.Duration) error
+	// UseDeviceCode atomically marks the device code as used and returns ErrDeviceCodeAlreadyUsed
+	// if it has been used before
+	UseDeviceCode(id string) error
+	CreateWebAuthnCredential(credential entity.WebAuthnCredential) error
+	GetWebAuthnCredential(id string) (entity.WebAuthnCredential, error)
+	// GetUserWebAuthnCredentials returns the credentials of the user in the order they are created
+	GetUserWebAuthnCredentials(email string) ([]entity.WebAuthnCredential, error)
+	// UpdateWebAuthnCredential persists the sign count and the last use of the credential
+	UpdateWebAuthnCredential(credential entity.WebAuthnCredential) error
 }
@@ -0,0 +1,423 @@
+package database
+
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryService keeps everything in memory, it's meant for the tests and local development
+type MemoryService struct {
+	mu            sync.RWMutex
+	users         map[string]entity.User
+	sessions      map[string]entity.Session
+	revokedTokens map[string]entity.RevokedToken
+	codes         map[string]entity.AuthorizationCode
+	clients       map[string]entity.Client
+	deviceCodes   map[string]entity.DeviceCode
+	credentials   map[string]entity.WebAuthnCredential
+	logger        *log.Logger
+}
+
+func NewMemorySrv(logger *log.Logger) *MemoryService {
+	return &MemoryService{
+		users:         map[string]entity.User{},
+		sessions:      map[string]entity.Session{},
+		revokedTokens: map[string]entity.RevokedToken{},
+		codes:         map[string]entity.AuthorizationCode{},
+		clients:       map[string]entity.Client{},
+		deviceCodes:   map[string]entity.DeviceCode{},
+		credentials:   map[string]entity.WebAuthnCredential{},
+		logger:        logger,
+	}
+}
+
+func (d *MemoryService) GetUser(email string) (entity.User, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	user, ok := d.users[email]
+	if !ok {
+		d.logger.Println("[Error] occurred while fetching the user from memory")
+		return user, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (d *MemoryService) CreateUser(email, hashPass, tokenHash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.users[email]; ok {
+		d.logger.Println("[Error] creating the user in memory")
+		return ErrUserExists
+	}
+	now := time.Now()
+	d.users[email] = entity.User{
+		ID:             newID(),
+		Email:          email,
+		HashedPassword: hashPass,
+		TokenHash:      tokenHash,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	return nil
+}
+
+func (d *MemoryService) UpdateUser(user entity.User) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	storedUser, ok := d.users[user.Email]
+	if !ok {
+		d.logger.Println("[Error] updating the user in memory")
+		return ErrUserNotFound
+	}
+	user.ID = storedUser.ID
+	user.Password = ""
+	user.CreatedAt = storedUser.CreatedAt
+	user.UpdatedAt = time.Now()
+	d.users[user.Email] = user
+	return nil
+}
+
+func (d *MemoryService) CountMFAAttempt(email string, maxAttempts int, now, lockedUntil time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	user, ok := d.users[email]
+	if !ok {
+		d.logger.Println("[Error] counting the MFA attempt in memory")
+		return ErrUserNotFound
+	}
+	if now.Before(user.MFALockedUntil) {
+		return ErrMFALocked
+	}
+	if user.MFAFailedAttempts >= maxAttempts {
+		user.MFAFailedAttempts = 0
+	}
+	user.MFAFailedAttempts++
+	if user.MFAFailedAttempts >= maxAttempts {
+		user.MFALockedUntil = lockedUntil
+	}
+	d.users[email] = user
+	return nil
+}
+
+func (d *MemoryService) UseTOTPCounter(email string, counter int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	user, ok := d.users[email]
+	if !ok {
+		d.logger.Println("[Error] using the TOTP counter in memory")
+		return ErrUserNotFound
+	}
+	if user.TOTPLastCounter >= counter {
+		return ErrTOTPCounterUsed
+	}
+	user.TOTPLastCounter = counter
+	user.MFAFailedAttempts = 0
+	user.MFALockedUntil = time.Time{}
+	user.UpdatedAt = time.Now()
+	d.users[email] = user
+	return nil
+}
+
+func (d *MemoryService) UseRecoveryCode(email, hash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	user, ok := d.users[email]
+	if !ok {
+		d.logger.Println("[Error] using the recovery code in memory")
+		return ErrUserNotFound
+	}
+	for i, recoveryCode := range user.RecoveryCodes {
+		if recoveryCode == hash {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+			user.MFAFailedAttempts = 0
+			user.MFALockedUntil = time.Time{}
+			user.UpdatedAt = time.Now()
+			d.users[email] = user
+			return nil
+		}
+	}
+	return ErrRecoveryCodeNotFound
+}
+
+func (d *MemoryService) CreateSession(session entity.Session) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.sessions[session.ID]; ok {
+		d.logger.Println("[Error] creating the session in memory")
+		return ErrSessionExists
+	}
+	session.CreatedAt = time.Now()
+	d.sessions[session.ID] = session
+	return nil
+}
+
+func (d *MemoryService) GetSession(id string) (entity.Session, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	session, ok := d.sessions[id]
+	if !ok {
+		d.logger.Println("[Error] occurred while fetching the session from memory")
+		return session, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (d *MemoryService) GetUserSessions(email string) ([]entity.Session, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var sessions []entity.Session
+	for _, session := range d.sessions {
+		if session.Email == email {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (d *MemoryService) UseSession(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session, ok := d.sessions[id]
+	if !ok {
+		d.logger.Println("[Error] marking the session as used in memory")
+		return ErrSessionNotFound
+	}
+	if session.Used {
+		return ErrSessionAlreadyUsed
+	}
+	session.Used = true
+	d.sessions[id] = session
+	return nil
+}
+
+func (d *MemoryService) RevokeSessionFamily(familyID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, session := range d.sessions {
+		if session.FamilyID == familyID {
+			session.Revoked = true
+			d.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (d *MemoryService) RevokeToken(id string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.revokedTokens[id]; ok {
+		return ErrTokenRevoked
+	}
+	d.revokedTokens[id] = entity.RevokedToken{ID: id, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	return nil
+}
+
+func (d *MemoryService) IsTokenRevoked(id string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.revokedTokens[id]
+	return ok, nil
+}
+
+func (d *MemoryService) CreateAuthorizationCode(code entity.AuthorizationCode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.codes[code.ID]; ok {
+		d.logger.Println("[Error] creating the authorization code in memory")
+		return ErrAuthorizationCodeExists
+	}
+	code.CreatedAt = time.Now()
+	d.codes[code.ID] = code
+	return nil
+}
+
+func (d *MemoryService) GetAuthorizationCode(id string) (entity.AuthorizationCode, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	code, ok := d.codes[id]
+	if !ok {
+		d.logger.Println("[Error] occurred while fetching the authorization code from memory")
+		return code, ErrAuthorizationCodeNotFound
+	}
+	return code, nil
+}
+
+func (d *MemoryService) UseAuthorizationCode(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	code, ok := d.codes[id]
+	if !ok {
+		d.logger.Println("[Error] marking the authorization code as used in memory")
+		return ErrAuthorizationCodeNotFound
+	}
+	if code.Used {
+		return ErrAuthorizationCodeAlreadyUsed
+	}
+	code.Used = true
+	d.codes[id] = code
+	return nil
+}
+
+func (d *MemoryService) SaveClient(client entity.Client) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	client.CreatedAt = time.Now()
+	if existing, ok := d.clients[client.ID]; ok {
+		client.CreatedAt = existing.CreatedAt
+	}
+	d.clients[client.ID] = client
+	return nil
+}
+
+func (d *MemoryService) GetClient(id string) (entity.Client, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	client, ok := d.clients[id]
+	if !ok {
+		d.logger.Println("[Error] occurred while fetching the client from memory")
+		return client, ErrClientNotFound
+	}
+	return client, nil
+}
+
+func (d *MemoryService) CreateDeviceCode(code entity.DeviceCode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, deviceCode := range d.deviceCodes {
+		if deviceCode.ID == code.ID || deviceCode.UserCode == code.UserCode {
+			d.logger.Println("[Error] creating the device code in memory")
+			return ErrDeviceCodeExists
+		}
+	}
+	code.CreatedAt = time.Now()
+	d.deviceCodes[code.ID] = code
+	return nil
+}
+
+func (d *MemoryService) GetDeviceCode(id string) (entity.DeviceCode, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	code, ok := d.deviceCodes[id]
+	if !ok {
+		d.logger.Println("[Error] occurred while fetching the device code from memory")
+		return code, ErrDeviceCodeNotFound
+	}
+	return code, nil
+}
+
+func (d *MemoryService) GetDeviceCodeByUserCode(userCode string) (entity.DeviceCode, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, code := range d.deviceCodes {
+		if code.UserCode == userCode {
+			return code, nil
+		}
+	}
+	d.logger.Println("[Error] occurred while fetching the device code from memory")
+	return entity.DeviceCode{}, ErrDeviceCodeNotFound
+}
+
+func (d *MemoryService) UpdateDeviceCode(code entity.DeviceCode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	storedCode, ok := d.deviceCodes[code.ID]
+	if !ok {
+		d.logger.Println("[Error] updating the device code in memory")
+		return ErrDeviceCodeNotFound
+	}
+	storedCode.Status = code.Status
+	storedCode.Email = code.Email
+	d.deviceCodes[code.ID] = storedCode
+	return nil
+}
+
+func (d *MemoryService) PollDeviceCode(id string, lastPolledAt, polledAt time.Time, interval time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	storedCode, ok := d.deviceCodes[id]
+	if !ok {
+		d.logger.Println("[Error] polling the device code in memory")
+		return ErrDeviceCodeNotFound
+	}
+	if !storedCode.LastPolledAt.Equal(lastPolledAt) {
+		return ErrDeviceCodePolled
+	}
+	storedCode.LastPolledAt = polledAt
+	storedCode.Interval = interval
+	d.deviceCodes[id] = storedCode
+	return nil
+}
+
+func (d *MemoryService) UseDeviceCode(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	code, ok := d.deviceCodes[id]
+	if !ok {
+		d.logger.Println("[Error] marking the device code as used in memory")
+		return ErrDeviceCodeNotFound
+	}
+	if code.Used {
+		return ErrDeviceCodeAlreadyUsed
+	}
+	code.Used = true
+	d.deviceCodes[id] = code
+	return nil
+}
+
+func (d *MemoryService) CreateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.credentials[credential.ID]; ok {
+		d.logger.Println("[Error] creating the WebAuthn credential in memory")
+		return ErrWebAuthnCredentialExists
+	}
+	credential.CreatedAt = time.Now()
+	d.credentials[credential.ID] = credential
+	return nil
+}
+
+func (d *MemoryService) GetWebAuthnCredential(id string) (entity.WebAuthnCredential, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	credential, ok := d.credentials[id]
+	if !ok {
+		d.logger.Println("[Error] occurred while fetching the WebAuthn credential from memory")
+		return credential, ErrWebAuthnCredentialNotFound
+	}
+	return credential, nil
+}
+
+func (d *MemoryService) GetUserWebAuthnCredentials(email string) ([]entity.WebAuthnCredential, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var credentials []entity.WebAuthnCredential
+	for _, credential := range d.credentials {
+		if credential.Email == email {
+			credentials = append(credentials, credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (d *MemoryService) UpdateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	storedCredential, ok := d.credentials[credential.ID]
+	if !ok {
+		d.logger.Println("[Error] updating the WebAuthn credential in memory")
+		return ErrWebAuthnCredentialNotFound
+	}
+	storedCredential.SignCount = credential.SignCount
+	storedCredential.LastUsedAt = credential.LastUsedAt
+	d.credentials[credential.ID] = storedCredential
+	return nil
+}
@@ -9,25 +9,95 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"time"
+)
+
+const (
+	sessionsCollection           = "sessions"
+	revokedTokensCollection      = "revokedTokens"
+	authorizationCodesCollection = "authorizationCodes"
+	clientsCollection            = "clients"
+	deviceCodesCollection        = "deviceCodes"
+	credentialsCollection        = "webAuthnCredentials"
 )
 
 type MongoDBService struct {
-	collection *mongo.Collection
-	ctx        context.Context
-	logger     *log.Logger
+	collection         *mongo.Collection
+	sessions           *mongo.Collection
+	revokedTokens      *mongo.Collection
+	authorizationCodes *mongo.Collection
+	clients            *mongo.Collection
+	deviceCodes        *mongo.Collection
+	credentials        *mongo.Collection
+	ctx                context.Context
+	logger             *log.Logger
 }
 
+// NewMongoSrv creates the mongodb service, collection is used for the users and the other
+// collections are created in the same database
 func NewMongoSrv(collection *mongo.Collection, ctx context.Context, logger *log.Logger) *MongoDBService {
-	return &MongoDBService{collection: collection, ctx: ctx, logger: logger}
+	sessions := collection.Database().Collection(sessionsCollection)
+	revokedTokens := collection.Database().Collection(revokedTokensCollection)
+	authorizationCodes := collection.Database().Collection(authorizationCodesCollection)
+	clients := collection.Database().Collection(clientsCollection)
+	deviceCodes := collection.Database().Collection(deviceCodesCollection)
+	credentials := collection.Database().Collection(credentialsCollection)
+	return &MongoDBService{
+		collection:         collection,
+		sessions:           sessions,
+		revokedTokens:      revokedTokens,
+		authorizationCodes: authorizationCodes,
+		clients:            clients,
+		deviceCodes:        deviceCodes,
+		credentials:        credentials,
+		ctx:                ctx,
+		logger:             logger,
+	}
+}
+
+// CreateIndexes creates the indexes which the queries and the uniqueness of the emails rely on
+func (d *MongoDBService) CreateIndexes() error {
+	_, err := d.collection.Indexes().CreateOne(d.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating the users indexes in mongodb")
+		return errors.Wrap(err, "Error occurred while creating the users indexes in mongodb")
+	}
+	_, err = d.sessions.Indexes().CreateMany(d.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "familyId", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: 1}}},
+	})
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating the sessions indexes in mongodb")
+		return errors.Wrap(err, "Error occurred while creating the sessions indexes in mongodb")
+	}
+	_, err = d.deviceCodes.Indexes().CreateOne(d.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userCode", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating the device codes indexes in mongodb")
+		return errors.Wrap(err, "Error occurred while creating the device codes indexes in mongodb")
+	}
+	_, err = d.credentials.Indexes().CreateOne(d.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating the WebAuthn credentials indexes in mongodb")
+		return errors.Wrap(err, "Error occurred while creating the WebAuthn credentials indexes in mongodb")
+	}
+	return nil
 }
 
 func (d *MongoDBService) GetUser(email string) (entity.User, error) {
 	var user entity.User
-	err := d.collection.FindOne(d.ctx, bson.D{{"email", email}}).Decode(&user)
+	err := d.collection.FindOne(d.ctx, bson.D{{Key: "email", Value: email}}).Decode(&user)
 	if err != nil {
 		d.logger.Println("[Error] occurred while fetching the user from mongodb")
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return user, errors.New("User not found in mongodb")
+			return user, ErrUserNotFound
 		} else {
 			return user, fmt.Errorf("Error fetching user with %s email from mongodb", email)
 		}
@@ -36,11 +106,457 @@ func (d *MongoDBService) GetUser(email string) (entity.User, error) {
 }
 
 func (d *MongoDBService) CreateUser(email, hashPass, tokenHash string) error {
-	user := entity.User{Email: email, HashedPassword: hashPass, TokenHash: tokenHash}
+	now := time.Now()
+	user := entity.User{
+		ID:             newID(),
+		Email:          email,
+		HashedPassword: hashPass,
+		TokenHash:      tokenHash,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
 	_, err := d.collection.InsertOne(d.ctx, &user, options.InsertOne())
 	if err != nil {
 		d.logger.Println("[Error] occurred while creating user in mongodb")
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrUserExists
+		}
 		return errors.Wrap(err, "Error occurred while creating user in mongodb")
 	}
 	return nil
 }
+
+// UpdateUser sets the fields of the user except its id and creation time. The _id isn't replaced
+// as it's immutable, and the users which are created before the ids were strings have ObjectIDs.
+func (d *MongoDBService) UpdateUser(user entity.User) error {
+	user.UpdatedAt = time.Now()
+	document, err := bson.Marshal(&user)
+	if err != nil {
+		d.logger.Println("[Error] occurred while encoding user for mongodb")
+		return errors.Wrap(err, "Error occurred while encoding user for mongodb")
+	}
+	var fields bson.D
+	err = bson.Unmarshal(document, &fields)
+	if err != nil {
+		d.logger.Println("[Error] occurred while encoding user for mongodb")
+		return errors.Wrap(err, "Error occurred while encoding user for mongodb")
+	}
+	changed := bson.D{}
+	for _, field := range fields {
+		if field.Key != "_id" && field.Key != "createdat" {
+			changed = append(changed, field)
+		}
+	}
+	update := bson.D{{Key: "$set", Value: changed}}
+	result, err := d.collection.UpdateOne(d.ctx, bson.D{{Key: "email", Value: user.Email}}, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while updating user in mongodb")
+		return errors.Wrap(err, "Error occurred while updating user in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CountMFAAttempt counts the attempt with an update pipeline, so the lockout is set by the same
+// update which reaches maxAttempts
+func (d *MongoDBService) CountMFAAttempt(email string, maxAttempts int, now, lockedUntil time.Time) error {
+	filter := bson.D{
+		{Key: "email", Value: email},
+		{Key: "mfalockeduntil", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gt", Value: now}}}}},
+	}
+	attempts := bson.D{{Key: "$ifNull", Value: bson.A{"$mfafailedattempts", 0}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "mfafailedattempts", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gte", Value: bson.A{attempts, maxAttempts}}},
+			1,
+			bson.D{{Key: "$add", Value: bson.A{attempts, 1}}},
+		}}}}}}},
+		{{Key: "$set", Value: bson.D{{Key: "mfalockeduntil", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gte", Value: bson.A{"$mfafailedattempts", maxAttempts}}},
+			lockedUntil,
+			"$mfalockeduntil",
+		}}}}}}},
+	}
+	result, err := d.collection.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while counting the MFA attempt in mongodb")
+		return errors.Wrap(err, "Error occurred while counting the MFA attempt in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		_, err = d.GetUser(email)
+		if err != nil {
+			return err
+		}
+		return ErrMFALocked
+	}
+	return nil
+}
+
+func (d *MongoDBService) UseTOTPCounter(email string, counter int64) error {
+	filter := bson.D{
+		{Key: "email", Value: email},
+		{Key: "totplastcounter", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gte", Value: counter}}}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "totplastcounter", Value: counter},
+		{Key: "mfafailedattempts", Value: 0},
+		{Key: "mfalockeduntil", Value: time.Time{}},
+		{Key: "updatedat", Value: time.Now()},
+	}}}
+	result, err := d.collection.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while using the TOTP counter in mongodb")
+		return errors.Wrap(err, "Error occurred while using the TOTP counter in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		_, err = d.GetUser(email)
+		if err != nil {
+			return err
+		}
+		return ErrTOTPCounterUsed
+	}
+	return nil
+}
+
+func (d *MongoDBService) UseRecoveryCode(email, hash string) error {
+	filter := bson.D{{Key: "email", Value: email}, {Key: "recoverycodes", Value: hash}}
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "recoverycodes", Value: hash}}},
+		{Key: "$set", Value: bson.D{
+			{Key: "mfafailedattempts", Value: 0},
+			{Key: "mfalockeduntil", Value: time.Time{}},
+			{Key: "updatedat", Value: time.Now()},
+		}},
+	}
+	result, err := d.collection.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while using the recovery code in mongodb")
+		return errors.Wrap(err, "Error occurred while using the recovery code in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		_, err = d.GetUser(email)
+		if err != nil {
+			return err
+		}
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (d *MongoDBService) CreateSession(session entity.Session) error {
+	session.CreatedAt = time.Now()
+	_, err := d.sessions.InsertOne(d.ctx, &session, options.InsertOne())
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating session in mongodb")
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrSessionExists
+		}
+		return errors.Wrap(err, "Error occurred while creating session in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) GetSession(id string) (entity.Session, error) {
+	var session entity.Session
+	err := d.sessions.FindOne(d.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&session)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the session from mongodb")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return session, ErrSessionNotFound
+		} else {
+			return session, fmt.Errorf("Error fetching session with %s id from mongodb", id)
+		}
+	}
+	return session, nil
+}
+
+func (d *MongoDBService) GetUserSessions(email string) ([]entity.Session, error) {
+	var sessions []entity.Session
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := d.sessions.Find(d.ctx, bson.D{{Key: "email", Value: email}}, findOptions)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the sessions of the user from mongodb")
+		return nil, fmt.Errorf("Error fetching sessions of the user with %s email from mongodb", email)
+	}
+	if err = cursor.All(d.ctx, &sessions); err != nil {
+		d.logger.Println("[Error] occurred while decoding the sessions of the user from mongodb")
+		return nil, errors.Wrap(err, "Error decoding the sessions of the user from mongodb")
+	}
+	return sessions, nil
+}
+
+func (d *MongoDBService) UseSession(id string) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "used", Value: false}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: true}}}}
+	result, err := d.sessions.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while marking the session as used in mongodb")
+		return errors.Wrap(err, "Error occurred while marking the session as used in mongodb")
+	}
+	if result.ModifiedCount == 0 {
+		if _, err := d.GetSession(id); err != nil {
+			return err
+		}
+		return ErrSessionAlreadyUsed
+	}
+	return nil
+}
+
+func (d *MongoDBService) RevokeSessionFamily(familyID string) error {
+	filter := bson.D{{Key: "familyId", Value: familyID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: true}}}}
+	_, err := d.sessions.UpdateMany(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while revoking the session family in mongodb")
+		return errors.Wrap(err, "Error occurred while revoking the session family in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) RevokeToken(id string, expiresAt time.Time) error {
+	revokedToken := entity.RevokedToken{ID: id, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	_, err := d.revokedTokens.InsertOne(d.ctx, &revokedToken, options.InsertOne())
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrTokenRevoked
+		}
+		d.logger.Println("[Error] occurred while adding the token to the revocation list in mongodb")
+		return errors.Wrap(err, "Error occurred while adding the token to the revocation list in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) IsTokenRevoked(id string) (bool, error) {
+	count, err := d.revokedTokens.CountDocuments(d.ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		d.logger.Println("[Error] occurred while checking the revocation list in mongodb")
+		return false, errors.Wrap(err, "Error occurred while checking the revocation list in mongodb")
+	}
+	return count > 0, nil
+}
+
+func (d *MongoDBService) CreateAuthorizationCode(code entity.AuthorizationCode) error {
+	code.CreatedAt = time.Now()
+	_, err := d.authorizationCodes.InsertOne(d.ctx, &code, options.InsertOne())
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating authorization code in mongodb")
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAuthorizationCodeExists
+		}
+		return errors.Wrap(err, "Error occurred while creating authorization code in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) GetAuthorizationCode(id string) (entity.AuthorizationCode, error) {
+	var code entity.AuthorizationCode
+	err := d.authorizationCodes.FindOne(d.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&code)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the authorization code from mongodb")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return code, ErrAuthorizationCodeNotFound
+		} else {
+			return code, fmt.Errorf("Error fetching authorization code with %s id from mongodb", id)
+		}
+	}
+	return code, nil
+}
+
+func (d *MongoDBService) UseAuthorizationCode(id string) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "used", Value: false}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: true}}}}
+	result, err := d.authorizationCodes.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while marking the authorization code as used in mongodb")
+		return errors.Wrap(err, "Error occurred while marking the authorization code as used in mongodb")
+	}
+	if result.ModifiedCount == 0 {
+		if _, err := d.GetAuthorizationCode(id); err != nil {
+			return err
+		}
+		return ErrAuthorizationCodeAlreadyUsed
+	}
+	return nil
+}
+
+func (d *MongoDBService) SaveClient(client entity.Client) error {
+	filter := bson.D{{Key: "_id", Value: client.ID}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "name", Value: client.Name},
+			{Key: "secretHash", Value: client.SecretHash},
+			{Key: "redirectUris", Value: client.RedirectURIs},
+			{Key: "scopes", Value: client.Scopes},
+		}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "createdAt", Value: time.Now()}}},
+	}
+	_, err := d.clients.UpdateOne(d.ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		d.logger.Println("[Error] occurred while saving client in mongodb")
+		return errors.Wrap(err, "Error occurred while saving client in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) GetClient(id string) (entity.Client, error) {
+	var client entity.Client
+	err := d.clients.FindOne(d.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&client)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the client from mongodb")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return client, ErrClientNotFound
+		} else {
+			return client, fmt.Errorf("Error fetching client with %s id from mongodb", id)
+		}
+	}
+	return client, nil
+}
+
+func (d *MongoDBService) CreateDeviceCode(code entity.DeviceCode) error {
+	code.CreatedAt = time.Now()
+	_, err := d.deviceCodes.InsertOne(d.ctx, &code, options.InsertOne())
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating device code in mongodb")
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDeviceCodeExists
+		}
+		return errors.Wrap(err, "Error occurred while creating device code in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) GetDeviceCode(id string) (entity.DeviceCode, error) {
+	return d.getDeviceCode(bson.D{{Key: "_id", Value: id}})
+}
+
+func (d *MongoDBService) GetDeviceCodeByUserCode(userCode string) (entity.DeviceCode, error) {
+	return d.getDeviceCode(bson.D{{Key: "userCode", Value: userCode}})
+}
+
+func (d *MongoDBService) getDeviceCode(filter bson.D) (entity.DeviceCode, error) {
+	var code entity.DeviceCode
+	err := d.deviceCodes.FindOne(d.ctx, filter).Decode(&code)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the device code from mongodb")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return code, ErrDeviceCodeNotFound
+		} else {
+			return code, fmt.Errorf("Error fetching device code from mongodb")
+		}
+	}
+	return code, nil
+}
+
+func (d *MongoDBService) UpdateDeviceCode(code entity.DeviceCode) error {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: code.Status},
+		{Key: "email", Value: code.Email},
+	}}}
+	result, err := d.deviceCodes.UpdateOne(d.ctx, bson.D{{Key: "_id", Value: code.ID}}, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while updating the device code in mongodb")
+		return errors.Wrap(err, "Error occurred while updating the device code in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		return ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+func (d *MongoDBService) PollDeviceCode(id string, lastPolledAt, polledAt time.Time, interval time.Duration) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "lastPolledAt", Value: lastPolledAt}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "interval", Value: interval},
+		{Key: "lastPolledAt", Value: polledAt},
+	}}}
+	result, err := d.deviceCodes.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while polling the device code in mongodb")
+		return errors.Wrap(err, "Error occurred while polling the device code in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		_, err = d.GetDeviceCode(id)
+		if err != nil {
+			return err
+		}
+		return ErrDeviceCodePolled
+	}
+	return nil
+}
+
+func (d *MongoDBService) UseDeviceCode(id string) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "used", Value: false}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: true}}}}
+	result, err := d.deviceCodes.UpdateOne(d.ctx, filter, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while marking the device code as used in mongodb")
+		return errors.Wrap(err, "Error occurred while marking the device code as used in mongodb")
+	}
+	if result.ModifiedCount == 0 {
+		if _, err := d.GetDeviceCode(id); err != nil {
+			return err
+		}
+		return ErrDeviceCodeAlreadyUsed
+	}
+	return nil
+}
+
+func (d *MongoDBService) CreateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	credential.CreatedAt = time.Now()
+	_, err := d.credentials.InsertOne(d.ctx, &credential, options.InsertOne())
+	if err != nil {
+		d.logger.Println("[Error] occurred while creating WebAuthn credential in mongodb")
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrWebAuthnCredentialExists
+		}
+		return errors.Wrap(err, "Error occurred while creating WebAuthn credential in mongodb")
+	}
+	return nil
+}
+
+func (d *MongoDBService) GetWebAuthnCredential(id string) (entity.WebAuthnCredential, error) {
+	var credential entity.WebAuthnCredential
+	err := d.credentials.FindOne(d.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&credential)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the WebAuthn credential from mongodb")
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return credential, ErrWebAuthnCredentialNotFound
+		} else {
+			return credential, fmt.Errorf("Error fetching WebAuthn credential from mongodb")
+		}
+	}
+	return credential, nil
+}
+
+func (d *MongoDBService) GetUserWebAuthnCredentials(email string) ([]entity.WebAuthnCredential, error) {
+	var credentials []entity.WebAuthnCredential
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := d.credentials.Find(d.ctx, bson.D{{Key: "email", Value: email}}, findOptions)
+	if err != nil {
+		d.logger.Println("[Error] occurred while fetching the WebAuthn credentials of the user from mongodb")
+		return nil, fmt.Errorf("Error fetching WebAuthn credentials of the user with %s email from mongodb", email)
+	}
+	if err = cursor.All(d.ctx, &credentials); err != nil {
+		d.logger.Println("[Error] occurred while decoding the WebAuthn credentials of the user from mongodb")
+		return nil, errors.Wrap(err, "Error decoding the WebAuthn credentials of the user from mongodb")
+	}
+	return credentials, nil
+}
+
+func (d *MongoDBService) UpdateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "signCount", Value: credential.SignCount},
+		{Key: "lastUsedAt", Value: credential.LastUsedAt},
+	}}}
+	result, err := d.credentials.UpdateOne(d.ctx, bson.D{{Key: "_id", Value: credential.ID}}, update)
+	if err != nil {
+		d.logger.Println("[Error] occurred while updating the WebAuthn credential in mongodb")
+		return errors.Wrap(err, "Error occurred while updating the WebAuthn credential in mongodb")
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
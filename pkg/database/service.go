@@ -4,10 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Hamifthi/authentication_microservice/entity"
+	"github.com/jackc/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
+	"time"
 )
 
+// uniqueViolation is the postgres error code of a duplicate key
+const uniqueViolation = "23505"
+
 type DatabaseService struct {
 	db     *gorm.DB
 	logger *log.Logger
@@ -17,13 +23,18 @@ func New(db *gorm.DB, logger *log.Logger) *DatabaseService {
 	return &DatabaseService{db, logger}
 }
 
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
 func (d *DatabaseService) GetUser(email string) (entity.User, error) {
 	var user entity.User
 	result := d.db.First(&user, "email = ?", email)
 	if result.Error != nil {
 		d.logger.Println("[Error] occurred while fetching the user")
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return user, errors.New("User not found")
+			return user, ErrUserNotFound
 		} else {
 			return user, fmt.Errorf("Error fetching user with %s email from database", email)
 		}
@@ -32,11 +43,376 @@ func (d *DatabaseService) GetUser(email string) (entity.User, error) {
 }
 
 func (d *DatabaseService) CreateUser(email, hashPass, tokenHash string) error {
-	user := entity.User{Email: email, HashedPassword: hashPass, TokenHash: tokenHash}
+	user := entity.User{ID: newID(), Email: email, HashedPassword: hashPass, TokenHash: tokenHash}
 	result := d.db.Create(&user)
-	if result.Error != nil && result.RowsAffected != 1 {
+	if result.Error != nil {
 		d.logger.Println("[Error] creating the user in the database")
+		if isUniqueViolation(result.Error) {
+			return ErrUserExists
+		}
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) UpdateUser(user entity.User) error {
+	result := d.db.Model(&entity.User{}).Where("email = ?", user.Email).
+		Select("*").Omit("id", "email", "created_at").Updates(&user)
+	if result.Error != nil {
+		d.logger.Println("[Error] updating the user in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *DatabaseService) CountMFAAttempt(email string, maxAttempts int, now, lockedUntil time.Time) error {
+	attempts := gorm.Expr("CASE WHEN COALESCE(mfa_failed_attempts, 0) >= ? THEN 1 ELSE COALESCE(mfa_failed_attempts, 0) + 1 END", maxAttempts)
+	result := d.db.Model(&entity.User{}).
+		Where("email = ? AND (mfa_locked_until IS NULL OR mfa_locked_until <= ?)", email, now).
+		Updates(map[string]interface{}{
+			"mfa_failed_attempts": attempts,
+			"mfa_locked_until":    gorm.Expr("CASE WHEN ? >= ? THEN ? ELSE mfa_locked_until END", attempts, maxAttempts, lockedUntil),
+		})
+	if result.Error != nil {
+		d.logger.Println("[Error] counting the MFA attempt in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := d.GetUser(email); err != nil {
+			return err
+		}
+		return ErrMFALocked
+	}
+	return nil
+}
+
+func (d *DatabaseService) UseTOTPCounter(email string, counter int64) error {
+	result := d.db.Model(&entity.User{}).
+		Where("email = ? AND COALESCE(totp_last_counter, 0) < ?", email, counter).
+		Updates(map[string]interface{}{
+			"totp_last_counter":   counter,
+			"mfa_failed_attempts": 0,
+			"mfa_locked_until":    time.Time{},
+		})
+	if result.Error != nil {
+		d.logger.Println("[Error] using the TOTP counter in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := d.GetUser(email); err != nil {
+			return err
+		}
+		return ErrTOTPCounterUsed
+	}
+	return nil
+}
+
+// UseRecoveryCode removes the hash from the JSON array of the recovery codes in the same statement
+// which checks that it's still there
+func (d *DatabaseService) UseRecoveryCode(email, hash string) error {
+	result := d.db.Model(&entity.User{}).
+		Where("email = ? AND recovery_codes::jsonb @> jsonb_build_array(?::text)", email, hash).
+		Updates(map[string]interface{}{
+			"recovery_codes":      gorm.Expr("(recovery_codes::jsonb - ?::text)::text", hash),
+			"mfa_failed_attempts": 0,
+			"mfa_locked_until":    time.Time{},
+		})
+	if result.Error != nil {
+		d.logger.Println("[Error] using the recovery code in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := d.GetUser(email); err != nil {
+			return err
+		}
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (d *DatabaseService) CreateSession(session entity.Session) error {
+	result := d.db.Create(&session)
+	if result.Error != nil {
+		d.logger.Println("[Error] creating the session in the database")
+		if isUniqueViolation(result.Error) {
+			return ErrSessionExists
+		}
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) GetSession(id string) (entity.Session, error) {
+	var session entity.Session
+	result := d.db.First(&session, "id = ?", id)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the session")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return session, ErrSessionNotFound
+		} else {
+			return session, fmt.Errorf("Error fetching session with %s id from database", id)
+		}
+	}
+	return session, nil
+}
+
+func (d *DatabaseService) GetUserSessions(email string) ([]entity.Session, error) {
+	var sessions []entity.Session
+	result := d.db.Where("email = ?", email).Order("created_at").Find(&sessions)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the sessions of the user")
+		return nil, fmt.Errorf("Error fetching sessions of the user with %s email from database", email)
+	}
+	return sessions, nil
+}
+
+func (d *DatabaseService) UseSession(id string) error {
+	result := d.db.Model(&entity.Session{}).Where("id = ? AND used = ?", id, false).Update("used", true)
+	if result.Error != nil {
+		d.logger.Println("[Error] marking the session as used in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := d.GetSession(id); err != nil {
+			return err
+		}
+		return ErrSessionAlreadyUsed
+	}
+	return nil
+}
+
+func (d *DatabaseService) RevokeSessionFamily(familyID string) error {
+	result := d.db.Model(&entity.Session{}).Where("family_id = ?", familyID).Update("revoked", true)
+	if result.Error != nil {
+		d.logger.Println("[Error] revoking the session family in the database")
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) RevokeToken(id string, expiresAt time.Time) error {
+	revokedToken := entity.RevokedToken{ID: id, ExpiresAt: expiresAt}
+	result := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedToken)
+	if result.Error != nil {
+		d.logger.Println("[Error] adding the token to the revocation list")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (d *DatabaseService) IsTokenRevoked(id string) (bool, error) {
+	var count int64
+	result := d.db.Model(&entity.RevokedToken{}).Where("id = ?", id).Count(&count)
+	if result.Error != nil {
+		d.logger.Println("[Error] checking the revocation list")
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
+func (d *DatabaseService) CreateAuthorizationCode(code entity.AuthorizationCode) error {
+	result := d.db.Create(&code)
+	if result.Error != nil {
+		d.logger.Println("[Error] creating the authorization code in the database")
+		if isUniqueViolation(result.Error) {
+			return ErrAuthorizationCodeExists
+		}
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) GetAuthorizationCode(id string) (entity.AuthorizationCode, error) {
+	var code entity.AuthorizationCode
+	result := d.db.First(&code, "id = ?", id)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the authorization code")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return code, ErrAuthorizationCodeNotFound
+		} else {
+			return code, fmt.Errorf("Error fetching authorization code with %s id from database", id)
+		}
+	}
+	return code, nil
+}
+
+func (d *DatabaseService) UseAuthorizationCode(id string) error {
+	result := d.db.Model(&entity.AuthorizationCode{}).Where("id = ? AND used = ?", id, false).Update("used", true)
+	if result.Error != nil {
+		d.logger.Println("[Error] marking the authorization code as used in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := d.GetAuthorizationCode(id); err != nil {
+			return err
+		}
+		return ErrAuthorizationCodeAlreadyUsed
+	}
+	return nil
+}
+
+func (d *DatabaseService) SaveClient(client entity.Client) error {
+	result := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "secret_hash", "redirect_uris", "scopes"}),
+	}).Create(&client)
+	if result.Error != nil {
+		d.logger.Println("[Error] saving the client in the database")
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) GetClient(id string) (entity.Client, error) {
+	var client entity.Client
+	result := d.db.First(&client, "id = ?", id)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the client")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return client, ErrClientNotFound
+		} else {
+			return client, fmt.Errorf("Error fetching client with %s id from database", id)
+		}
+	}
+	return client, nil
+}
+
+func (d *DatabaseService) CreateDeviceCode(code entity.DeviceCode) error {
+	result := d.db.Create(&code)
+	if result.Error != nil {
+		d.logger.Println("[Error] creating the device code in the database")
+		if isUniqueViolation(result.Error) {
+			return ErrDeviceCodeExists
+		}
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) GetDeviceCode(id string) (entity.DeviceCode, error) {
+	return d.getDeviceCode("id = ?", id)
+}
+
+func (d *DatabaseService) GetDeviceCodeByUserCode(userCode string) (entity.DeviceCode, error) {
+	return d.getDeviceCode("user_code = ?", userCode)
+}
+
+func (d *DatabaseService) getDeviceCode(query, value string) (entity.DeviceCode, error) {
+	var code entity.DeviceCode
+	result := d.db.First(&code, query, value)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the device code")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return code, ErrDeviceCodeNotFound
+		} else {
+			return code, fmt.Errorf("Error fetching device code from database")
+		}
+	}
+	return code, nil
+}
+
+func (d *DatabaseService) UpdateDeviceCode(code entity.DeviceCode) error {
+	result := d.db.Model(&entity.DeviceCode{}).Where("id = ?", code.ID).Updates(map[string]interface{}{
+		"status": code.Status,
+		"email":  code.Email,
+	})
+	if result.Error != nil {
+		d.logger.Println("[Error] updating the device code in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+func (d *DatabaseService) PollDeviceCode(id string, lastPolledAt, polledAt time.Time, interval time.Duration) error {
+	result := d.db.Model(&entity.DeviceCode{}).Where("id = ? AND last_polled_at = ?", id, lastPolledAt).Updates(map[string]interface{}{
+		"interval":       interval,
+		"last_polled_at": polledAt,
+	})
+	if result.Error != nil {
+		d.logger.Println("[Error] polling the device code in the database")
 		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		_, err := d.GetDeviceCode(id)
+		if err != nil {
+			return err
+		}
+		return ErrDeviceCodePolled
+	}
+	return nil
+}
+
+func (d *DatabaseService) UseDeviceCode(id string) error {
+	result := d.db.Model(&entity.DeviceCode{}).Where("id = ? AND used = ?", id, false).Update("used", true)
+	if result.Error != nil {
+		d.logger.Println("[Error] marking the device code as used in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := d.GetDeviceCode(id); err != nil {
+			return err
+		}
+		return ErrDeviceCodeAlreadyUsed
+	}
+	return nil
+}
+
+func (d *DatabaseService) CreateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	result := d.db.Create(&credential)
+	if result.Error != nil {
+		d.logger.Println("[Error] creating the WebAuthn credential in the database")
+		if isUniqueViolation(result.Error) {
+			return ErrWebAuthnCredentialExists
+		}
+		return result.Error
+	}
+	return nil
+}
+
+func (d *DatabaseService) GetWebAuthnCredential(id string) (entity.WebAuthnCredential, error) {
+	var credential entity.WebAuthnCredential
+	result := d.db.First(&credential, "id = ?", id)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the WebAuthn credential")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return credential, ErrWebAuthnCredentialNotFound
+		} else {
+			return credential, fmt.Errorf("Error fetching WebAuthn credential from database")
+		}
+	}
+	return credential, nil
+}
+
+func (d *DatabaseService) GetUserWebAuthnCredentials(email string) ([]entity.WebAuthnCredential, error) {
+	var credentials []entity.WebAuthnCredential
+	result := d.db.Where("email = ?", email).Order("created_at").Find(&credentials)
+	if result.Error != nil {
+		d.logger.Println("[Error] occurred while fetching the WebAuthn credentials of the user")
+		return nil, fmt.Errorf("Error fetching WebAuthn credentials of the user with %s email from database", email)
+	}
+	return credentials, nil
+}
+
+func (d *DatabaseService) UpdateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	result := d.db.Model(&entity.WebAuthnCredential{}).Where("id = ?", credential.ID).Updates(map[string]interface{}{
+		"sign_count":   credential.SignCount,
+		"last_used_at": credential.LastUsedAt,
+	})
+	if result.Error != nil {
+		d.logger.Println("[Error] updating the WebAuthn credential in the database")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
 	return nil
 }
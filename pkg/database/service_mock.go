@@ -1,10 +1,41 @@
 package database
 
-import "github.com/Hamifthi/authentication_microservice/entity"
+import (
+	"github.com/Hamifthi/authentication_microservice/entity"
+	"time"
+)
 
 type DatabaseServiceMock struct {
-	MockedGetUser    func(email string) (entity.User, error)
-	MockedCreateUser func(email, hashPass, tokenHash string) error
+	MockedGetUser             func(email string) (entity.User, error)
+	MockedCreateUser          func(email, hashPass, tokenHash string) error
+	MockedUpdateUser          func(user entity.User) error
+	MockedCountMFAAttempt     func(email string, maxAttempts int, now, lockedUntil time.Time) error
+	MockedUseTOTPCounter      func(email string, counter int64) error
+	MockedUseRecoveryCode     func(email, hash string) error
+	MockedCreateSession       func(session entity.Session) error
+	MockedGetSession          func(id string) (entity.Session, error)
+	MockedGetUserSessions     func(email string) ([]entity.Session, error)
+	MockedUseSession          func(id string) error
+	MockedRevokeSessionFamily func(familyID string) error
+	MockedRevokeToken         func(id string, expiresAt time.Time) error
+	MockedIsTokenRevoked      func(id string) (bool, error)
+
+	MockedCreateAuthorizationCode func(code entity.AuthorizationCode) error
+	MockedGetAuthorizationCode    func(id string) (entity.AuthorizationCode, error)
+	MockedUseAuthorizationCode    func(id string) error
+	MockedSaveClient              func(client entity.Client) error
+	MockedGetClient               func(id string) (entity.Client, error)
+	MockedCreateDeviceCode        func(code entity.DeviceCode) error
+	MockedGetDeviceCode           func(id string) (entity.DeviceCode, error)
+	MockedGetDeviceCodeByUserCode func(userCode string) (entity.DeviceCode, error)
+	MockedUpdateDeviceCode        func(code entity.DeviceCode) error
+	MockedPollDeviceCode          func(id string, lastPolledAt, polledAt time.Time, interval time.Duration) error
+	MockedUseDeviceCode           func(id string) error
+
+	MockedCreateWebAuthnCredential   func(credential entity.WebAuthnCredential) error
+	MockedGetWebAuthnCredential      func(id string) (entity.WebAuthnCredential, error)
+	MockedGetUserWebAuthnCredentials func(email string) ([]entity.WebAuthnCredential, error)
+	MockedUpdateWebAuthnCredential   func(credential entity.WebAuthnCredential) error
 }
 
 func (dsm *DatabaseServiceMock) GetUser(email string) (entity.User, error) {
@@ -14,3 +45,107 @@ func (dsm *DatabaseServiceMock) GetUser(email string) (entity.User, error) {
 func (dsm *DatabaseServiceMock) CreateUser(email, hashPass, tokenHash string) error {
 	return dsm.MockedCreateUser(email, hashPass, tokenHash)
 }
+
+func (dsm *DatabaseServiceMock) UpdateUser(user entity.User) error {
+	return dsm.MockedUpdateUser(user)
+}
+
+func (dsm *DatabaseServiceMock) CountMFAAttempt(email string, maxAttempts int, now, lockedUntil time.Time) error {
+	return dsm.MockedCountMFAAttempt(email, maxAttempts, now, lockedUntil)
+}
+
+func (dsm *DatabaseServiceMock) UseTOTPCounter(email string, counter int64) error {
+	return dsm.MockedUseTOTPCounter(email, counter)
+}
+
+func (dsm *DatabaseServiceMock) UseRecoveryCode(email, hash string) error {
+	return dsm.MockedUseRecoveryCode(email, hash)
+}
+
+func (dsm *DatabaseServiceMock) CreateSession(session entity.Session) error {
+	return dsm.MockedCreateSession(session)
+}
+
+func (dsm *DatabaseServiceMock) GetSession(id string) (entity.Session, error) {
+	return dsm.MockedGetSession(id)
+}
+
+func (dsm *DatabaseServiceMock) GetUserSessions(email string) ([]entity.Session, error) {
+	return dsm.MockedGetUserSessions(email)
+}
+
+func (dsm *DatabaseServiceMock) UseSession(id string) error {
+	return dsm.MockedUseSession(id)
+}
+
+func (dsm *DatabaseServiceMock) RevokeSessionFamily(familyID string) error {
+	return dsm.MockedRevokeSessionFamily(familyID)
+}
+
+func (dsm *DatabaseServiceMock) RevokeToken(id string, expiresAt time.Time) error {
+	return dsm.MockedRevokeToken(id, expiresAt)
+}
+
+func (dsm *DatabaseServiceMock) IsTokenRevoked(id string) (bool, error) {
+	return dsm.MockedIsTokenRevoked(id)
+}
+
+func (dsm *DatabaseServiceMock) CreateAuthorizationCode(code entity.AuthorizationCode) error {
+	return dsm.MockedCreateAuthorizationCode(code)
+}
+
+func (dsm *DatabaseServiceMock) GetAuthorizationCode(id string) (entity.AuthorizationCode, error) {
+	return dsm.MockedGetAuthorizationCode(id)
+}
+
+func (dsm *DatabaseServiceMock) UseAuthorizationCode(id string) error {
+	return dsm.MockedUseAuthorizationCode(id)
+}
+
+func (dsm *DatabaseServiceMock) SaveClient(client entity.Client) error {
+	return dsm.MockedSaveClient(client)
+}
+
+func (dsm *DatabaseServiceMock) GetClient(id string) (entity.Client, error) {
+	return dsm.MockedGetClient(id)
+}
+
+func (dsm *DatabaseServiceMock) CreateDeviceCode(code entity.DeviceCode) error {
+	return dsm.MockedCreateDeviceCode(code)
+}
+
+func (dsm *DatabaseServiceMock) GetDeviceCode(id string) (entity.DeviceCode, error) {
+	return dsm.MockedGetDeviceCode(id)
+}
+
+func (dsm *DatabaseServiceMock) GetDeviceCodeByUserCode(userCode string) (entity.DeviceCode, error) {
+	return dsm.MockedGetDeviceCodeByUserCode(userCode)
+}
+
+func (dsm *DatabaseServiceMock) UpdateDeviceCode(code entity.DeviceCode) error {
+	return dsm.MockedUpdateDeviceCode(code)
+}
+
+func (dsm *DatabaseServiceMock) PollDeviceCode(id string, lastPolledAt, polledAt time.Time, interval time.Duration) error {
+	return dsm.MockedPollDeviceCode(id, lastPolledAt, polledAt, interval)
+}
+
+func (dsm *DatabaseServiceMock) UseDeviceCode(id string) error {
+	return dsm.MockedUseDeviceCode(id)
+}
+
+func (dsm *DatabaseServiceMock) CreateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	return dsm.MockedCreateWebAuthnCredential(credential)
+}
+
+func (dsm *DatabaseServiceMock) GetWebAuthnCredential(id string) (entity.WebAuthnCredential, error) {
+	return dsm.MockedGetWebAuthnCredential(id)
+}
+
+func (dsm *DatabaseServiceMock) GetUserWebAuthnCredentials(email string) ([]entity.WebAuthnCredential, error) {
+	return dsm.MockedGetUserWebAuthnCredentials(email)
+}
+
+func (dsm *DatabaseServiceMock) UpdateWebAuthnCredential(credential entity.WebAuthnCredential) error {
+	return dsm.MockedUpdateWebAuthnCredential(credential)
+}
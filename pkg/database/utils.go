@@ -0,0 +1,15 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newID generates the random id of the new records
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+// Package notification sends the messages of the authentication flows to the users. The messages
+// are rendered from the templates of the user's locale and delivered by a Notifier driver, the
+// Queue retries the failed deliveries in the background.
+package notification
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a rendered notification, HTML is optional
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Notifier delivers the messages to the users
+type Notifier interface {
+	Send(message Message) error
+}
+
+// NopNotifier drops the messages, so the links which carry the tokens never end up in the logs
+// when no driver is set
+type NopNotifier struct{}
+
+func (NopNotifier) Send(message Message) error {
+	return nil
+}
+
+// WriterNotifier writes the messages to a file or stdout instead of delivering them, it's the
+// sink of local development and tests
+type WriterNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterNotifier(w io.Writer) *WriterNotifier {
+	return &WriterNotifier{w: w}
+}
+
+// NewFileNotifier appends the messages to the file of the path
+func NewFileNotifier(path string) (*WriterNotifier, io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error opening the notification file")
+	}
+	return NewWriterNotifier(file), file, nil
+}
+
+func (n *WriterNotifier) Send(message Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err := fmt.Fprintf(n.w, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n", time.Now().Format(time.RFC1123Z),
+		message.To, message.Subject, message.Text)
+	if err != nil {
+		return errors.Wrap(err, "Error writing the notification")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package notification
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterNotifier(t *testing.T) {
+	buf := bytes.Buffer{}
+	notifier := NewWriterNotifier(&buf)
+	assert.Nil(t, notifier.Send(Message{To: "test@test.com", Subject: "Welcome", Text: "Hi\n", HTML: "<p>Hi</p>"}))
+	assert.Contains(t, buf.String(), "To: test@test.com\nSubject: Welcome\n\nHi\n")
+	assert.NotContains(t, buf.String(), "<p>")
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	notifier, closer, err := NewFileNotifier(path)
+	assert.Nil(t, err)
+	assert.Nil(t, notifier.Send(Message{To: "first@test.com", Subject: "First", Text: "1"}))
+	assert.Nil(t, notifier.Send(Message{To: "second@test.com", Subject: "Second", Text: "2"}))
+	assert.Nil(t, closer.Close())
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "To: first@test.com")
+	assert.Contains(t, string(content), "To: second@test.com")
+
+	_, _, err = NewFileNotifier(filepath.Join(t.TempDir(), "missing", "notifications.log"))
+	assert.NotNil(t, err)
+}
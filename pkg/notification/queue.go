@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+const (
+	defaultQueueSize   = 1000
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+)
+
+var ErrQueueFull = errors.New("The notification queue is full")
+
+type queuedMessage struct {
+	message  Message
+	attempts int
+}
+
+// Queue is a Notifier which hands the messages to another notifier in the background, so sending
+// never blocks the caller. A failed message is retried with an exponential backoff until it's
+// tried maxAttempts times.
+type Queue struct {
+	notifier    Notifier
+	logger      *log.Logger
+	messages    chan queuedMessage
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func NewQueue(notifier Notifier, logger *log.Logger) *Queue {
+	return &Queue{
+		notifier:    notifier,
+		logger:      logger,
+		messages:    make(chan queuedMessage, defaultQueueSize),
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+	}
+}
+
+// Send queues the message, ErrQueueFull is returned instead of waiting when the queue is full
+func (q *Queue) Send(message Message) error {
+	return q.enqueue(queuedMessage{message: message})
+}
+
+func (q *Queue) enqueue(message queuedMessage) error {
+	select {
+	case q.messages <- message:
+		return nil
+	default:
+		q.logger.Printf("[Error] the notification queue is full, dropping the message to %s", message.message.To)
+		return ErrQueueFull
+	}
+}
+
+// Run sends the queued messages until the context is done, then it tries the messages which
+// are still queued once more and returns. The messages waiting for a retry are dropped.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			q.drain(ctx)
+			return
+		case message := <-q.messages:
+			q.send(ctx, message)
+		}
+	}
+}
+
+// drain sends the queued messages without waiting for new ones
+func (q *Queue) drain(ctx context.Context) {
+	for {
+		select {
+		case message := <-q.messages:
+			q.send(ctx, message)
+		default:
+			return
+		}
+	}
+}
+
+func (q *Queue) send(ctx context.Context, message queuedMessage) {
+	err := q.notifier.Send(message.message)
+	if err == nil {
+		return
+	}
+	message.attempts++
+	if message.attempts >= q.maxAttempts || ctx.Err() != nil {
+		q.logger.Printf("[Error] sending the notification to %s failed %d times, dropping it. Err: %s",
+			message.message.To, message.attempts, err)
+		return
+	}
+	delay := q.backoff << (message.attempts - 1)
+	q.logger.Printf("[Error] sending the notification to %s failed, retrying in %s. Err: %s",
+		message.message.To, delay, err)
+	time.AfterFunc(delay, func() {
+		if ctx.Err() == nil {
+			q.enqueue(message)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package notification
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyNotifier fails the first failures sends
+type flakyNotifier struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	sent     chan Message
+}
+
+func (n *flakyNotifier) Send(message Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.attempts++
+	if n.attempts <= n.failures {
+		return errors.New("the server is down")
+	}
+	n.sent <- message
+	return nil
+}
+
+func newTestQueue(notifier Notifier) *Queue {
+	queue := NewQueue(notifier, log.New(ioutil.Discard, "", log.LstdFlags))
+	queue.backoff = time.Millisecond
+	return queue
+}
+
+func TestQueueRetries(t *testing.T) {
+	notifier := &flakyNotifier{failures: 3, sent: make(chan Message, 1)}
+	queue := newTestQueue(notifier)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+	assert.Nil(t, queue.Send(Message{To: "test@test.com"}))
+	select {
+	case message := <-notifier.sent:
+		assert.Equal(t, "test@test.com", message.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message isn't sent")
+	}
+	notifier.mu.Lock()
+	assert.Equal(t, 4, notifier.attempts)
+	notifier.mu.Unlock()
+}
+
+func TestQueueDropsAfterMaxAttempts(t *testing.T) {
+	notifier := &flakyNotifier{failures: 100, sent: make(chan Message, 1)}
+	queue := newTestQueue(notifier)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+	assert.Nil(t, queue.Send(Message{To: "test@test.com"}))
+	assert.Eventually(t, func() bool {
+		notifier.mu.Lock()
+		defer notifier.mu.Unlock()
+		return notifier.attempts == defaultMaxAttempts
+	}, 5*time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	notifier.mu.Lock()
+	assert.Equal(t, defaultMaxAttempts, notifier.attempts)
+	notifier.mu.Unlock()
+}
+
+func TestQueueFull(t *testing.T) {
+	queue := newTestQueue(&flakyNotifier{})
+	queue.messages = make(chan queuedMessage, 1)
+	assert.Nil(t, queue.Send(Message{To: "first@test.com"}))
+	assert.ErrorIs(t, queue.Send(Message{To: "second@test.com"}), ErrQueueFull)
+}
+
+func TestQueueDrainsOnStop(t *testing.T) {
+	notifier := &flakyNotifier{sent: make(chan Message, 2)}
+	queue := newTestQueue(notifier)
+	assert.Nil(t, queue.Send(Message{To: "first@test.com"}))
+	assert.Nil(t, queue.Send(Message{To: "second@test.com"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	queue.Run(ctx)
+	assert.Len(t, notifier.sent, 2)
+}
@@ -0,0 +1,178 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds the whole delivery of an email, so a stalled server can't block the queue
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier delivers the messages as emails through an SMTP server, the connection is upgraded
+// with STARTTLS when the server supports it
+type SMTPNotifier struct {
+	host    string
+	addr    string
+	from    mail.Address
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+// NewSMTPNotifier returns the notifier of the server, the plain auth is only used when the
+// username is given
+func NewSMTPNotifier(host, port, username, password, from string) (*SMTPNotifier, error) {
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "The sender address is invalid")
+	}
+	notifier := &SMTPNotifier{host: host, addr: net.JoinHostPort(host, port), from: *fromAddress, timeout: smtpTimeout}
+	if username != "" {
+		notifier.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return notifier, nil
+}
+
+func (n *SMTPNotifier) Send(message Message) error {
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return errors.Wrap(err, "The recipient address is invalid")
+	}
+	body, err := n.buildMail(*to, message)
+	if err != nil {
+		return err
+	}
+	err = n.sendMail(to.Address, body)
+	if err != nil {
+		return errors.Wrap(err, "Error sending the email")
+	}
+	return nil
+}
+
+// sendMail delivers the email like smtp.SendMail, but the connection is dialed and used with
+// the timeout of the notifier
+func (n *SMTPNotifier) sendMail(to string, body []byte) error {
+	conn, err := (&net.Dialer{Timeout: n.timeout}).Dial("tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	err = conn.SetDeadline(time.Now().Add(n.timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: n.host})
+		if err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("The SMTP server doesn't support AUTH")
+		}
+		err = client.Auth(n.auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(n.from.Address)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMail encodes the message as a MIME email, with the HTML as the alternative of the text
+func (n *SMTPNotifier) buildMail(to mail.Address, message Message) ([]byte, error) {
+	buf := bytes.Buffer{}
+	header := textproto.MIMEHeader{}
+	header.Set("From", n.from.String())
+	header.Set("To", to.String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+	writer := multipart.NewWriter(&buf)
+	if message.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+	} else {
+		header.Set("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	}
+	for _, key := range []string{"From", "To", "Subject", "Date", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			if strings.ContainsAny(value, "\r\n") {
+				return nil, errors.Errorf("The %s header has a line break", key)
+			}
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+	if message.HTML == "" {
+		err := writeQuotedPrintable(&buf, message.Text)
+		return buf.Bytes(), err
+	}
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating the email part")
+		}
+		err = writeQuotedPrintable(partWriter, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error closing the email parts")
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	encoder := quotedprintable.NewWriter(w)
+	_, err := encoder.Write([]byte(content))
+	if err == nil {
+		err = encoder.Close()
+	}
+	return errors.Wrap(err, "Error encoding the email")
+}
@@ -0,0 +1,169 @@
+package notification
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMail is an email which the fake SMTP server has received
+type smtpMail struct {
+	from, to string
+	data     string
+}
+
+// startSMTPServer serves a fake SMTP server without extensions which accepts every email
+func startSMTPServer(t *testing.T) (string, string, chan smtpMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	mails := make(chan smtpMail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	assert.Nil(t, err)
+	return host, port, mails
+}
+
+func serveSMTP(conn net.Conn, mails chan smtpMail) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	received := smtpMail{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			received.from = strings.Trim(strings.TrimSpace(line)[10:], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			received.to = strings.Trim(strings.TrimSpace(line)[8:], "<>")
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 Go ahead")
+			data := strings.Builder{}
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			received.data = data.String()
+			mails <- received
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	host, port, mails := startSMTPServer(t)
+	notifier, err := NewSMTPNotifier(host, port, "", "", "Auth <no-reply@test.com>")
+	assert.Nil(t, err)
+
+	assert.Nil(t, notifier.Send(Message{To: "test@test.com", Subject: "Grüße", Text: "Hi, open https://localhost/?token=a=b\n"}))
+	received := <-mails
+	assert.Equal(t, "no-reply@test.com", received.from)
+	assert.Equal(t, "test@test.com", received.to)
+	message, err := mail.ReadMessage(strings.NewReader(received.data))
+	assert.Nil(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Grüße", subject)
+	assert.Equal(t, `"Auth" <no-reply@test.com>`, message.Header.Get("From"))
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(message.Body))
+	assert.Nil(t, err)
+	assert.Equal(t, "Hi, open https://localhost/?token=a=b\r\n", string(body))
+
+	assert.Nil(t, notifier.Send(Message{To: "test@test.com", Subject: "Welcome", Text: "Hi", HTML: "<p>Hi</p>"}))
+	received = <-mails
+	message, err = mail.ReadMessage(strings.NewReader(received.data))
+	assert.Nil(t, err)
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for _, want := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", "Hi"},
+		{"text/html; charset=utf-8", "<p>Hi</p>"},
+	} {
+		part, err := parts.NextPart()
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, want.contentType, part.Header.Get("Content-Type"))
+		content, err := ioutil.ReadAll(part)
+		assert.Nil(t, err)
+		assert.Equal(t, want.content, string(content))
+	}
+}
+
+func TestSMTPNotifierErrors(t *testing.T) {
+	_, err := NewSMTPNotifier("localhost", "25", "", "", "invalid")
+	assert.NotNil(t, err)
+	host, port, mails := startSMTPServer(t)
+	notifier, err := NewSMTPNotifier(host, port, "", "", "no-reply@test.com")
+	assert.Nil(t, err)
+	assert.NotNil(t, notifier.Send(Message{To: "invalid", Subject: "Welcome"}))
+	assert.NotNil(t, notifier.Send(Message{To: "test@test.com\r\nBcc: other@test.com", Subject: "Welcome"}))
+
+	// the line breaks of the subject are encoded and can't add headers
+	assert.Nil(t, notifier.Send(Message{To: "test@test.com", Subject: "Welcome\r\nBcc: other@test.com"}))
+	message, err := mail.ReadMessage(strings.NewReader((<-mails).data))
+	assert.Nil(t, err)
+	assert.Empty(t, message.Header.Get("Bcc"))
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// the server accepts the connection but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	assert.Nil(t, err)
+	notifier, err := NewSMTPNotifier(host, port, "", "", "no-reply@test.com")
+	assert.Nil(t, err)
+	notifier.timeout = 100 * time.Millisecond
+	start := time.Now()
+	assert.NotNil(t, notifier.Send(Message{To: "test@test.com", Subject: "Welcome"}))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,118 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"github.com/pkg/errors"
+	htmlTemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	textTemplate "text/template"
+)
+
+const DefaultLocale = "en"
+
+var ErrTemplateNotFound = errors.New("The notification template doesn't exist")
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// template is a notification in one locale, the text template defines the subject and the body
+// and the HTML one is optional
+type template struct {
+	text *textTemplate.Template
+	html *htmlTemplate.Template
+}
+
+// Templates are the notification templates of every locale. They are read from
+// <locale>/<name>.txt files which define the "subject" and "body" templates with text/template,
+// and the optional <locale>/<name>.html files which are the HTML body with html/template.
+type Templates struct {
+	locales map[string]map[string]template
+}
+
+// DefaultTemplates returns the templates which are embedded in the service
+func DefaultTemplates() (*Templates, error) {
+	templates, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading the embedded templates")
+	}
+	return NewTemplates(templates)
+}
+
+// NewTemplates parses the templates of the locale directories of the file system
+func NewTemplates(fsys fs.FS) (*Templates, error) {
+	templates := &Templates{locales: map[string]map[string]template{}}
+	textFiles, err := fs.Glob(fsys, "*/*.txt")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing the templates")
+	}
+	for _, textFile := range textFiles {
+		locale, name := path.Dir(textFile), strings.TrimSuffix(path.Base(textFile), ".txt")
+		parsed := template{}
+		parsed.text, err = textTemplate.ParseFS(fsys, textFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing the %s template", textFile)
+		}
+		if parsed.text.Lookup("subject") == nil || parsed.text.Lookup("body") == nil {
+			return nil, errors.Errorf("The %s template doesn't define the subject and the body", textFile)
+		}
+		htmlFile := path.Join(locale, name+".html")
+		if _, err := fs.Stat(fsys, htmlFile); err == nil {
+			parsed.html, err = htmlTemplate.ParseFS(fsys, htmlFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error parsing the %s template", htmlFile)
+			}
+		}
+		if templates.locales[locale] == nil {
+			templates.locales[locale] = map[string]template{}
+		}
+		templates.locales[locale][name] = parsed
+	}
+	return templates, nil
+}
+
+// lookup finds the template in the locale, then in its language and then in the default locale
+func (t *Templates) lookup(name, locale string) (template, bool) {
+	locale = strings.ReplaceAll(locale, "_", "-")
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	for _, candidate := range append(candidates, DefaultLocale) {
+		for loaded, templates := range t.locales {
+			if strings.EqualFold(loaded, candidate) {
+				if found, ok := templates[name]; ok {
+					return found, true
+				}
+			}
+		}
+	}
+	return template{}, false
+}
+
+// Render executes the template of the name in the locale with the data, the recipient of the
+// message isn't set
+func (t *Templates) Render(name, locale string, data interface{}) (Message, error) {
+	found, ok := t.lookup(name, locale)
+	if !ok {
+		return Message{}, errors.Wrapf(ErrTemplateNotFound, "the %s template doesn't exist", name)
+	}
+	subject, text, html := bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}
+	err := found.text.ExecuteTemplate(&subject, "subject", data)
+	if err == nil {
+		err = found.text.ExecuteTemplate(&text, "body", data)
+	}
+	if err == nil && found.html != nil {
+		err = found.html.Execute(&html, data)
+	}
+	if err != nil {
+		return Message{}, errors.Wrapf(err, "Error rendering the %s template", name)
+	}
+	return Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
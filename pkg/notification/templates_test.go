@@ -0,0 +1,60 @@
+package notification
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefaultTemplates(t *testing.T) {
+	templates, err := DefaultTemplates()
+	assert.Nil(t, err)
+	for _, locale := range []string{"en", "de"} {
+		for _, name := range []string{"email_verification", "password_reset", "password_changed", "mfa_enabled", "mfa_disabled", "passkey_added"} {
+			message, err := templates.Render(name, locale, map[string]interface{}{
+				"Email": "test@test.com", "Link": "https://localhost/?token=a&b", "Hours": 24, "Minutes": 30,
+			})
+			assert.Nil(t, err, name)
+			assert.NotEmpty(t, message.Subject, name)
+			assert.Contains(t, message.Text, "test@test.com", name)
+		}
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	templates, err := NewTemplates(fstest.MapFS{
+		"en/welcome.txt":  {Data: []byte(`{{define "subject"}} Welcome {{.Name}} {{end}}{{define "body"}}Hi {{.Name}}{{end}}`)},
+		"en/welcome.html": {Data: []byte(`<p>Hi {{.Name}}</p>`)},
+		"de/welcome.txt":  {Data: []byte(`{{define "subject"}}Willkommen {{.Name}}{{end}}{{define "body"}}Hallo {{.Name}}{{end}}`)},
+	})
+	assert.Nil(t, err)
+	tests := []struct {
+		locale  string
+		subject string
+		html    string
+	}{
+		{"en", "Welcome <b>", "<p>Hi &lt;b&gt;</p>"},
+		{"de", "Willkommen <b>", ""},
+		{"de_CH", "Willkommen <b>", ""},
+		{"DE-at", "Willkommen <b>", ""},
+		{"fr", "Welcome <b>", "<p>Hi &lt;b&gt;</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			message, err := templates.Render("welcome", tt.locale, map[string]string{"Name": "<b>"})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.subject, message.Subject)
+			assert.Equal(t, tt.html, message.HTML)
+			assert.Empty(t, message.To)
+		})
+	}
+	_, err = templates.Render("unknown", "en", nil)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
+func TestNewTemplatesErrors(t *testing.T) {
+	_, err := NewTemplates(fstest.MapFS{"en/welcome.txt": {Data: []byte(`Hi {{.Name}}`)}})
+	assert.NotNil(t, err)
+	_, err = NewTemplates(fstest.MapFS{"en/welcome.txt": {Data: []byte(`{{define "subject"}}{{end}}{{define "body"}}{{.Name}`)}})
+	assert.NotNil(t, err)
+}